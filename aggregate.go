@@ -0,0 +1,99 @@
+package iprtb
+
+import (
+	"net"
+)
+
+// Aggregate returns the minimal routes that make the same forwarding decisions as the routes.
+//
+// Two sibling routes (e.g. 192.0.2.0/25 and 192.0.2.128/25) that have the same gateway, network interface and metric
+// are merged into the covering route (e.g. 192.0.2.0/24), and a route that has the same gateway, network interface
+// and metric as the nearest covering route is removed because the covering route forwards the packets in the same way.
+// The result is sorted as well as Routes.Sort, and the given routes are not modified.
+func (rs Routes) Aggregate() Routes {
+	// aggregatedRoutes[prefixLen] has the routes that have the prefix length by the destination key; for each address family
+	aggregatedRoutes := map[int][]map[string]*Route{
+		net.IPv4len: make([]map[string]*Route, 8*net.IPv4len+1),
+		net.IPv6len: make([]map[string]*Route, 8*net.IPv6len+1),
+	}
+	for _, r := range rs {
+		ip := canonicalDestinationIP(r.Destination)
+		prefixLen, _ := r.Destination.Mask.Size()
+		routesByPrefixLen, ok := aggregatedRoutes[len(ip)]
+		if !ok || prefixLen > 8*len(ip) {
+			continue // the trie doesn't hold such a route either
+		}
+		if routesByPrefixLen[prefixLen] == nil {
+			routesByPrefixLen[prefixLen] = map[string]*Route{}
+		}
+		routesByPrefixLen[prefixLen][string(ip)] = r
+	}
+
+	aggregated := Routes{}
+	for _, ipLen := range []int{net.IPv4len, net.IPv6len} {
+		routesByPrefixLen := aggregatedRoutes[ipLen]
+		mergeSiblingRoutes(routesByPrefixLen, ipLen)
+		aggregated = append(aggregated, removeRedundantRoutes(routesByPrefixLen, ipLen)...)
+	}
+	aggregated.Sort()
+	return aggregated
+}
+
+// mergeSiblingRoutes merges the sibling routes that have the same route information into the covering route from the longest prefix length.
+// The merged route replaces the existing covering route because the siblings shadow the whole range of that.
+func mergeSiblingRoutes(routesByPrefixLen []map[string]*Route, ipLen int) {
+	for prefixLen := 8 * ipLen; prefixLen > 0; prefixLen-- {
+		for key, r := range routesByPrefixLen[prefixLen] {
+			siblingIP := net.IP(key).Mask(net.CIDRMask(prefixLen, 8*ipLen)) // copy
+			siblingIP[(prefixLen-1)/8] ^= 0b10000000 >> ((prefixLen - 1) % 8)
+			sibling, ok := routesByPrefixLen[prefixLen][string(siblingIP)]
+			if !ok || !isSameRoute(r, sibling) {
+				continue
+			}
+
+			delete(routesByPrefixLen[prefixLen], key)
+			delete(routesByPrefixLen[prefixLen], string(siblingIP))
+
+			mask := net.CIDRMask(prefixLen-1, 8*ipLen)
+			coveringIP := net.IP(key).Mask(mask)
+			if routesByPrefixLen[prefixLen-1] == nil {
+				routesByPrefixLen[prefixLen-1] = map[string]*Route{}
+			}
+			routesByPrefixLen[prefixLen-1][string(coveringIP)] = &Route{
+				Destination: &net.IPNet{
+					IP:   coveringIP,
+					Mask: mask,
+				},
+				Gateway:          r.Gateway,
+				NetworkInterface: r.NetworkInterface,
+				Metric:           r.Metric,
+			}
+		}
+	}
+}
+
+// removeRedundantRoutes returns the routes except the ones that have the same route information as the nearest covering route.
+func removeRedundantRoutes(routesByPrefixLen []map[string]*Route, ipLen int) Routes {
+	routes := Routes{}
+	for prefixLen, routesByKey := range routesByPrefixLen {
+		for key, r := range routesByKey {
+			if coveringRoute := findCoveringRoute(routesByPrefixLen, net.IP(key), prefixLen, ipLen); coveringRoute != nil && isSameRoute(r, coveringRoute) {
+				continue
+			}
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+func findCoveringRoute(routesByPrefixLen []map[string]*Route, ip net.IP, prefixLen int, ipLen int) *Route {
+	for coveringPrefixLen := prefixLen - 1; coveringPrefixLen >= 0; coveringPrefixLen-- {
+		if len(routesByPrefixLen[coveringPrefixLen]) == 0 {
+			continue
+		}
+		if r, ok := routesByPrefixLen[coveringPrefixLen][string(ip.Mask(net.CIDRMask(coveringPrefixLen, 8*ipLen)))]; ok {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes_Aggregate(t *testing.T) {
+	routes, err := ParseRoutes(strings.NewReader(`
+10.0.0.0/8 via 192.0.2.1 dev eth0
+10.1.0.0/16 via 192.0.2.1 dev eth0
+10.2.0.0/16 via 192.0.2.2 dev eth0
+10.2.1.0/24 via 192.0.2.1 dev eth0
+198.51.100.0/25 dev eth1
+198.51.100.128/26 dev eth1
+198.51.100.192/26 dev eth1
+203.0.113.0/25 dev eth1
+203.0.113.128/25 dev eth1 metric 1
+2001:db8::/33 dev eth2
+2001:db8:8000::/33 dev eth2
+2001:db8:1::/48 dev eth2
+`))
+	assert.NoError(t, err)
+
+	aggregated := routes.Aggregate()
+	assert.Equal(t, `10.0.0.0/8	192.0.2.1	eth0	0
+10.2.0.0/16	192.0.2.2	eth0	0
+10.2.1.0/24	192.0.2.1	eth0	0
+198.51.100.0/24	<nil>	eth1	0
+203.0.113.0/25	<nil>	eth1	0
+203.0.113.128/25	<nil>	eth1	1
+2001:db8::/32	<nil>	eth2	0
+`, aggregated.String())
+
+	// the forwarding decisions are not changed
+	ctx := context.Background()
+	original := NewRouteTable()
+	assert.NoError(t, original.AddRoutes(ctx, routes))
+	aggregatedTable := NewRouteTable()
+	assert.NoError(t, aggregatedTable.AddRoutes(ctx, aggregated))
+	assert.Empty(t, DiffForwarding(ctx, original, aggregatedTable))
+
+	// the given routes are not modified
+	assert.Len(t, routes, 12)
+}
+
+func TestRoutes_Aggregate_MergeIntoDefaultRoute(t *testing.T) {
+	routes, err := ParseRoutes(strings.NewReader(`
+0.0.0.0/1 via 192.0.2.1
+128.0.0.0/1 via 192.0.2.1
+0.0.0.0/0 via 192.0.2.2
+`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "0.0.0.0/0\t192.0.2.1\t\t0\n", routes.Aggregate().String())
+	assert.Empty(t, Routes{}.Aggregate())
+}
+
+func TestRoutes_Aggregate_ChainedMerge(t *testing.T) {
+	routes, err := ParseRoutes(strings.NewReader(`
+192.0.2.0/26 via 198.51.100.1
+192.0.2.64/26 via 198.51.100.1
+192.0.2.128/26 via 198.51.100.1
+192.0.2.192/26 via 198.51.100.1
+192.0.2.0/24 via 198.51.100.2
+192.0.0.0/16 via 198.51.100.1
+192.0.3.0/24 via 198.51.100.1 metric 1
+192.0.3.0/24 via 198.51.100.1
+`))
+	assert.NoError(t, err)
+
+	// the /26 routes are merged into /24 that replaces the existing one, and that becomes redundant with /16;
+	// the latter one of the duplicated destinations wins
+	assert.Equal(t, "192.0.0.0/16\t198.51.100.1\t\t0\n", routes.Aggregate().String())
+}
+
+func TestRoutes_Aggregate_IgnoresUnsupportedDestination(t *testing.T) {
+	routes := Routes{
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(192, 0, 2, 0),
+				Mask: net.CIDRMask(120, 128),
+			},
+			NetworkInterface: "eth0",
+		},
+	}
+	assert.Empty(t, routes.Aggregate())
+}
@@ -0,0 +1,167 @@
+package iprtb
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/moznion/go-optional"
+)
+
+// ErrInvalidAddr represents the error that indicates given netip.Addr is invalid (i.e. the zero value).
+var ErrInvalidAddr = errors.New("given netip.Addr is invalid")
+
+// BatchMatchOptions is the options of MatchRoutes and MatchAddrs.
+type BatchMatchOptions struct {
+	// SortTargets makes the lookups in the order of the addresses instead of the given order, so that the consecutive lookups
+	// share the traversed path of the prefix tree as much as possible. This is effective for the large number of unordered targets.
+	// The results are positionally aligned with the given targets regardless of this option.
+	SortTargets bool
+}
+
+// MatchRoutes does MatchRoute for each target IP address at once, and returns the results that are positionally aligned with the given targets.
+// This acquires the read lock only once, and a lookup resumes the traversal from the node where the path to the previous target diverges,
+// so this is much faster than calling MatchRoute repeatedly when the targets are ordered or clustered.
+// The lookup cache is not used, but the hit counters are counted up if they are enabled.
+// If there is an invalid target, this returns an error without matching any routes.
+func (rt *RouteTable) MatchRoutes(ctx context.Context, targets []net.IP, opts BatchMatchOptions) ([]optional.Option[Route], error) {
+	keys := make([]batchMatchKey, len(targets))
+	for i, target := range targets {
+		adjusted, err := adjustIPLength(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target IP address on matching routes; targets[%d] => %s: %w", i, target, err)
+		}
+		keys[i].len = uint8(copy(keys[i].ip[:], adjusted))
+	}
+	return rt.matchBatch(keys, opts), nil
+}
+
+// MatchAddrs is the netip.Addr variant of MatchRoutes. IPv4-mapped IPv6 addresses are regarded as IPv4 addresses as well as MatchRoute.
+func (rt *RouteTable) MatchAddrs(ctx context.Context, targets []netip.Addr, opts BatchMatchOptions) ([]optional.Option[Route], error) {
+	keys := make([]batchMatchKey, len(targets))
+	for i, target := range targets {
+		if !target.IsValid() {
+			return nil, fmt.Errorf("invalid target address on matching routes; targets[%d]: %w", i, ErrInvalidAddr)
+		}
+		target = target.Unmap()
+		if target.Is4() {
+			ipv4 := target.As4()
+			keys[i].len = uint8(copy(keys[i].ip[:], ipv4[:]))
+		} else {
+			keys[i].ip = target.As16()
+			keys[i].len = net.IPv6len
+		}
+	}
+	return rt.matchBatch(keys, opts), nil
+}
+
+// batchMatchKey is an adjusted target IP address in a fixed size array to avoid allocations for each target.
+type batchMatchKey struct {
+	ip  [net.IPv6len]byte
+	len uint8
+}
+
+func (k *batchMatchKey) bytes() []byte {
+	return k.ip[:k.len]
+}
+
+func (rt *RouteTable) matchBatch(keys []batchMatchKey, opts BatchMatchOptions) []optional.Option[Route] {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	if opts.SortTargets {
+		slices.SortFunc(order, func(a int, b int) int {
+			if c := cmp.Compare(keys[a].len, keys[b].len); c != 0 {
+				return c
+			}
+			return bytes.Compare(keys[a].bytes(), keys[b].bytes())
+		})
+	}
+
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	hitCounting := rt.hitCounting.Load()
+	results := make([]optional.Option[Route], len(keys))
+	m := &batchMatcher{rt: rt}
+	for _, i := range order {
+		matchedNode := m.match(rt.routes, keys[i].bytes())
+		if hitCounting {
+			if matchedNode != nil {
+				matchedNode.hits.Add(1)
+			} else {
+				rt.misses.Add(1)
+			}
+		}
+		if matchedNode == nil {
+			results[i] = optional.None[Route]()
+		} else {
+			results[i] = optional.Some[Route](*matchedNode.route)
+		}
+	}
+	return results
+}
+
+// batchMatcher does the longest prefix matching with remembering the traversed path of the previous target.
+type batchMatcher struct {
+	rt    *RouteTable
+	path  [8*net.IPv6len + 1]*node // path[d] is the node at depth d of the previous traversal
+	best  [8*net.IPv6len + 1]*node // best[d] is the deepest node that has a route in path[0..d]
+	depth int                      // the depth of the last node of the previous traversal
+	prev  []byte
+}
+
+func (m *batchMatcher) match(root *node, target []byte) *node {
+	depth := 0
+	if m.prev != nil && len(m.prev) == len(target) {
+		depth = min(commonPrefixLen(m.prev, target), m.depth)
+	} else {
+		m.path[0] = root
+		m.best[0] = nil
+		if root.route != nil && m.rt.isRouteUsable(root.route) {
+			m.best[0] = root
+		}
+	}
+
+	visitNode := m.path[depth]
+	for depth < 8*len(target) {
+		var nextNode *node
+		if toBit(target[depth/8], depth%8) == 0 {
+			nextNode = visitNode.zeroBitNode
+		} else {
+			nextNode = visitNode.oneBitNode
+		}
+		if nextNode == nil {
+			break
+		}
+
+		depth++
+		m.path[depth] = nextNode
+		m.best[depth] = m.best[depth-1]
+		if nextNode.route != nil && m.rt.isRouteUsable(nextNode.route) {
+			m.best[depth] = nextNode
+		}
+		visitNode = nextNode
+	}
+
+	m.depth = depth
+	m.prev = target
+	return m.best[depth]
+}
+
+// commonPrefixLen returns the number of the leading bits that are the same between a and b. The lengths of a and b must be the same.
+func commonPrefixLen(a []byte, b []byte) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return 8*i + bits.LeadingZeros8(x)
+		}
+	}
+	return 8 * len(a)
+}
@@ -0,0 +1,140 @@
+package iprtb
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const batchMatchTestRoutes = `10.0.0.0/8 via 192.0.2.1 dev eth0
+10.1.0.0/16 via 192.0.2.2 dev eth0
+10.1.2.0/24 dev eth1
+10.1.2.3/32 dev eth2
+192.0.2.0/24 dev eth0
+192.0.2.128/25 dev eth3
+2001:db8::/32 via fe80::1 dev eth0
+2001:db8:1::/48 via fe80::2 dev eth0
+2001:db8:1:2::/64 dev eth1
+`
+
+func TestRouteTable_MatchRoutes(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, batchMatchTestRoutes)
+
+	r := rand.New(rand.NewSource(1))
+	targets := make([]net.IP, 0, 2000)
+	for i := 0; i < 1000; i++ {
+		targets = append(targets, net.IPv4(
+			[]byte{10, 192, 198}[r.Intn(3)],
+			[]byte{0, 1}[r.Intn(2)],
+			byte(r.Intn(4)),
+			byte(r.Intn(256)),
+		))
+		ipv6 := net.ParseIP("2001:db8::")
+		ipv6[5] = byte(r.Intn(2))
+		ipv6[7] = byte(r.Intn(3))
+		ipv6[15] = byte(r.Intn(256))
+		targets = append(targets, ipv6)
+	}
+
+	for _, opts := range []BatchMatchOptions{{SortTargets: false}, {SortTargets: true}} {
+		results, err := rtb.MatchRoutes(ctx, targets, opts)
+		assert.NoError(t, err)
+		assert.Len(t, results, len(targets))
+		for i, target := range targets {
+			expected, err := rtb.MatchRoute(ctx, target)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, results[i], "target => %s, options => %+v", target, opts)
+		}
+	}
+}
+
+func TestRouteTable_MatchAddrs(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, batchMatchTestRoutes)
+
+	results, err := rtb.MatchAddrs(ctx, []netip.Addr{
+		netip.MustParseAddr("10.1.2.3"),
+		netip.MustParseAddr("2001:db8:1:2::1"),
+		netip.MustParseAddr("::ffff:192.0.2.129"),
+		netip.MustParseAddr("198.51.100.1"),
+		netip.MustParseAddr("10.1.2.4"),
+	}, BatchMatchOptions{SortTargets: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.2.3/32\t<nil>\teth2\t0", results[0].Unwrap().String())
+	assert.Equal(t, "2001:db8:1:2::/64\t<nil>\teth1\t0", results[1].Unwrap().String())
+	assert.Equal(t, "192.0.2.128/25\t<nil>\teth3\t0", results[2].Unwrap().String())
+	assert.True(t, results[3].IsNone())
+	assert.Equal(t, "10.1.2.0/24\t<nil>\teth1\t0", results[4].Unwrap().String())
+
+	_, err = rtb.MatchAddrs(ctx, []netip.Addr{netip.MustParseAddr("10.1.2.3"), {}}, BatchMatchOptions{})
+	assert.ErrorIs(t, err, ErrInvalidAddr)
+	assert.ErrorContains(t, err, "targets[1]")
+}
+
+func TestRouteTable_MatchRoutes_WithInvalidTarget(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, batchMatchTestRoutes)
+	rtb.EnableHitCounters(ctx, true)
+
+	_, err := rtb.MatchRoutes(ctx, []net.IP{
+		net.IPv4(10, 0, 0, 1),
+		{0x20, 0x01, 0x0d, 0xb8, 0x00}, // invalid length
+	}, BatchMatchOptions{})
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+	assert.ErrorContains(t, err, "targets[1]")
+
+	// nothing is counted
+	assert.Equal(t, uint64(0), rtb.HitCounters(ctx).Routes[0].Hits)
+}
+
+func TestRouteTable_MatchRoutes_WithHitCounters(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, batchMatchTestRoutes)
+	rtb.EnableHitCounters(ctx, true)
+
+	_, err := rtb.MatchRoutes(ctx, []net.IP{
+		net.IPv4(10, 0, 0, 1),
+		net.IPv4(10, 0, 0, 2),
+		net.IPv4(198, 51, 100, 1),
+	}, BatchMatchOptions{})
+	assert.NoError(t, err)
+
+	counters := rtb.HitCounters(ctx)
+	assert.Equal(t, "10.0.0.0/8", counters.Routes[0].Route.Destination.String())
+	assert.Equal(t, uint64(2), counters.Routes[0].Hits)
+	assert.Equal(t, uint64(1), counters.Misses)
+}
+
+func BenchmarkRouteTable_MatchRoutes(b *testing.B) {
+	ctx := context.Background()
+	rtb := newBenchmarkRouteTable(b, 100000)
+	r := rand.New(rand.NewSource(1))
+	targets := make([]net.IP, 100000)
+	for i := range targets {
+		n := r.Intn(100000)
+		targets[i] = net.IPv4(10, byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	b.Run("MatchRoute", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, target := range targets {
+				_, _ = rtb.MatchRoute(ctx, target)
+			}
+		}
+	})
+	b.Run("MatchRoutes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rtb.MatchRoutes(ctx, targets, BatchMatchOptions{})
+		}
+	})
+	b.Run("MatchRoutes with SortTargets", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rtb.MatchRoutes(ctx, targets, BatchMatchOptions{SortTargets: true})
+		}
+	})
+}
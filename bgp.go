@@ -0,0 +1,251 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/moznion/go-optional"
+)
+
+// the BGP message constants (RFC 4271 and RFC 4760)
+const (
+	bgpMarkerLen         = 16
+	bgpHeaderLen         = 19
+	bgpMessageTypeUpdate = 2
+
+	bgpAttrTypeMPUnreachNLRI = 15
+
+	bgpAFIIPv4     = 1
+	bgpAFIIPv6     = 2
+	bgpSAFIUnicast = 1
+)
+
+// ErrInvalidBGPMessage represents the error that indicates given data is not a valid BGP UPDATE message.
+var ErrInvalidBGPMessage = errors.New("invalid BGP UPDATE message")
+
+// BGPUpdate is a decoded BGP UPDATE message.
+//
+// WithdrawnRoutes has the prefixes of the withdrawn routes field and MP_UNREACH_NLRI attribute.
+// Routes has the routes of NLRI field and MP_REACH_NLRI attribute; the next hop (NEXT_HOP attribute for NLRI field,
+// and the next hop of MP_REACH_NLRI for that attribute) is mapped to Gateway, and MULTI_EXIT_DISC is mapped to Metric.
+type BGPUpdate struct {
+	WithdrawnRoutes []*net.IPNet
+	Routes          Routes
+}
+
+// DecodeBGPUpdate decodes a raw BGP UPDATE message including the header (i.e. the marker, length and type).
+// This supports IPv4 and IPv6 unicast routes; the multiprotocol attributes of the other AFI/SAFI are ignored.
+// ADD-PATH encoded NLRI is not supported because that depends on the capabilities negotiated on the session.
+func DecodeBGPUpdate(msg []byte) (*BGPUpdate, error) {
+	d := &bytesDecoder{b: msg}
+	marker := d.bytes(bgpMarkerLen)
+	length := d.uint16()
+	msgType := d.uint8()
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to decode BGP message header: %w", d.err)
+	}
+	for _, b := range marker {
+		if b != 0xff {
+			return nil, fmt.Errorf("invalid marker of BGP message: %w", ErrInvalidBGPMessage)
+		}
+	}
+	if int(length) != len(msg) || length < bgpHeaderLen {
+		return nil, fmt.Errorf("BGP message length mismatches; header => %d, actual => %d: %w", length, len(msg), ErrInvalidBGPMessage)
+	}
+	if msgType != bgpMessageTypeUpdate {
+		return nil, fmt.Errorf("not an UPDATE message; type => %d: %w", msgType, ErrInvalidBGPMessage)
+	}
+
+	withdrawnRoutesLen := d.uint16()
+	withdrawnRoutes := d.bytes(int(withdrawnRoutesLen))
+	attrsLen := d.uint16()
+	attrs := d.bytes(int(attrsLen))
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to decode BGP UPDATE message: %w", d.err)
+	}
+	nlri := d.b
+
+	update := &BGPUpdate{
+		WithdrawnRoutes: []*net.IPNet{},
+		Routes:          Routes{},
+	}
+
+	prefixes, err := decodeBGPPrefixes(withdrawnRoutes, net.IPv4len)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode withdrawn routes: %w", err)
+	}
+	update.WithdrawnRoutes = append(update.WithdrawnRoutes, prefixes...)
+
+	var nextHop net.IP
+	med := optional.None[uint32]()
+	var mpRoutes Routes
+	err = forEachBGPAttribute(attrs, func(attrType byte, value []byte) error {
+		switch attrType {
+		case bgpAttrTypeNextHop:
+			if len(value) != net.IPv4len {
+				return fmt.Errorf("invalid NEXT_HOP length => %d: %w", len(value), ErrInvalidBGPMessage)
+			}
+			nextHop = net.IP(value)
+		case bgpAttrTypeMultiExitDisc:
+			if len(value) != 4 {
+				return fmt.Errorf("invalid MULTI_EXIT_DISC length => %d: %w", len(value), ErrInvalidBGPMessage)
+			}
+			med = optional.Some[uint32](binary.BigEndian.Uint32(value))
+		case bgpAttrTypeMPReachNLRI:
+			routes, err := decodeBGPMPReachNLRI(value)
+			if err != nil {
+				return fmt.Errorf("failed to decode MP_REACH_NLRI: %w", err)
+			}
+			mpRoutes = routes
+		case bgpAttrTypeMPUnreachNLRI:
+			prefixes, err := decodeBGPMPUnreachNLRI(value)
+			if err != nil {
+				return fmt.Errorf("failed to decode MP_UNREACH_NLRI: %w", err)
+			}
+			update.WithdrawnRoutes = append(update.WithdrawnRoutes, prefixes...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err = decodeBGPPrefixes(nlri, net.IPv4len)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode NLRI: %w", err)
+	}
+	if len(prefixes) > 0 && nextHop == nil {
+		return nil, fmt.Errorf("NLRI exists but NEXT_HOP attribute is missing: %w", ErrInvalidBGPMessage)
+	}
+
+	metric := int(med.TakeOr(0))
+	for _, prefix := range prefixes {
+		update.Routes = append(update.Routes, &Route{
+			Destination: prefix,
+			Gateway:     net.IP(bytes.Clone(nextHop)),
+			Metric:      metric,
+		})
+	}
+	for _, route := range mpRoutes {
+		route.Metric = metric
+		update.Routes = append(update.Routes, route)
+	}
+
+	return update, nil
+}
+
+// decodeBGPMPReachNLRI decodes MP_REACH_NLRI attribute; AFI (2 bytes), SAFI (1 byte), next hop length (1 byte), next hop, reserved (1 byte) and NLRI.
+func decodeBGPMPReachNLRI(value []byte) (Routes, error) {
+	d := &bytesDecoder{b: value}
+	afi := d.uint16()
+	safi := d.uint8()
+	nextHopLen := d.uint8()
+	nextHopBytes := d.bytes(int(nextHopLen))
+	d.skip(1) // reserved
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	ipLen, ok := bgpUnicastIPLen(afi, safi)
+	if !ok {
+		return Routes{}, nil
+	}
+
+	nextHop, err := mpReachNextHop(nextHopBytes, ErrInvalidBGPMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err := decodeBGPPrefixes(d.b, ipLen)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(Routes, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		routes = append(routes, &Route{
+			Destination: prefix,
+			Gateway:     net.IP(bytes.Clone(nextHop)),
+		})
+	}
+	return routes, nil
+}
+
+// decodeBGPMPUnreachNLRI decodes MP_UNREACH_NLRI attribute; AFI (2 bytes), SAFI (1 byte) and withdrawn routes.
+func decodeBGPMPUnreachNLRI(value []byte) ([]*net.IPNet, error) {
+	d := &bytesDecoder{b: value}
+	afi := d.uint16()
+	safi := d.uint8()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	ipLen, ok := bgpUnicastIPLen(afi, safi)
+	if !ok {
+		return []*net.IPNet{}, nil
+	}
+	return decodeBGPPrefixes(d.b, ipLen)
+}
+
+func bgpUnicastIPLen(afi uint16, safi byte) (int, bool) {
+	if safi != bgpSAFIUnicast {
+		return 0, false
+	}
+	switch afi {
+	case bgpAFIIPv4:
+		return net.IPv4len, true
+	case bgpAFIIPv6:
+		return net.IPv6len, true
+	default:
+		return 0, false
+	}
+}
+
+func decodeBGPPrefixes(b []byte, ipLen int) ([]*net.IPNet, error) {
+	prefixes := []*net.IPNet{}
+	d := &bytesDecoder{b: b}
+	for d.remaining() > 0 {
+		prefix, err := d.prefix(ipLen, ErrInvalidBGPMessage)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// ApplyBGPUpdate applies the decoded BGP UPDATE message to the routing table at once;
+// the withdrawn routes are removed as well as RemoveRoute, and then the announced routes are added as well as AddRoute.
+// If there is an invalid route, this returns an error without modifying the routing table.
+func (rt *RouteTable) ApplyBGPUpdate(ctx context.Context, update *BGPUpdate) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, destination := range update.WithdrawnRoutes {
+		if err := validateDestination(destination); err != nil {
+			return fmt.Errorf("failed to apply BGP UPDATE; invalid withdrawn route => %s: %w", destination, err)
+		}
+	}
+	for _, route := range update.Routes {
+		if err := validateDestination(route.Destination); err != nil {
+			return fmt.Errorf("failed to apply BGP UPDATE; invalid route => %s: %w", route.Destination, err)
+		}
+	}
+
+	for _, destination := range update.WithdrawnRoutes {
+		if _, err := rt.removeRoute(ctx, destination); err != nil {
+			return err
+		}
+		rt.removeLabelByDestination(destination)
+	}
+	for _, route := range update.Routes {
+		if err := rt.addRoute(ctx, route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package iprtb
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// IPv4 UPDATE: withdraws 10.0.0.0/8 and announces 198.51.100.0/24 and 203.0.113.0/25 via 192.0.2.1 with MED 50
+const bgpTestIPv4UpdateHex = "ffffffffffffffffffffffffffffffff003d020002080a001b4001010040020602010000fbf0400304c00002018004040000003218c6336419cb007100"
+
+// IPv6 UPDATE: announces 2001:db8::/32 and 2001:db8:1::/48 via 2001:db8::1 (with link-local next hop) by MP_REACH_NLRI,
+// and withdraws 2001:db8:2::/64 by MP_UNREACH_NLRI
+const bgpTestIPv6UpdateHex = "ffffffffffffffffffffffffffffffff006902000000524001010040020602010000fbf0900e00310002012020010db8000000000000000000000001fe800000000000000000000000000001002020010db83020010db80001900f000c0002014020010db800020000"
+
+// IPv4 UPDATE: withdraws 198.51.100.0/24
+const bgpTestIPv4WithdrawHex = "ffffffffffffffffffffffffffffffff001b02000418c633640000"
+
+func decodeBGPTestHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestDecodeBGPUpdate_IPv4(t *testing.T) {
+	update, err := DecodeBGPUpdate(decodeBGPTestHex(t, bgpTestIPv4UpdateHex))
+	assert.NoError(t, err)
+
+	assert.Len(t, update.WithdrawnRoutes, 1)
+	assert.Equal(t, "10.0.0.0/8", update.WithdrawnRoutes[0].String())
+	assert.Equal(t, `198.51.100.0/24	192.0.2.1		50
+203.0.113.0/25	192.0.2.1		50
+`, update.Routes.String())
+}
+
+func TestDecodeBGPUpdate_IPv6(t *testing.T) {
+	update, err := DecodeBGPUpdate(decodeBGPTestHex(t, bgpTestIPv6UpdateHex))
+	assert.NoError(t, err)
+
+	assert.Len(t, update.WithdrawnRoutes, 1)
+	assert.Equal(t, "2001:db8:2::/64", update.WithdrawnRoutes[0].String())
+	assert.Equal(t, `2001:db8::/32	2001:db8::1		0
+2001:db8:1::/48	2001:db8::1		0
+`, update.Routes.String())
+}
+
+func TestDecodeBGPUpdate_Invalid(t *testing.T) {
+	valid := decodeBGPTestHex(t, bgpTestIPv4UpdateHex)
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := DecodeBGPUpdate(valid[:10])
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("invalid marker", func(t *testing.T) {
+		broken := append([]byte{}, valid...)
+		broken[0] = 0
+		_, err := DecodeBGPUpdate(broken)
+		assert.ErrorIs(t, err, ErrInvalidBGPMessage)
+	})
+
+	t.Run("length mismatch", func(t *testing.T) {
+		_, err := DecodeBGPUpdate(valid[:len(valid)-1])
+		assert.ErrorIs(t, err, ErrInvalidBGPMessage)
+	})
+
+	t.Run("not an UPDATE", func(t *testing.T) {
+		keepalive := decodeBGPTestHex(t, "ffffffffffffffffffffffffffffffff001304")
+		_, err := DecodeBGPUpdate(keepalive)
+		assert.ErrorIs(t, err, ErrInvalidBGPMessage)
+	})
+
+	t.Run("missing NEXT_HOP", func(t *testing.T) {
+		// announces 198.51.100.0/24 with only ORIGIN attribute
+		msg := decodeBGPTestHex(t, "ffffffffffffffffffffffffffffffff001f02000000044001010018c63364")
+		_, err := DecodeBGPUpdate(msg)
+		assert.ErrorIs(t, err, ErrInvalidBGPMessage)
+	})
+
+	t.Run("invalid prefix length", func(t *testing.T) {
+		// withdraws the prefix that has 33 bits length
+		msg := decodeBGPTestHex(t, "ffffffffffffffffffffffffffffffff001c02000521c63364000000")
+		_, err := DecodeBGPUpdate(msg)
+		assert.ErrorIs(t, err, ErrInvalidBGPMessage)
+	})
+}
+
+func TestRouteTable_ApplyBGPUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.AddRouteWithLabel(ctx, "withdrawn", &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(10, 0, 0, 0).To4(),
+			Mask: net.IPv4Mask(255, 0, 0, 0),
+		},
+		Gateway: net.IPv4(192, 0, 2, 254),
+	})
+	assert.NoError(t, err)
+
+	for _, msg := range []string{bgpTestIPv4UpdateHex, bgpTestIPv6UpdateHex} {
+		update, err := DecodeBGPUpdate(decodeBGPTestHex(t, msg))
+		assert.NoError(t, err)
+		err = rtb.ApplyBGPUpdate(ctx, update)
+		assert.NoError(t, err)
+	}
+
+	maybeMatchedRoute, err := rtb.MatchRoute(ctx, net.IPv4(10, 0, 0, 1))
+	assert.NoError(t, err)
+	assert.True(t, maybeMatchedRoute.IsNone())
+	maybeRemovedRoute, err := rtb.RemoveRouteByLabel(ctx, "withdrawn")
+	assert.NoError(t, err)
+	assert.True(t, maybeRemovedRoute.IsNone())
+
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", maybeMatchedRoute.Unwrap().Gateway.String())
+
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.ParseIP("2001:db8:1::1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:1::/48", maybeMatchedRoute.Unwrap().Destination.String())
+
+	update, err := DecodeBGPUpdate(decodeBGPTestHex(t, bgpTestIPv4WithdrawHex))
+	assert.NoError(t, err)
+	err = rtb.ApplyBGPUpdate(ctx, update)
+	assert.NoError(t, err)
+
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+	assert.True(t, maybeMatchedRoute.IsNone())
+	assert.Len(t, rtb.DumpRouteTable(ctx), 3)
+}
@@ -0,0 +1,92 @@
+package iprtb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// ErrRouteDestinationChanged represents the error that indicates the mutate function of UpdateRoutesWhere changed the destination of the route.
+var ErrRouteDestinationChanged = errors.New("the destination of the route mustn't be changed by the update")
+
+// RemoveRoutesWhere removes all routes that satisfy the given predicate, and the labels of them.
+// The removal is applied atomically under the lock, and the prefix tree is pruned as well as RemoveRoute.
+// The predicate receives a copy of each route, and it mustn't call the methods of the routing table because the lock is held.
+// This returns the removed routes that are ordered by the address family (IPv4 comes first), the destination address, and the prefix length.
+func (rt *RouteTable) RemoveRoutesWhere(ctx context.Context, predicate func(route Route) bool) (Routes, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	routes := rt.scanNode(rt.routes).Filter(func(r *Route) bool {
+		return predicate(*r)
+	})
+	routes.Sort()
+
+	removedRoutes, err := rt.removeRoutes(ctx, routes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove the routes: %w", err)
+	}
+	return removedRoutes, nil
+}
+
+// UpdateRoutesWhere updates all routes that satisfy the given predicate by the mutate function.
+// The mutate function receives a copy of each route and modifies its gateway, network interface and metric,
+// but it mustn't change the destination; if it does, this returns ErrRouteDestinationChanged without modifying the routing table.
+// The update is applied atomically under the lock, and the labels and the hit counters of the routes are kept.
+// The predicate and the mutate function mustn't call the methods of the routing table because the lock is held.
+// This returns the updated routes that are ordered by the address family (IPv4 comes first), the destination address, and the prefix length.
+func (rt *RouteTable) UpdateRoutesWhere(ctx context.Context, predicate func(route Route) bool, mutate func(route *Route)) (Routes, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	routes := rt.scanNode(rt.routes).Filter(func(r *Route) bool {
+		return predicate(*r)
+	})
+	routes.Sort()
+
+	// apply the mutate function to all routes before modifying the routing table, to keep it as is on an error
+	updatedRoutes := make(Routes, 0, len(routes))
+	for _, route := range routes {
+		updatedRoute := &Route{
+			Destination: &net.IPNet{
+				IP:   slices.Clone(route.Destination.IP),
+				Mask: slices.Clone(route.Destination.Mask),
+			},
+			Gateway:          slices.Clone(route.Gateway),
+			NetworkInterface: route.NetworkInterface,
+			Metric:           route.Metric,
+		}
+		mutate(updatedRoute)
+		if updatedRoute.Destination == nil || destinationKey(updatedRoute.Destination) != destinationKey(route.Destination) {
+			return nil, fmt.Errorf("failed to update the routes; destination => %s: %w", route.Destination, ErrRouteDestinationChanged)
+		}
+		updatedRoute.Destination = route.Destination // to keep the identity of the labelled destination
+		updatedRoutes = append(updatedRoutes, updatedRoute)
+	}
+
+	for _, route := range updatedRoutes {
+		if err := rt.addRoute(ctx, route); err != nil {
+			return nil, fmt.Errorf("failed to update the routes: %w", err)
+		}
+	}
+	return updatedRoutes, nil
+}
+
+// removeRoutes removes the given routes and the labels of them. The caller must hold the lock.
+func (rt *RouteTable) removeRoutes(ctx context.Context, routes Routes) (Routes, error) {
+	removedRoutes := make(Routes, 0, len(routes))
+	for _, route := range routes {
+		maybeRemovedRoute, err := rt.removeRoute(ctx, route.Destination)
+		if err != nil {
+			return nil, err
+		}
+		rt.removeLabelByDestination(route.Destination)
+		if maybeRemovedRoute.IsSome() {
+			removedRoute := maybeRemovedRoute.Unwrap()
+			removedRoutes = append(removedRoutes, &removedRoute)
+		}
+	}
+	return removedRoutes, nil
+}
@@ -0,0 +1,114 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTable_RemoveRoutesWhere(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader(`
+default via 192.0.2.1 dev eth0 metric 10
+10.0.0.0/8 via 192.0.2.2 dev eth1 metric 200
+10.1.0.0/16 via 192.0.2.2 dev eth1 metric 101
+10.1.2.0/24 via 192.0.2.2 dev eth1 metric 100
+2001:db8::/32 via 2001:db8::1 dev eth2 metric 150
+`)))
+	_, dst, _ := net.ParseCIDR("10.1.0.0/16")
+	assert.NoError(t, rtb.AddRouteWithLabel(ctx, "label", &Route{
+		Destination:      dst,
+		Gateway:          net.ParseIP("192.0.2.2"),
+		NetworkInterface: "eth1",
+		Metric:           101,
+	}))
+
+	removed, err := rtb.RemoveRoutesWhere(ctx, func(route Route) bool {
+		return route.Metric > 100
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32"}, destinations(removed))
+	assert.Equal(t, 101, removed[1].Metric)
+	assert.Equal(t, 2, rtb.Len(ctx))
+	assert.Empty(t, rtb.Labels(ctx))
+	assert.Equal(t, "0.0.0.0/0\t192.0.2.1\teth0\t10\n10.1.2.0/24\t192.0.2.2\teth1\t100\n", rtb.DumpRouteTable(ctx).String())
+
+	// the prefix tree is pruned
+	stats := rtb.Stats(ctx)
+	assert.Equal(t, 25, stats.Nodes)
+
+	removed, err = rtb.RemoveRoutesWhere(ctx, func(route Route) bool {
+		return false
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	removed, err = rtb.RemoveRoutesWhere(ctx, func(route Route) bool {
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Len(t, removed, 2)
+	assert.Equal(t, 1, rtb.Stats(ctx).Nodes)
+}
+
+func TestRouteTable_UpdateRoutesWhere(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader(`
+default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth1
+10.1.0.0/16 via 192.0.2.2 dev eth1 metric 5
+`)))
+	_, dst, _ := net.ParseCIDR("10.1.0.0/16")
+	assert.NoError(t, rtb.AddRouteWithLabel(ctx, "label", &Route{
+		Destination:      dst,
+		Gateway:          net.ParseIP("192.0.2.2"),
+		NetworkInterface: "eth1",
+		Metric:           5,
+	}))
+
+	oldGateway := net.ParseIP("192.0.2.2")
+	updated, err := rtb.UpdateRoutesWhere(ctx, func(route Route) bool {
+		return route.Gateway.Equal(oldGateway)
+	}, func(route *Route) {
+		route.Gateway = net.ParseIP("192.0.2.3")
+		route.NetworkInterface = "eth2"
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8\t192.0.2.3\teth2\t0\n10.1.0.0/16\t192.0.2.3\teth2\t5\n", updated.String())
+	assert.Equal(t, "0.0.0.0/0\t192.0.2.1\teth0\t0\n10.0.0.0/8\t192.0.2.3\teth2\t0\n10.1.0.0/16\t192.0.2.3\teth2\t5\n", rtb.DumpRouteTable(ctx).String())
+	assert.Equal(t, "192.0.2.3", rtb.GetRouteByLabel(ctx, "label").Unwrap().Gateway.String())
+
+	// the secondary indexes follow the update
+	removed, err := rtb.RemoveRoutesByGateway(ctx, oldGateway)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+	removed, err = rtb.RemoveRoutesByInterface(ctx, "eth2")
+	assert.NoError(t, err)
+	assert.Len(t, removed, 2)
+}
+
+func TestRouteTable_UpdateRoutesWhere_DestinationChanged(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader(`
+10.0.0.0/8 via 192.0.2.2 dev eth1
+10.1.0.0/16 via 192.0.2.2 dev eth1
+`)))
+
+	_, err := rtb.UpdateRoutesWhere(ctx, func(route Route) bool {
+		return true
+	}, func(route *Route) {
+		route.Metric = 1
+		route.Destination.IP[0] = 11 // this mustn't break the routing table
+	})
+	assert.ErrorIs(t, err, ErrRouteDestinationChanged)
+	assert.Equal(t, "10.0.0.0/8\t192.0.2.2\teth1\t0\n10.1.0.0/16\t192.0.2.2\teth1\t0\n", rtb.DumpRouteTable(ctx).String())
+}
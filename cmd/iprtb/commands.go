@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/moznion/go-iprtb"
+	"github.com/moznion/go-optional"
+)
+
+var matchCommand = &command{
+	name:        "match",
+	usage:       "[-f file] [-format format] <ip>...",
+	description: "prints the longest matched route for each IP address",
+}
+
+var dumpCommand = &command{
+	name:        "dump",
+	usage:       "[-f file] [-format format] [-o format]",
+	description: "prints the routes of the route file",
+}
+
+var diffCommand = &command{
+	name:        "diff",
+	usage:       "[-format format] [-forwarding] <old file> <new file>",
+	description: "prints the difference between two route files",
+}
+
+var aggregateCommand = &command{
+	name:        "aggregate",
+	usage:       "[-f file] [-format format] [-o format]",
+	description: "prints the minimal routes that make the same forwarding decisions",
+}
+
+var validateCommand = &command{
+	name:        "validate",
+	usage:       "[-format format] <file>...",
+	description: "checks that the route files can be loaded",
+}
+
+var shellCommand = &command{
+	name:        "shell",
+	usage:       "[-f file] [-format format]",
+	description: "starts the interactive shell to manipulate a routing table in memory",
+}
+
+var convertCommand = &command{
+	name:        "convert",
+	usage:       "[-f file] [-format format] -o format",
+	description: "converts the route file into another format",
+}
+
+func init() {
+	// these are assigned here to avoid the initialization cycle; each run function refers to its command for the usage
+	matchCommand.run = runMatch
+	dumpCommand.run = runDump
+	diffCommand.run = runDiff
+	aggregateCommand.run = runAggregate
+	validateCommand.run = runValidate
+	convertCommand.run = runConvert
+	shellCommand.run = runShell
+}
+
+func runMatch(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(matchCommand, e)
+	path := fs.String("f", "-", "the route file")
+	format := fs.String("format", formatAuto, inputFormatUsage())
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no IP address is given")
+	}
+
+	targets := make([]net.IP, fs.NArg())
+	for i, arg := range fs.Args() {
+		targets[i] = net.ParseIP(arg)
+		if targets[i] == nil {
+			return fmt.Errorf("invalid IP address => %q", arg)
+		}
+	}
+
+	rt, err := loadRouteTable(ctx, e, *path, *format)
+	if err != nil {
+		return err
+	}
+	maybeRoutes, err := rt.MatchRoutes(ctx, targets, iprtb.BatchMatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(e.stdout)
+	var unmatched bool
+	for i, maybeRoute := range maybeRoutes {
+		if maybeRoute.IsNone() {
+			unmatched = true
+			_, _ = fmt.Fprintf(w, "%s\tno route\n", targets[i])
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", targets[i], maybeRoute.Unwrap())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if unmatched {
+		return errFound
+	}
+	return nil
+}
+
+func runDump(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(dumpCommand, e)
+	path := fs.String("f", "-", "the route file")
+	format := fs.String("format", formatAuto, inputFormatUsage())
+	outputFormat := fs.String("o", formatTable, outputFormatUsage())
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rt, err := loadRouteTable(ctx, e, *path, *format)
+	if err != nil {
+		return err
+	}
+	return writeRouteTable(ctx, e.stdout, rt, *outputFormat)
+}
+
+func runDiff(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(diffCommand, e)
+	format := fs.String("format", formatAuto, inputFormatUsage())
+	forwarding := fs.Bool("forwarding", false, "prints the address ranges whose forwarding decisions differ instead of the routes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("two route files must be given")
+	}
+
+	oldTable, err := loadRouteTable(ctx, e, fs.Arg(0), *format)
+	if err != nil {
+		return err
+	}
+	newTable, err := loadRouteTable(ctx, e, fs.Arg(1), *format)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(e.stdout)
+	var found bool
+	if *forwarding {
+		changes := iprtb.DiffForwarding(ctx, oldTable, newTable)
+		for _, change := range changes {
+			_, _ = fmt.Fprintf(w, "%s\t%s -> %s\n", change.Range, forwardingText(change.OldRoute), forwardingText(change.NewRoute))
+		}
+		found = len(changes) > 0
+	} else {
+		diff := iprtb.DiffRouteTables(ctx, oldTable, newTable)
+		for _, d := range []struct {
+			mark   string
+			routes iprtb.Routes
+		}{
+			{mark: "-", routes: diff.Removed},
+			{mark: "+", routes: diff.Added},
+			{mark: "~", routes: diff.Updated},
+		} {
+			for _, r := range d.routes {
+				_, _ = fmt.Fprintf(w, "%s %s\n", d.mark, r)
+			}
+		}
+		found = !diff.IsEmpty()
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if found {
+		return errFound
+	}
+	return nil
+}
+
+// forwardingText returns the next hop of the route like "via 192.0.2.1 dev eth0". "unreachable" means there is no route.
+func forwardingText(maybeRoute optional.Option[iprtb.Route]) string {
+	if maybeRoute.IsNone() {
+		return "unreachable"
+	}
+	return nextHopText(maybeRoute.UnwrapAsPtr())
+}
+
+// nextHopText returns the next hop of the route like "via 192.0.2.1 dev eth0". "discard" means the route has neither gateway nor network interface.
+func nextHopText(route *iprtb.Route) string {
+	var nextHop []string
+	if route.Gateway != nil {
+		nextHop = append(nextHop, "via "+route.Gateway.String())
+	}
+	if route.NetworkInterface != "" {
+		nextHop = append(nextHop, "dev "+route.NetworkInterface)
+	}
+	if len(nextHop) == 0 {
+		return "discard"
+	}
+	return strings.Join(nextHop, " ")
+}
+
+func runAggregate(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(aggregateCommand, e)
+	path := fs.String("f", "-", "the route file")
+	format := fs.String("format", formatAuto, inputFormatUsage())
+	outputFormat := fs.String("o", formatText, outputFormatUsage())
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rt, err := loadRouteTable(ctx, e, *path, *format)
+	if err != nil {
+		return err
+	}
+
+	// the labels are dropped because the aggregated routes don't correspond to the original routes
+	aggregated := iprtb.NewRouteTable()
+	if err := aggregated.AddRoutes(ctx, rt.DumpRouteTable(ctx).Aggregate()); err != nil {
+		return err
+	}
+	return writeRouteTable(ctx, e.stdout, aggregated, *outputFormat)
+}
+
+func runValidate(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(validateCommand, e)
+	format := fs.String("format", formatAuto, inputFormatUsage())
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no route file is given")
+	}
+
+	var invalid bool
+	for _, path := range fs.Args() {
+		rt, err := loadRouteTable(ctx, e, path, *format)
+		if err != nil {
+			invalid = true
+			_, _ = fmt.Fprintf(e.stderr, "%s: %s\n", path, err)
+			continue
+		}
+		_, _ = fmt.Fprintf(e.stdout, "%s: ok (%d routes)\n", path, rt.Len(ctx))
+	}
+	if invalid {
+		return errFound
+	}
+	return nil
+}
+
+func runConvert(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(convertCommand, e)
+	path := fs.String("f", "-", "the route file")
+	format := fs.String("format", formatAuto, inputFormatUsage())
+	outputFormat := fs.String("o", "", outputFormatUsage())
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *outputFormat == "" {
+		fs.Usage()
+		return errors.New("the output format must be given by -o")
+	}
+
+	rt, err := loadRouteTable(ctx, e, *path, *format)
+	if err != nil {
+		return err
+	}
+	return writeRouteTable(ctx, e.stdout, rt, *outputFormat)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moznion/go-iprtb"
+)
+
+const (
+	formatAuto     = "auto"
+	formatJSON     = "json"
+	formatText     = "text"
+	formatSnapshot = "snapshot"
+	formatIPRoute2 = "iproute2"
+	formatTable    = "table"
+	formatIPBatch  = "ip-batch"
+)
+
+var (
+	inputFormats  = []string{formatAuto, formatJSON, formatText, formatSnapshot, formatIPRoute2}
+	outputFormats = []string{formatTable, formatText, formatJSON, formatSnapshot, formatIPBatch}
+)
+
+func inputFormatUsage() string {
+	return "the input format; one of " + strings.Join(inputFormats, ", ")
+}
+
+func outputFormatUsage() string {
+	return "the output format; one of " + strings.Join(outputFormats, ", ")
+}
+
+// loadRouteTable loads the route file in the format. If the path is "-", this reads the route file from the standard input.
+func loadRouteTable(ctx context.Context, e *env, path string, format string) (*iprtb.RouteTable, error) {
+	if format == formatAuto {
+		format = detectFormat(path)
+	}
+
+	var r io.Reader = e.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the route file: %w", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		r = f
+	}
+
+	rt := iprtb.NewRouteTable()
+	var err error
+	switch format {
+	case formatJSON:
+		var data []byte
+		data, err = io.ReadAll(r)
+		if err == nil {
+			err = json.Unmarshal(data, rt)
+		}
+	case formatText:
+		err = rt.LoadRoutes(ctx, r)
+	case formatSnapshot:
+		_, err = rt.ReadFrom(r)
+	case formatIPRoute2:
+		err = rt.LoadIPRouteOutput(ctx, r)
+	default:
+		return nil, fmt.Errorf("unknown input format => %q; %s", format, inputFormatUsage())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the route file => %s: %w", path, err)
+	}
+	return rt, nil
+}
+
+// detectFormat detects the format of the route file by the file extension.
+func detectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".snapshot":
+		return formatSnapshot
+	default:
+		return formatText
+	}
+}
+
+func writeRouteTable(ctx context.Context, w io.Writer, rt *iprtb.RouteTable, format string) error {
+	switch format {
+	case formatTable:
+		return rt.FormatTable(ctx, w, iprtb.TableFormatOptions{WithLabels: true})
+	case formatText:
+		return rt.WriteRoutes(ctx, w)
+	case formatJSON:
+		data, err := json.MarshalIndent(rt, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal the routing table: %w", err)
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case formatSnapshot:
+		_, err := rt.WriteTo(w)
+		return err
+	case formatIPBatch:
+		return rt.WriteIPBatch(ctx, w)
+	default:
+		return fmt.Errorf("unknown output format => %q; %s", format, outputFormatUsage())
+	}
+}
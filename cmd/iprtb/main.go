@@ -0,0 +1,129 @@
+// Command iprtb is a command-line tool to work with the route files on top of the iprtb package.
+//
+// Usage:
+//
+//	iprtb <command> [flags] [arguments]
+//
+// The commands are the following:
+//
+//	match      prints the longest matched route for each IP address
+//	dump       prints the routes of the route file
+//	diff       prints the difference between two route files
+//	aggregate  prints the minimal routes that make the same forwarding decisions
+//	validate   checks that the route files can be loaded
+//	convert    converts the route file into another format
+//	shell      starts the interactive shell to manipulate a routing table in memory
+//
+// A route file is read from the standard input if the file is "-".
+// The input format is one of "json" (the JSON representation of iprtb.RouteTable), "text" (the route text that iprtb.ParseRoutes accepts),
+// "snapshot" (the binary snapshot of iprtb.RouteTable) and "iproute2" (the output of `ip route show`).
+// It is detected by the file extension by default; ".json" is json, ".snapshot" is snapshot, and the others are text.
+// The output format is one of "table", "text", "json", "snapshot" and "ip-batch" (the `ip -batch` script).
+//
+// The exit status is 0 on success and 2 on an error. match exits with 1 if there is an IP address that has no route,
+// diff exits with 1 if there is a difference, and validate exits with 1 if there is an invalid route file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK    = 0
+	exitFound = 1
+	exitError = 2
+)
+
+// errFound represents the error that indicates the command finished successfully but found something to report with the exit status 1,
+// e.g. an IP address that has no route on match and a difference on diff.
+var errFound = errors.New("found")
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(ctx context.Context, env *env, args []string) error
+}
+
+// env is the environment of a command execution.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = []*command{
+	matchCommand,
+	dumpCommand,
+	diffCommand,
+	aggregateCommand,
+	validateCommand,
+	convertCommand,
+	shellCommand,
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], &env{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}))
+}
+
+func run(ctx context.Context, args []string, e *env) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		printUsage(e.stderr)
+		if len(args) == 0 {
+			return exitError
+		}
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(ctx, e, args[1:])
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, errFound):
+			return exitFound
+		case errors.Is(err, flag.ErrHelp):
+			return exitOK
+		default:
+			_, _ = fmt.Fprintf(e.stderr, "iprtb %s: %s\n", cmd.name, err)
+			return exitError
+		}
+	}
+
+	_, _ = fmt.Fprintf(e.stderr, "iprtb: unknown command %q\n", args[0])
+	printUsage(e.stderr)
+	return exitError
+}
+
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "Usage: iprtb <command> [flags] [arguments]")
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, `Run "iprtb <command> -h" for the flags of each command.`)
+}
+
+func newFlagSet(cmd *command, e *env) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(e.stderr, "Usage: iprtb %s %s\n\n%s\n\nFlags:\n", cmd.name, cmd.usage, cmd.description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRoutes = `10.0.0.0/8 via 192.0.2.1 dev eth0 label core
+10.1.0.0/16 via 192.0.2.1 dev eth0
+192.0.2.0/24 dev eth1
+2001:db8::/32 dev eth2 metric 10
+`
+
+func writeTestFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func runTest(args []string, stdin string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), args, &env{
+		stdin:  strings.NewReader(stdin),
+		stdout: &stdout,
+		stderr: &stderr,
+	})
+	return status, stdout.String(), stderr.String()
+}
+
+func TestRun_Match(t *testing.T) {
+	path := writeTestFile(t, "routes.txt", testRoutes)
+
+	status, stdout, _ := runTest([]string{"match", "-f", path, "10.1.2.3", "2001:db8::1"}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, "10.1.2.3\t10.1.0.0/16\t192.0.2.1\teth0\t0\n2001:db8::1\t2001:db8::/32\t<nil>\teth2\t10\n", stdout)
+
+	status, stdout, _ = runTest([]string{"match", "198.51.100.1"}, testRoutes)
+	assert.Equal(t, exitFound, status)
+	assert.Equal(t, "198.51.100.1\tno route\n", stdout)
+
+	status, _, stderr := runTest([]string{"match", "-f", path, "invalid"}, "")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, `invalid IP address => "invalid"`)
+}
+
+func TestRun_Dump(t *testing.T) {
+	path := writeTestFile(t, "routes.txt", testRoutes)
+
+	status, stdout, _ := runTest([]string{"dump", "-f", path}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, `IPv4 routes
+Destination   Gateway    Interface  Metric  Label
+10.0.0.0/8    192.0.2.1  eth0       0       core
+10.1.0.0/16   192.0.2.1  eth0       0
+192.0.2.0/24  *          eth1       0
+
+IPv6 routes
+Destination    Gateway  Interface  Metric  Label
+2001:db8::/32  *        eth2       10
+`, stdout)
+
+	status, stdout, _ = runTest([]string{"dump", "-f", path, "-o", "ip-batch"}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stdout, "route replace 10.0.0.0/8 via 192.0.2.1 dev eth0")
+
+	status, _, stderr := runTest([]string{"dump", "-f", path, "-o", "unknown"}, "")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, `unknown output format => "unknown"`)
+}
+
+func TestRun_Convert(t *testing.T) {
+	dir := t.TempDir()
+	textPath := writeTestFile(t, "routes.txt", testRoutes)
+
+	// text -> json -> snapshot -> text
+	status, jsonOut, _ := runTest([]string{"convert", "-f", textPath, "-o", "json"}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, jsonOut, `"labels"`)
+	jsonPath := filepath.Join(dir, "routes.json")
+	assert.NoError(t, os.WriteFile(jsonPath, []byte(jsonOut), 0o600))
+
+	status, snapshotOut, _ := runTest([]string{"convert", "-f", jsonPath, "-o", "snapshot"}, "")
+	assert.Equal(t, exitOK, status)
+	snapshotPath := filepath.Join(dir, "routes.snapshot")
+	assert.NoError(t, os.WriteFile(snapshotPath, []byte(snapshotOut), 0o600))
+
+	status, textOut, _ := runTest([]string{"convert", "-f", snapshotPath, "-o", "text"}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, `10.0.0.0/8 via 192.0.2.1 dev eth0 metric 0 label core
+10.1.0.0/16 via 192.0.2.1 dev eth0 metric 0
+192.0.2.0/24 dev eth1 metric 0
+2001:db8::/32 dev eth2 metric 10
+`, textOut)
+
+	// explicit input format
+	status, _, _ = runTest([]string{"convert", "-format", "iproute2", "-o", "text"}, "default via 192.0.2.1 dev eth0\n")
+	assert.Equal(t, exitOK, status)
+
+	status, _, stderr := runTest([]string{"convert", "-f", textPath}, "")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, "the output format must be given by -o")
+}
+
+func TestRun_Diff(t *testing.T) {
+	oldPath := writeTestFile(t, "old.txt", testRoutes)
+	newPath := writeTestFile(t, "new.txt", `10.0.0.0/8 via 192.0.2.2 dev eth0
+10.1.0.0/16 via 192.0.2.1 dev eth0
+198.51.100.0/24 dev eth1
+2001:db8::/32 dev eth2 metric 10
+`)
+
+	status, stdout, _ := runTest([]string{"diff", oldPath, newPath}, "")
+	assert.Equal(t, exitFound, status)
+	assert.Equal(t, `- 192.0.2.0/24	<nil>	eth1	0
++ 198.51.100.0/24	<nil>	eth1	0
+~ 10.0.0.0/8	192.0.2.2	eth0	0
+`, stdout)
+
+	status, stdout, _ = runTest([]string{"diff", "-forwarding", oldPath, newPath}, "")
+	assert.Equal(t, exitFound, status)
+	assert.Contains(t, stdout, "192.0.2.0/24\tdev eth1 -> unreachable\n")
+	assert.Contains(t, stdout, "198.51.100.0/24\tunreachable -> dev eth1\n")
+
+	status, stdout, _ = runTest([]string{"diff", oldPath, oldPath}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Empty(t, stdout)
+
+	status, _, _ = runTest([]string{"diff", oldPath}, "")
+	assert.Equal(t, exitError, status)
+}
+
+func TestRun_Aggregate(t *testing.T) {
+	status, stdout, _ := runTest([]string{"aggregate"}, testRoutes+"192.0.2.0/25 dev eth1\n192.0.2.128/25 dev eth1\n")
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, `10.0.0.0/8 via 192.0.2.1 dev eth0 metric 0
+192.0.2.0/24 dev eth1 metric 0
+2001:db8::/32 dev eth2 metric 10
+`, stdout)
+}
+
+func TestRun_Validate(t *testing.T) {
+	validPath := writeTestFile(t, "valid.txt", testRoutes)
+	invalidPath := writeTestFile(t, "invalid.json", `{"version":1,"routes":[{"destination":"invalid"}]}`)
+
+	status, stdout, _ := runTest([]string{"validate", validPath}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, validPath+": ok (4 routes)\n", stdout)
+
+	status, stdout, stderr := runTest([]string{"validate", validPath, invalidPath}, "")
+	assert.Equal(t, exitFound, status)
+	assert.Equal(t, validPath+": ok (4 routes)\n", stdout)
+	assert.Contains(t, stderr, invalidPath+": failed to load the route file")
+}
+
+func TestRun_Usage(t *testing.T) {
+	status, _, stderr := runTest(nil, "")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, "Usage: iprtb <command>")
+
+	status, _, _ = runTest([]string{"help"}, "")
+	assert.Equal(t, exitOK, status)
+
+	status, _, stderr = runTest([]string{"match", "-h"}, "")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stderr, "Usage: iprtb match")
+
+	status, _, stderr = runTest([]string{"unknown"}, "")
+	assert.Equal(t, exitError, status)
+	assert.Contains(t, stderr, `unknown command "unknown"`)
+}
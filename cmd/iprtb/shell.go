@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/moznion/go-iprtb"
+	"github.com/moznion/go-optional"
+)
+
+const shellHelp = `Commands:
+  add <route>                    adds the route in the route text syntax, e.g. "10.0.0.0/8 via 192.0.2.1 dev eth0 metric 10 label core"
+  remove <destination>           removes the route that has the destination
+  remove label <label>           removes the route that is associated with the label
+  label                          lists the labels
+  label <label>                  prints the route that is associated with the label
+  label <label> <destination>    associates the label with the existing route
+  match <ip>...                  prints the longest matched route and the covering routes that explain why it is chosen
+  dump [format]                  prints the routes; the format is one of table (default), text, json and ip-batch
+  save <file> [format]           saves the routes to the file; the format is detected by the extension by default
+  load <file> [format]           replaces the routes with the ones of the file; the format is detected by the extension by default
+  clear                          removes all routes
+  history                        prints the command history
+  !<n>                           runs the n-th command of the history again
+  help                           prints this help
+  exit, quit                     exits the shell`
+
+// shell is the interactive shell that keeps a routing table in memory.
+type shell struct {
+	e       *env
+	rt      *iprtb.RouteTable
+	history []string
+}
+
+func runShell(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(shellCommand, e)
+	path := fs.String("f", "", "the route file to load at the start")
+	format := fs.String("format", formatAuto, inputFormatUsage())
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sh := &shell{
+		e:  e,
+		rt: iprtb.NewRouteTable(),
+	}
+	if *path != "" {
+		rt, err := loadRouteTable(ctx, e, *path, *format)
+		if err != nil {
+			return err
+		}
+		sh.rt = rt
+	}
+	return sh.run(ctx, isTerminal(e.stdin))
+}
+
+// isTerminal returns true if the reader is a terminal; the shell shows the prompt only on a terminal.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+func (sh *shell) run(ctx context.Context, interactive bool) error {
+	scanner := bufio.NewScanner(sh.e.stdin)
+	for {
+		if interactive {
+			_, _ = fmt.Fprint(sh.e.stdout, "iprtb> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(sh.history) {
+				_, _ = fmt.Fprintf(sh.e.stderr, "error: no such history => %q\n", line)
+				continue
+			}
+			line = sh.history[n-1]
+			_, _ = fmt.Fprintln(sh.e.stdout, line)
+		}
+		sh.history = append(sh.history, line)
+
+		exit, err := sh.exec(ctx, line)
+		if err != nil {
+			_, _ = fmt.Fprintf(sh.e.stderr, "error: %s\n", err)
+		}
+		if exit {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// exec executes a command line. This returns true if the shell should exit.
+func (sh *shell) exec(ctx context.Context, line string) (bool, error) {
+	args := strings.Fields(line)
+	name := args[0]
+	rest := strings.TrimSpace(strings.TrimPrefix(line, name))
+	args = args[1:]
+
+	switch name {
+	case "add":
+		return false, sh.add(ctx, rest)
+	case "remove":
+		return false, sh.remove(ctx, args)
+	case "label":
+		return false, sh.label(ctx, args)
+	case "match":
+		return false, sh.match(ctx, args)
+	case "dump":
+		format := formatTable
+		if len(args) > 0 {
+			format = args[0]
+		}
+		if format == formatSnapshot {
+			return false, errors.New("snapshot can't be dumped; please use save instead")
+		}
+		return false, writeRouteTable(ctx, sh.e.stdout, sh.rt, format)
+	case "save":
+		return false, sh.save(ctx, args)
+	case "load":
+		return false, sh.load(ctx, args)
+	case "clear":
+		sh.rt.ClearRoutes(ctx)
+		return false, nil
+	case "history":
+		for i, h := range sh.history {
+			_, _ = fmt.Fprintf(sh.e.stdout, "%5d  %s\n", i+1, h)
+		}
+		return false, nil
+	case "help":
+		_, _ = fmt.Fprintln(sh.e.stdout, shellHelp)
+		return false, nil
+	case "exit", "quit":
+		return true, nil
+	default:
+		return false, fmt.Errorf(`unknown command => %q; run "help" for the commands`, name)
+	}
+}
+
+func (sh *shell) add(ctx context.Context, routeText string) error {
+	routes, labels, err := iprtb.ParseRoutesWithLabels(strings.NewReader(routeText))
+	if err != nil {
+		return err
+	}
+	if len(routes) != 1 {
+		return errors.New("a route must be given")
+	}
+
+	route := routes[0]
+	for label := range labels { // there is at most one label for a route
+		return sh.rt.AddRouteWithLabel(ctx, label, route)
+	}
+	return sh.rt.AddRoute(ctx, route)
+}
+
+func (sh *shell) remove(ctx context.Context, args []string) error {
+	var maybeRemovedRoute optional.Option[iprtb.Route]
+	switch {
+	case len(args) == 2 && args[0] == "label":
+		var err error
+		maybeRemovedRoute, err = sh.rt.RemoveRouteByLabel(ctx, args[1])
+		if err != nil {
+			return err
+		}
+	case len(args) == 1:
+		_, destination, err := net.ParseCIDR(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid destination => %q: %w", args[0], err)
+		}
+		maybeRemovedRoute, err = sh.rt.RemoveRoute(ctx, destination)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("usage: remove <destination> | remove label <label>")
+	}
+
+	if maybeRemovedRoute.IsNone() {
+		return errors.New("no route to remove")
+	}
+	_, _ = fmt.Fprintf(sh.e.stdout, "removed %s\n", routeSpec(maybeRemovedRoute.UnwrapAsPtr(), ""))
+	return nil
+}
+
+func (sh *shell) label(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		labels := sh.rt.Labels(ctx)
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			_, _ = fmt.Fprintf(sh.e.stdout, "%s\t%s\n", name, labels[name])
+		}
+		return nil
+	case 1:
+		maybeRoute := sh.rt.GetRouteByLabel(ctx, args[0])
+		if maybeRoute.IsNone() {
+			return fmt.Errorf("no route is associated with the label => %q", args[0])
+		}
+		_, _ = fmt.Fprintln(sh.e.stdout, routeSpec(maybeRoute.UnwrapAsPtr(), args[0]))
+		return nil
+	case 2:
+		_, destination, err := net.ParseCIDR(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid destination => %q: %w", args[1], err)
+		}
+		maybeRoute, err := sh.rt.GetRoute(ctx, destination)
+		if err != nil {
+			return err
+		}
+		if maybeRoute.IsNone() {
+			return fmt.Errorf("no route has the destination => %s", destination)
+		}
+		return sh.rt.AddRouteWithLabel(ctx, args[0], maybeRoute.UnwrapAsPtr())
+	default:
+		return errors.New("usage: label [<label> [<destination>]]")
+	}
+}
+
+func (sh *shell) match(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: match <ip>...")
+	}
+
+	destination2Label := map[string]string{}
+	for label, destination := range sh.rt.Labels(ctx) {
+		destination2Label[destination.String()] = label
+	}
+
+	for _, arg := range args {
+		target := net.ParseIP(arg)
+		if target == nil {
+			return fmt.Errorf("invalid IP address => %q", arg)
+		}
+		covering, err := sh.rt.CoveringRoutes(ctx, target)
+		if err != nil {
+			return err
+		}
+		maybeMatched, err := sh.rt.MatchRoute(ctx, target)
+		if err != nil {
+			return err
+		}
+
+		// the covering routes that are longer than the matched one are skipped because their next hops or network interfaces are down
+		numOfSkipped := len(covering)
+		if maybeMatched.IsSome() {
+			matchedDestination := maybeMatched.Unwrap().Destination.String()
+			numOfSkipped = len(covering) - 1 - slices.IndexFunc(covering, func(r *iprtb.Route) bool {
+				return r.Destination.String() == matchedDestination
+			})
+		}
+
+		if maybeMatched.IsNone() {
+			if len(covering) == 0 {
+				_, _ = fmt.Fprintf(sh.e.stdout, "%s matches no route; no route covers the address\n", target)
+				continue
+			}
+			_, _ = fmt.Fprintf(sh.e.stdout, "%s matches no route; all %d routes that cover the address are skipped because their next hops or network interfaces are down:\n", target, len(covering))
+		} else {
+			matched := maybeMatched.UnwrapAsPtr()
+			_, _ = fmt.Fprintf(sh.e.stdout, "%s matches %s\n", target, routeSpec(matched, destination2Label[matched.Destination.String()]))
+			prefixLen, _ := matched.Destination.Mask.Size()
+			switch {
+			case len(covering) == 1:
+				_, _ = fmt.Fprintln(sh.e.stdout, "  the route is the only one that covers the address")
+				continue
+			case numOfSkipped == 0:
+				_, _ = fmt.Fprintf(sh.e.stdout, "  /%d is the longest prefix among the %d routes that cover the address:\n", prefixLen, len(covering))
+			default:
+				_, _ = fmt.Fprintf(sh.e.stdout, "  /%d is the longest prefix among the %d routes that cover the address, except the %d routes that are skipped because their next hops or network interfaces are down (marked with -):\n",
+					prefixLen, len(covering), numOfSkipped)
+			}
+		}
+		for i, r := range covering {
+			mark := " "
+			switch {
+			case i >= len(covering)-numOfSkipped:
+				mark = "-"
+			case i == len(covering)-numOfSkipped-1:
+				mark = "*"
+			}
+			_, _ = fmt.Fprintf(sh.e.stdout, "  %s %s\n", mark, routeSpec(r, destination2Label[r.Destination.String()]))
+		}
+	}
+	return nil
+}
+
+func (sh *shell) save(ctx context.Context, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: save <file> [format]")
+	}
+	format := detectFormat(args[0])
+	if len(args) == 2 {
+		format = args[1]
+	}
+
+	if !slices.Contains(outputFormats, format) {
+		return fmt.Errorf("unknown output format => %q; %s", format, outputFormatUsage())
+	}
+
+	// write the routes to a temporary file and rename it, so that a failed write doesn't destroy the existing file
+	f, err := os.CreateTemp(filepath.Dir(args[0]), filepath.Base(args[0])+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create the route file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name()) // this fails after the rename, and that is expected
+	}()
+	if err := f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to change the mode of the route file: %w", err)
+	}
+	if err := writeRouteTable(ctx, f, sh.rt, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close the route file: %w", err)
+	}
+	if err := os.Rename(f.Name(), args[0]); err != nil {
+		return fmt.Errorf("failed to replace the route file: %w", err)
+	}
+	_, _ = fmt.Fprintf(sh.e.stdout, "saved %d routes to %s\n", sh.rt.Len(ctx), args[0])
+	return nil
+}
+
+func (sh *shell) load(ctx context.Context, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: load <file> [format]")
+	}
+	if args[0] == "-" {
+		return errors.New("the shell can't load the routes from the standard input")
+	}
+	format := formatAuto
+	if len(args) == 2 {
+		format = args[1]
+	}
+
+	rt, err := loadRouteTable(ctx, sh.e, args[0], format)
+	if err != nil {
+		return err
+	}
+	sh.rt = rt
+	_, _ = fmt.Fprintf(sh.e.stdout, "loaded %d routes from %s\n", rt.Len(ctx), args[0])
+	return nil
+}
+
+// routeSpec returns the route like "10.0.0.0/8 via 192.0.2.1 dev eth0 metric 10 label core".
+func routeSpec(route *iprtb.Route, label string) string {
+	spec := fmt.Sprintf("%s %s metric %d", route.Destination, nextHopText(route), route.Metric)
+	if label != "" {
+		spec += " label " + label
+	}
+	return spec
+}
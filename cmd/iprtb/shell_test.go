@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moznion/go-iprtb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Shell(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "saved.json")
+
+	status, stdout, stderr := runTest([]string{"shell"}, `
+# comment
+add default via 192.0.2.1 dev eth0
+add 10.0.0.0/8 via 192.0.2.2 dev eth0 label core
+add 10.1.0.0/16 via 192.0.2.3 dev eth0
+add 198.51.100.0/24 dev eth1
+match 10.1.2.3 10.2.0.1
+label edge 198.51.100.0/24
+label
+label core
+remove 10.1.0.0/16
+remove label edge
+dump text
+save `+savePath+`
+clear
+dump text
+load `+savePath+`
+!5
+history
+exit
+dump
+`)
+	assert.Equal(t, exitOK, status)
+	assert.Empty(t, stderr)
+	assert.Equal(t, `10.1.2.3 matches 10.1.0.0/16 via 192.0.2.3 dev eth0 metric 0
+  /16 is the longest prefix among the 3 routes that cover the address:
+    0.0.0.0/0 via 192.0.2.1 dev eth0 metric 0
+    10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+  * 10.1.0.0/16 via 192.0.2.3 dev eth0 metric 0
+10.2.0.1 matches 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+  /8 is the longest prefix among the 2 routes that cover the address:
+    0.0.0.0/0 via 192.0.2.1 dev eth0 metric 0
+  * 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+core	10.0.0.0/8
+edge	198.51.100.0/24
+10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+removed 10.1.0.0/16 via 192.0.2.3 dev eth0 metric 0
+removed 198.51.100.0/24 dev eth1 metric 0
+0.0.0.0/0 via 192.0.2.1 dev eth0 metric 0
+10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+saved 2 routes to `+savePath+`
+loaded 2 routes from `+savePath+`
+match 10.1.2.3 10.2.0.1
+10.1.2.3 matches 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+  /8 is the longest prefix among the 2 routes that cover the address:
+    0.0.0.0/0 via 192.0.2.1 dev eth0 metric 0
+  * 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+10.2.0.1 matches 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+  /8 is the longest prefix among the 2 routes that cover the address:
+    0.0.0.0/0 via 192.0.2.1 dev eth0 metric 0
+  * 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0 label core
+    1  add default via 192.0.2.1 dev eth0
+    2  add 10.0.0.0/8 via 192.0.2.2 dev eth0 label core
+    3  add 10.1.0.0/16 via 192.0.2.3 dev eth0
+    4  add 198.51.100.0/24 dev eth1
+    5  match 10.1.2.3 10.2.0.1
+    6  label edge 198.51.100.0/24
+    7  label
+    8  label core
+    9  remove 10.1.0.0/16
+   10  remove label edge
+   11  dump text
+   12  save `+savePath+`
+   13  clear
+   14  dump text
+   15  load `+savePath+`
+   16  match 10.1.2.3 10.2.0.1
+   17  history
+`, stdout)
+}
+
+func TestRun_Shell_Errors(t *testing.T) {
+	path := writeTestFile(t, "routes.txt", testRoutes)
+
+	status, stdout, stderr := runTest([]string{"shell", "-f", path}, `match 198.51.100.1 192.0.2.1
+unknown
+add invalid
+remove 198.51.100.0/24
+label unknown
+label core 198.51.100.0/24
+match invalid
+load -
+!100
+`)
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, `198.51.100.1 matches no route; no route covers the address
+192.0.2.1 matches 192.0.2.0/24 dev eth1 metric 0
+  the route is the only one that covers the address
+`, stdout)
+	assert.Equal(t, `error: unknown command => "unknown"; run "help" for the commands
+error: failed to parse routes at line 1: invalid destination => "invalid": invalid syntax of route
+error: no route to remove
+error: no route is associated with the label => "unknown"
+error: no route has the destination => 198.51.100.0/24
+error: invalid IP address => "invalid"
+error: the shell can't load the routes from the standard input
+error: no such history => "!100"
+`, stderr)
+
+	status, _, _ = runTest([]string{"shell", "-f", filepath.Join(t.TempDir(), "missing.txt")}, "")
+	assert.Equal(t, exitError, status)
+}
+
+func TestShell_Save(t *testing.T) {
+	path := writeTestFile(t, "routes.txt", testRoutes)
+	savePath := writeTestFile(t, "saved.txt", "10.0.0.0/8 via 192.0.2.1 dev eth0\n")
+
+	// the command can be followed by a tab, and the failed save keeps the existing file
+	status, stdout, stderr := runTest([]string{"shell", "-f", path}, "save\t"+savePath+" bogus\nsave "+filepath.Join(t.TempDir(), "missing", "saved.txt")+"\n")
+	assert.Equal(t, exitOK, status)
+	assert.Empty(t, stdout)
+	assert.True(t, strings.HasPrefix(stderr, `error: unknown output format => "bogus"`), stderr)
+	assert.Contains(t, stderr, "error: failed to create the route file")
+	saved, err := os.ReadFile(savePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8 via 192.0.2.1 dev eth0\n", string(saved))
+
+	status, stdout, stderr = runTest([]string{"shell", "-f", path}, "save "+savePath+"\n")
+	assert.Equal(t, exitOK, status)
+	assert.Empty(t, stderr)
+	assert.Equal(t, "saved 4 routes to "+savePath+"\n", stdout)
+	saved, err = os.ReadFile(savePath)
+	assert.NoError(t, err)
+	assert.Equal(t, `10.0.0.0/8 via 192.0.2.1 dev eth0 metric 0 label core
+10.1.0.0/16 via 192.0.2.1 dev eth0 metric 0
+192.0.2.0/24 dev eth1 metric 0
+2001:db8::/32 dev eth2 metric 10
+`, string(saved))
+	entries, err := os.ReadDir(filepath.Dir(savePath))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1) // the temporary file doesn't remain
+}
+
+func TestShell_MatchWithDownNextHops(t *testing.T) {
+	ctx := context.Background()
+
+	rt := iprtb.NewRouteTable()
+	assert.NoError(t, rt.LoadRoutes(ctx, strings.NewReader(`default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth0
+10.1.0.0/16 via 192.0.2.3 dev eth0
+10.1.2.0/24 via 192.0.2.3 dev eth0
+`)))
+	rt.SetNextHopState(ctx, net.IPv4(192, 0, 2, 3), iprtb.NextHopDown)
+
+	var stdout bytes.Buffer
+	sh := &shell{
+		e:  &env{stdout: &stdout},
+		rt: rt,
+	}
+	assert.NoError(t, sh.match(ctx, []string{"10.1.2.3"}))
+
+	rt.SetNextHopState(ctx, net.IPv4(192, 0, 2, 2), iprtb.NextHopDown)
+	rt.SetNextHopState(ctx, net.IPv4(192, 0, 2, 1), iprtb.NextHopDown)
+	assert.NoError(t, sh.match(ctx, []string{"10.1.2.3"}))
+
+	assert.Equal(t, `10.1.2.3 matches 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0
+  /8 is the longest prefix among the 4 routes that cover the address, except the 2 routes that are skipped because their next hops or network interfaces are down (marked with -):
+    0.0.0.0/0 via 192.0.2.1 dev eth0 metric 0
+  * 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0
+  - 10.1.0.0/16 via 192.0.2.3 dev eth0 metric 0
+  - 10.1.2.0/24 via 192.0.2.3 dev eth0 metric 0
+10.1.2.3 matches no route; all 4 routes that cover the address are skipped because their next hops or network interfaces are down:
+  - 0.0.0.0/0 via 192.0.2.1 dev eth0 metric 0
+  - 10.0.0.0/8 via 192.0.2.2 dev eth0 metric 0
+  - 10.1.0.0/16 via 192.0.2.3 dev eth0 metric 0
+  - 10.1.2.0/24 via 192.0.2.3 dev eth0 metric 0
+`, stdout.String())
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	assert.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	assert.False(t, isTerminal(f))
+	assert.False(t, isTerminal(nil))
+}
@@ -0,0 +1,81 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+)
+
+// Diff represents the route-level difference between two sets of routes.
+//
+// Added has the routes whose destinations exist only on the new side, Updated has the new routes whose destinations
+// exist on both sides but the route information (i.e. gateway, network interface and metric) differs,
+// and Removed has the routes whose destinations exist only on the old side.
+// UpdatedFrom has the old routes that are updated; UpdatedFrom[i] is the old side of Updated[i].
+type Diff struct {
+	Added       Routes
+	Updated     Routes
+	UpdatedFrom Routes
+	Removed     Routes
+}
+
+// IsEmpty returns true if the diff has no changes.
+func (d *Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Updated) == 0 && len(d.Removed) == 0
+}
+
+// DiffRouteTables compares the routes of two routing tables and returns the route-level difference from oldTable to newTable.
+// If you'd like to know how the forwarding decisions change instead, please use DiffForwarding.
+func DiffRouteTables(ctx context.Context, oldTable *RouteTable, newTable *RouteTable) *Diff {
+	return diffRoutes(oldTable.DumpRouteTable(ctx), newTable.DumpRouteTable(ctx))
+}
+
+func diffRoutes(oldRoutes Routes, newRoutes Routes) *Diff {
+	diff := &Diff{
+		Added:       Routes{},
+		Updated:     Routes{},
+		UpdatedFrom: Routes{},
+		Removed:     Routes{},
+	}
+
+	key2OldRoute := make(map[string]*Route, len(oldRoutes))
+	for _, r := range oldRoutes {
+		key2OldRoute[destinationKey(r.Destination)] = r
+	}
+
+	newKeys := make(map[string]struct{}, len(newRoutes))
+	for _, r := range newRoutes {
+		key := destinationKey(r.Destination)
+		newKeys[key] = struct{}{}
+
+		oldRoute, ok := key2OldRoute[key]
+		if !ok {
+			diff.Added = append(diff.Added, r)
+			continue
+		}
+		if !isSameRoute(oldRoute, r) {
+			diff.Updated = append(diff.Updated, r)
+			diff.UpdatedFrom = append(diff.UpdatedFrom, oldRoute)
+		}
+	}
+
+	for _, r := range oldRoutes {
+		if _, ok := newKeys[destinationKey(r.Destination)]; !ok {
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+
+	return diff
+}
+
+// destinationKey returns the canonical string representation of the destination, so the host bits of the destination
+// address don't affect the identity of the route.
+func destinationKey(destination *net.IPNet) string {
+	return (&net.IPNet{
+		IP:   canonicalDestinationIP(destination),
+		Mask: destination.Mask,
+	}).String()
+}
+
+func isSameRoute(a *Route, b *Route) bool {
+	return a.Gateway.Equal(b.Gateway) && a.NetworkInterface == b.NetworkInterface && a.Metric == b.Metric
+}
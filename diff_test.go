@@ -0,0 +1,80 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRouteTables(t *testing.T) {
+	ctx := context.Background()
+
+	keptRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	removedRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(198, 51, 100, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(198, 51, 100, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	oldRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(203, 0, 113, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(203, 0, 113, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	updatedRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(203, 0, 113, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(203, 0, 113, 1),
+		NetworkInterface: "ifb0",
+		Metric:           2,
+	}
+	addedRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 128),
+			Mask: net.IPv4Mask(255, 255, 255, 128),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+
+	oldTable := NewRouteTable()
+	for _, r := range []*Route{keptRoute, removedRoute, oldRoute} {
+		err := oldTable.AddRoute(ctx, r)
+		assert.NoError(t, err)
+	}
+
+	newTable := NewRouteTable()
+	for _, r := range []*Route{keptRoute, updatedRoute, addedRoute} {
+		err := newTable.AddRoute(ctx, r)
+		assert.NoError(t, err)
+	}
+
+	diff := DiffRouteTables(ctx, oldTable, newTable)
+	assert.False(t, diff.IsEmpty())
+	assert.Equal(t, Routes{addedRoute}, diff.Added)
+	assert.Equal(t, Routes{updatedRoute}, diff.Updated)
+	assert.Equal(t, Routes{oldRoute}, diff.UpdatedFrom)
+	assert.Equal(t, Routes{removedRoute}, diff.Removed)
+
+	assert.True(t, DiffRouteTables(ctx, oldTable, oldTable).IsEmpty())
+}
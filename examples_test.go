@@ -332,10 +332,10 @@ func ExampleRouteTable_DumpRouteTable() {
 	fmt.Println(dumped)
 
 	// Output:
-	// 2001:db8::ff/128	2001:db8::ff	ifb0	1
-	// 2001:db8::/32	2001:db8::1	ifb0	1
-	// 192.0.2.255/32	192.0.2.255	ifb0	1
 	// 192.0.2.0/24	192.0.2.1	ifb0	1
+	// 192.0.2.255/32	192.0.2.255	ifb0	1
+	// 2001:db8::/32	2001:db8::1	ifb0	1
+	// 2001:db8::ff/128	2001:db8::ff	ifb0	1
 }
 
 func ExampleRouteTable_ClearRoutes() {
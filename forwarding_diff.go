@@ -0,0 +1,153 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+
+	"github.com/moznion/go-optional"
+)
+
+// ForwardingChange represents an address range whose forwarding decision differs between two routing tables.
+//
+// OldRoute and NewRoute are the routes that MatchRoute returns for every address in Range on each table.
+// `None` means there is no route for that range on the table.
+type ForwardingChange struct {
+	Range    *net.IPNet
+	OldRoute optional.Option[Route]
+	NewRoute optional.Option[Route]
+}
+
+// DiffForwarding compares the forwarding decisions of two routing tables and returns the address ranges that are
+// forwarded differently on newTable compared to oldTable.
+//
+// Two routes are regarded as the same forwarding decision when they have the same gateway and network interface,
+// so adding a more specific route that has the same next hop as the covering route is not reported as a change.
+// The result is ordered by address family (IPv4 first) and address, and the adjacent ranges that have the same
+// old and new routes are merged into a single range.
+//
+// The routes that MatchRoute skips because their next hops or network interfaces are marked as down are skipped as well,
+// and the route at the root of the prefix tree (i.e. the default route) is regarded as the route of both address families
+// as well as MatchRoute. The other routes are considered only for the ranges of their own address family.
+func DiffForwarding(ctx context.Context, oldTable *RouteTable, newTable *RouteTable) []*ForwardingChange {
+	// this copies the prefix trees one by one instead of holding the locks of both tables together,
+	// because that can deadlock with the concurrent call that has the swapped arguments and the waiting writers
+	oldRoot := oldTable.clonePrefixTree()
+	newRoot := newTable.clonePrefixTree()
+
+	changes := make([]*ForwardingChange, 0)
+	for _, ipLen := range []int{net.IPv4len, net.IPv6len} {
+		diffs := diffForwardingNode(oldRoot, newRoot, nil, nil, make(net.IP, ipLen), 0)
+		for _, d := range diffs {
+			changes = append(changes, &ForwardingChange{
+				Range: &net.IPNet{
+					IP:   d.ip,
+					Mask: net.CIDRMask(d.prefixLen, ipLen*8),
+				},
+				OldRoute: optional.FromNillable[Route](d.oldRoute),
+				NewRoute: optional.FromNillable[Route](d.newRoute),
+			})
+		}
+	}
+	return changes
+}
+
+// clonePrefixTree returns a copy of the prefix tree that has only the usable routes for matching under the lock.
+// The routes are shared because they are never mutated in place.
+func (rt *RouteTable) clonePrefixTree() *node {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.cloneNode(rt.routes)
+}
+
+func (rt *RouteTable) cloneNode(n *node) *node {
+	if n == nil {
+		return nil
+	}
+	cloned := &node{
+		zeroBitNode: rt.cloneNode(n.zeroBitNode),
+		oneBitNode:  rt.cloneNode(n.oneBitNode),
+	}
+	if n.route != nil && rt.isRouteUsable(n.route) {
+		cloned.route = n.route
+	}
+	return cloned
+}
+
+type forwardingDiff struct {
+	ip        net.IP
+	prefixLen int
+	oldRoute  *Route
+	newRoute  *Route
+}
+
+func diffForwardingNode(oldNode *node, newNode *node, oldRoute *Route, newRoute *Route, ip net.IP, depth int) []*forwardingDiff {
+	ipLen := len(ip)
+	if oldNode != nil && oldNode.route != nil && (depth == 0 || isSameFamilyRoute(oldNode.route, ipLen)) {
+		oldRoute = oldNode.route
+	}
+	if newNode != nil && newNode.route != nil && (depth == 0 || isSameFamilyRoute(newNode.route, ipLen)) {
+		newRoute = newNode.route
+	}
+
+	oldZero, oldOne := childNodes(oldNode)
+	newZero, newOne := childNodes(newNode)
+	if depth >= ipLen*8 || (oldZero == nil && oldOne == nil && newZero == nil && newOne == nil) {
+		// there are no more specific routes on both tables; the whole range under this node is forwarded by the inherited routes
+		if isSameForwarding(oldRoute, newRoute) {
+			return nil
+		}
+		return []*forwardingDiff{
+			{
+				ip:        ip,
+				prefixLen: depth,
+				oldRoute:  oldRoute,
+				newRoute:  newRoute,
+			},
+		}
+	}
+
+	zeroBitIP := make(net.IP, ipLen)
+	copy(zeroBitIP, ip)
+	oneBitIP := make(net.IP, ipLen)
+	copy(oneBitIP, ip)
+	oneBitIP[depth/8] |= 0b10000000 >> (depth % 8)
+
+	zeroBitDiffs := diffForwardingNode(oldZero, newZero, oldRoute, newRoute, zeroBitIP, depth+1)
+	oneBitDiffs := diffForwardingNode(oldOne, newOne, oldRoute, newRoute, oneBitIP, depth+1)
+
+	if len(zeroBitDiffs) == 1 && len(oneBitDiffs) == 1 {
+		zd, od := zeroBitDiffs[0], oneBitDiffs[0]
+		if zd.prefixLen == depth+1 && od.prefixLen == depth+1 && zd.oldRoute == od.oldRoute && zd.newRoute == od.newRoute {
+			// both halves changed in the same way; merge them into this node's range
+			return []*forwardingDiff{
+				{
+					ip:        ip,
+					prefixLen: depth,
+					oldRoute:  zd.oldRoute,
+					newRoute:  zd.newRoute,
+				},
+			}
+		}
+	}
+
+	return append(zeroBitDiffs, oneBitDiffs...)
+}
+
+func childNodes(n *node) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	return n.zeroBitNode, n.oneBitNode
+}
+
+func isSameFamilyRoute(route *Route, ipLen int) bool {
+	isIPv4 := route.Destination.IP.To4() != nil
+	return isIPv4 == (ipLen == net.IPv4len)
+}
+
+func isSameForwarding(a *Route, b *Route) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Gateway.Equal(b.Gateway) && a.NetworkInterface == b.NetworkInterface
+}
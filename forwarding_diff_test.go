@@ -0,0 +1,225 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffForwarding(t *testing.T) {
+	ctx := context.Background()
+
+	route24 := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+
+	oldTable := NewRouteTable()
+	err := oldTable.AddRoute(ctx, route24)
+	assert.NoError(t, err)
+
+	newTable := NewRouteTable()
+	err = newTable.AddRoute(ctx, route24)
+	assert.NoError(t, err)
+
+	assert.Empty(t, DiffForwarding(ctx, oldTable, newTable))
+
+	// a more specific route that has the same next hop doesn't change the forwarding
+	err = newTable.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 128),
+			Mask: net.IPv4Mask(255, 255, 255, 255),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           10,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, DiffForwarding(ctx, oldTable, newTable))
+
+	// a more specific route that has the different next hop changes only its range
+	route25 := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 128),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 2),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	err = newTable.AddRoute(ctx, route25)
+	assert.NoError(t, err)
+
+	changes := DiffForwarding(ctx, oldTable, newTable)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "192.0.2.0/25", changes[0].Range.String())
+	assert.Equal(t, route24, changes[0].OldRoute.UnwrapAsPtr())
+	assert.Equal(t, route25, changes[0].NewRoute.UnwrapAsPtr())
+
+	// the reverse direction
+	changes = DiffForwarding(ctx, newTable, oldTable)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "192.0.2.0/25", changes[0].Range.String())
+	assert.Equal(t, route25, changes[0].OldRoute.UnwrapAsPtr())
+	assert.Equal(t, route24, changes[0].NewRoute.UnwrapAsPtr())
+}
+
+func TestDiffForwarding_AddedAndRemovedRoutes(t *testing.T) {
+	ctx := context.Background()
+
+	ipv4Route := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	ipv6Route := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		Gateway:          net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+
+	oldTable := NewRouteTable()
+	err := oldTable.AddRoute(ctx, ipv4Route)
+	assert.NoError(t, err)
+
+	newTable := NewRouteTable()
+	err = newTable.AddRoute(ctx, ipv6Route)
+	assert.NoError(t, err)
+
+	changes := DiffForwarding(ctx, oldTable, newTable)
+	assert.Len(t, changes, 2)
+
+	assert.Equal(t, "192.0.2.0/24", changes[0].Range.String())
+	assert.Equal(t, ipv4Route, changes[0].OldRoute.UnwrapAsPtr())
+	assert.True(t, changes[0].NewRoute.IsNone())
+
+	assert.Equal(t, "2001:db8::/32", changes[1].Range.String())
+	assert.True(t, changes[1].OldRoute.IsNone())
+	assert.Equal(t, ipv6Route, changes[1].NewRoute.UnwrapAsPtr())
+}
+
+func TestDiffForwarding_DefaultRoute(t *testing.T) {
+	ctx := context.Background()
+
+	defaultRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(0, 0, 0, 0),
+			Mask: net.IPv4Mask(0, 0, 0, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+
+	oldTable := NewRouteTable()
+	err := oldTable.AddRoute(ctx, defaultRoute)
+	assert.NoError(t, err)
+
+	newTable := NewRouteTable()
+	err = newTable.AddRoute(ctx, defaultRoute)
+	assert.NoError(t, err)
+	err = newTable.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, DiffForwarding(ctx, oldTable, newTable))
+
+	// the default route at the root of the prefix tree is matched for both address families as well as MatchRoute
+	changes := DiffForwarding(ctx, oldTable, NewRouteTable())
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "0.0.0.0/0", changes[0].Range.String())
+	assert.Equal(t, defaultRoute, changes[0].OldRoute.UnwrapAsPtr())
+	assert.True(t, changes[0].NewRoute.IsNone())
+	assert.Equal(t, "::/0", changes[1].Range.String())
+	assert.Equal(t, defaultRoute, changes[1].OldRoute.UnwrapAsPtr())
+	assert.True(t, changes[1].NewRoute.IsNone())
+	maybeMatchedRoute, err := oldTable.MatchRoute(ctx, net.ParseIP("2001:db8::1"))
+	assert.NoError(t, err)
+	assert.Equal(t, defaultRoute, maybeMatchedRoute.UnwrapAsPtr())
+}
+
+func TestDiffForwarding_DownNextHopsAndInterfaces(t *testing.T) {
+	ctx := context.Background()
+
+	oldTable := newTestRouteTable(t, `10.0.0.0/8 via 192.0.2.1 dev eth0
+10.1.0.0/16 via 192.0.2.2 dev eth0
+10.2.0.0/16 dev eth1
+`)
+	newTable := newTestRouteTable(t, `10.0.0.0/8 via 192.0.2.1 dev eth0
+10.1.0.0/16 via 192.0.2.2 dev eth0
+10.2.0.0/16 dev eth1
+`)
+	assert.Empty(t, DiffForwarding(ctx, oldTable, newTable))
+
+	// the skipped routes fall back to the covering route as well as MatchRoute
+	newTable.SetNextHopState(ctx, net.IPv4(192, 0, 2, 2), NextHopDown)
+	newTable.SetInterfaceState(ctx, "eth1", InterfaceDown)
+	changes := DiffForwarding(ctx, oldTable, newTable)
+	assert.Len(t, changes, 2)
+	for _, change := range changes {
+		maybeMatchedRoute, err := newTable.MatchRoute(ctx, change.Range.IP)
+		assert.NoError(t, err)
+		assert.Equal(t, maybeMatchedRoute, change.NewRoute)
+	}
+	assert.Equal(t, "10.1.0.0/16", changes[0].Range.String())
+	assert.Equal(t, "192.0.2.2", changes[0].OldRoute.Unwrap().Gateway.String())
+	assert.Equal(t, "192.0.2.1", changes[0].NewRoute.Unwrap().Gateway.String())
+	assert.Equal(t, "10.2.0.0/16", changes[1].Range.String())
+	assert.Equal(t, "eth1", changes[1].OldRoute.Unwrap().NetworkInterface)
+	assert.Equal(t, "192.0.2.1", changes[1].NewRoute.Unwrap().Gateway.String())
+
+	newTable.SetNextHopState(ctx, net.IPv4(192, 0, 2, 2), NextHopUp)
+	newTable.SetInterfaceState(ctx, "eth1", InterfaceUp)
+	assert.Empty(t, DiffForwarding(ctx, oldTable, newTable))
+}
+
+func TestDiffForwarding_ConcurrentSwappedArguments(t *testing.T) {
+	ctx := context.Background()
+
+	tables := []*RouteTable{NewRouteTable(), NewRouteTable()}
+	for _, rtb := range tables {
+		assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader("10.0.0.0/8 via 192.0.2.1 dev eth0\n")))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				// the calls that have the swapped arguments and the writers mustn't deadlock
+				_ = DiffForwarding(ctx, tables[i%2], tables[(i+1)%2])
+				assert.NoError(t, tables[i%2].AddRoute(ctx, &Route{
+					Destination:      &net.IPNet{IP: net.IPv4(10, byte(j), 0, 0), Mask: net.CIDRMask(16, 32)},
+					NetworkInterface: "eth1",
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, DiffForwarding(ctx, tables[0], tables[1]))
+}
@@ -0,0 +1,141 @@
+package iprtb
+
+import (
+	"bufio"
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RouteHitCount is the number of matches of a route.
+type RouteHitCount struct {
+	Route Route
+	// Label is the label of the route. This is empty if the route doesn't have a label.
+	Label string
+	Hits  uint64
+}
+
+// HitCounters is the snapshot of the hit counters of the routing table.
+type HitCounters struct {
+	// Routes has the hit counters of all routes, which are ordered by the address family (IPv4 comes first), the destination address, and the prefix length.
+	Routes []*RouteHitCount
+	// Misses is the number of lookups that didn't match any route.
+	Misses uint64
+}
+
+// EnableHitCounters enables or disables the hit counters; MatchRoute counts up the hit counter of the matched route,
+// or the miss counter if there is no matched route, while the hit counters are enabled. The hit counters are disabled by default.
+//
+// The hit counter of a route is kept while the route is updated, and it is reset when the route is removed.
+// The hit counters are not serialized, so unmarshalling JSON or reading a snapshot resets them.
+func (rt *RouteTable) EnableHitCounters(ctx context.Context, enabled bool) {
+	rt.hitCounting.Store(enabled)
+}
+
+// HitCounters returns the snapshot of the hit counters.
+func (rt *RouteTable) HitCounters(ctx context.Context) *HitCounters {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	key2Label := rt.destinationKey2Label()
+	routeHitCounts := []*RouteHitCount{}
+	walkNodes(rt.routes, func(n *node) {
+		if n.route == nil {
+			return
+		}
+		routeHitCounts = append(routeHitCounts, &RouteHitCount{
+			Route: *n.route,
+			Label: key2Label[destinationKey(n.route.Destination)],
+			Hits:  n.hits.Load(),
+		})
+	})
+
+	slices.SortFunc(routeHitCounts, func(a *RouteHitCount, b *RouteHitCount) int {
+		return compareRoutes(&a.Route, &b.Route)
+	})
+
+	return &HitCounters{
+		Routes: routeHitCounts,
+		Misses: rt.misses.Load(),
+	}
+}
+
+// ResetHitCounters resets the hit counters of all routes and the miss counter to zero.
+func (rt *RouteTable) ResetHitCounters(ctx context.Context) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	walkNodes(rt.routes, func(n *node) {
+		n.hits.Store(0)
+	})
+	rt.misses.Store(0)
+}
+
+// HitCountersVar returns an expvar.Var that exposes the hit counters as a JSON object like
+// `{"routes": {"192.0.2.0/24": {"label": "core", "hits": 10}}, "misses": 1}`.
+// Please publish the returned value by expvar.Publish with an arbitrary name.
+func (rt *RouteTable) HitCountersVar() expvar.Var {
+	return expvar.Func(func() any {
+		counters := rt.HitCounters(context.Background())
+
+		type routeHits struct {
+			Label string `json:"label,omitempty"`
+			Hits  uint64 `json:"hits"`
+		}
+		routes := make(map[string]*routeHits, len(counters.Routes))
+		for _, c := range counters.Routes {
+			routes[c.Route.Destination.String()] = &routeHits{
+				Label: c.Label,
+				Hits:  c.Hits,
+			}
+		}
+		return map[string]any{
+			"routes": routes,
+			"misses": counters.Misses,
+		}
+	})
+}
+
+// WritePrometheus writes the hit counters in the Prometheus text exposition format.
+// The hit counters of the routes are written as "iprtb_route_hits_total" metric that has "destination" and "label" labels,
+// and the miss counter is written as "iprtb_route_misses_total" metric.
+func (c *HitCounters) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString("# HELP iprtb_route_hits_total The number of lookups that matched the route.\n")
+	_, _ = bw.WriteString("# TYPE iprtb_route_hits_total counter\n")
+	for _, r := range c.Routes {
+		_, _ = fmt.Fprintf(bw, "iprtb_route_hits_total{destination=\"%s\",label=\"%s\"} %s\n",
+			escapePrometheusLabelValue(r.Route.Destination.String()),
+			escapePrometheusLabelValue(r.Label),
+			strconv.FormatUint(r.Hits, 10),
+		)
+	}
+	_, _ = bw.WriteString("# HELP iprtb_route_misses_total The number of lookups that didn't match any route.\n")
+	_, _ = bw.WriteString("# TYPE iprtb_route_misses_total counter\n")
+	_, _ = bw.WriteString("iprtb_route_misses_total " + strconv.FormatUint(c.Misses, 10) + "\n")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write the hit counters: %w", err)
+	}
+	return nil
+}
+
+var prometheusLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePrometheusLabelValue(s string) string {
+	return prometheusLabelValueEscaper.Replace(s)
+}
+
+// walkNodes visits all nodes of the prefix tree in pre-order.
+func walkNodes(visitNode *node, f func(n *node)) {
+	f(visitNode)
+	if visitNode.zeroBitNode != nil {
+		walkNodes(visitNode.zeroBitNode, f)
+	}
+	if visitNode.oneBitNode != nil {
+		walkNodes(visitNode.oneBitNode, f)
+	}
+}
@@ -0,0 +1,129 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const hitCountersTestRoutes = `192.0.2.0/24 via 192.0.2.1 dev ifb0 label "core \"a\""
+192.0.2.255/32 dev ifb0
+`
+
+func TestRouteTable_HitCounters(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, hitCountersTestRoutes)
+
+	// disabled by default
+	_, err := rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 1))
+	assert.NoError(t, err)
+	counters := rtb.HitCounters(ctx)
+	assert.Len(t, counters.Routes, 2)
+	assert.Equal(t, uint64(0), counters.Routes[0].Hits)
+
+	rtb.EnableHitCounters(ctx, true)
+	for _, target := range []net.IP{
+		net.IPv4(192, 0, 2, 1),
+		net.IPv4(192, 0, 2, 2),
+		net.IPv4(192, 0, 2, 255),
+		net.IPv4(198, 51, 100, 1),
+	} {
+		_, err := rtb.MatchRoute(ctx, target)
+		assert.NoError(t, err)
+	}
+	// FindRoute doesn't count up
+	_, err = rtb.FindRoute(ctx, net.IPv4(192, 0, 2, 1))
+	assert.NoError(t, err)
+
+	counters = rtb.HitCounters(ctx)
+	assert.Equal(t, "192.0.2.0/24", counters.Routes[0].Route.Destination.String())
+	assert.Equal(t, `core "a"`, counters.Routes[0].Label)
+	assert.Equal(t, uint64(2), counters.Routes[0].Hits)
+	assert.Equal(t, "192.0.2.255/32", counters.Routes[1].Route.Destination.String())
+	assert.Equal(t, "", counters.Routes[1].Label)
+	assert.Equal(t, uint64(1), counters.Routes[1].Hits)
+	assert.Equal(t, uint64(1), counters.Misses)
+
+	// updating keeps the counter, removing resets the counter
+	err = rtb.UpdateRouteByLabel(ctx, `core "a"`, net.IPv4(192, 0, 2, 2), "ifb0", 1)
+	assert.NoError(t, err)
+	_, err = rtb.RemoveRoute(ctx, &net.IPNet{
+		IP:   net.IPv4(192, 0, 2, 255),
+		Mask: net.IPv4Mask(255, 255, 255, 255),
+	})
+	assert.NoError(t, err)
+	err = rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 255),
+			Mask: net.IPv4Mask(255, 255, 255, 255),
+		},
+		NetworkInterface: "ifb0",
+	})
+	assert.NoError(t, err)
+
+	counters = rtb.HitCounters(ctx)
+	assert.Equal(t, uint64(2), counters.Routes[0].Hits)
+	assert.Equal(t, uint64(0), counters.Routes[1].Hits)
+
+	rtb.ResetHitCounters(ctx)
+	counters = rtb.HitCounters(ctx)
+	assert.Equal(t, uint64(0), counters.Routes[0].Hits)
+	assert.Equal(t, uint64(0), counters.Misses)
+
+	rtb.EnableHitCounters(ctx, false)
+	_, err = rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), rtb.HitCounters(ctx).Misses)
+}
+
+func TestHitCounters_WritePrometheus(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, hitCountersTestRoutes)
+	rtb.EnableHitCounters(ctx, true)
+
+	_, err := rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 1))
+	assert.NoError(t, err)
+	_, err = rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = rtb.HitCounters(ctx).WritePrometheus(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP iprtb_route_hits_total The number of lookups that matched the route.
+# TYPE iprtb_route_hits_total counter
+iprtb_route_hits_total{destination="192.0.2.0/24",label="core \"a\""} 1
+iprtb_route_hits_total{destination="192.0.2.255/32",label=""} 0
+# HELP iprtb_route_misses_total The number of lookups that didn't match any route.
+# TYPE iprtb_route_misses_total counter
+iprtb_route_misses_total 1
+`, buf.String())
+}
+
+func TestRouteTable_HitCountersVar(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, hitCountersTestRoutes)
+	rtb.EnableHitCounters(ctx, true)
+
+	_, err := rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 255))
+	assert.NoError(t, err)
+
+	var decoded map[string]any
+	err = json.Unmarshal([]byte(rtb.HitCountersVar().String()), &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"routes": map[string]any{
+			"192.0.2.0/24": map[string]any{
+				"label": `core "a"`,
+				"hits":  float64(0),
+			},
+			"192.0.2.255/32": map[string]any{
+				"hits": float64(1),
+			},
+		},
+		"misses": float64(0),
+	}, decoded)
+}
@@ -0,0 +1,398 @@
+package iprtb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedIPRouteSyntax represents the error that indicates given `ip route` output has the syntax that this library doesn't support.
+var ErrUnsupportedIPRouteSyntax = errors.New("unsupported syntax of ip route")
+
+// ErrConflictingDefaultRoutes represents the error that indicates given routes have both IPv4 and IPv6 default routes.
+// They can't coexist in a routing table because both of them are stored at the root of the prefix tree.
+var ErrConflictingDefaultRoutes = errors.New("given routes have both IPv4 and IPv6 default routes")
+
+// ipRouteIgnoredTypes are the route types that aren't used to forward packets to the other hosts, so they are skipped on parsing.
+var ipRouteIgnoredTypes = map[string]struct{}{
+	"local":     {},
+	"broadcast": {},
+	"multicast": {},
+	"anycast":   {},
+}
+
+// ipRouteDiscardTypes are the route types that discard packets. They are represented as the routes that have neither gateway nor network interface.
+var ipRouteDiscardTypes = map[string]struct{}{
+	"blackhole":   {},
+	"unreachable": {},
+	"prohibit":    {},
+}
+
+var ipRouteUnsupportedTypes = map[string]struct{}{
+	"throw": {},
+	"nat":   {},
+}
+
+// ipRouteFlags are the attributes of ip route that don't have any value.
+var ipRouteFlags = map[string]struct{}{
+	"onlink":     {},
+	"pervasive":  {},
+	"linkdown":   {},
+	"offload":    {},
+	"trap":       {},
+	"rt_offload": {},
+	"rt_trap":    {},
+	"notify":     {},
+	"dead":       {},
+	"cache":      {},
+}
+
+// ipRouteAttributes are the attributes of ip route that have a value but they are not mapped to Route.
+var ipRouteAttributes = map[string]struct{}{
+	"proto":              {},
+	"scope":              {},
+	"src":                {},
+	"table":              {},
+	"pref":               {},
+	"mtu":                {},
+	"advmss":             {},
+	"hoplimit":           {},
+	"expires":            {},
+	"realm":              {},
+	"realms":             {},
+	"error":              {},
+	"rtt":                {},
+	"rttvar":             {},
+	"rto_min":            {},
+	"window":             {},
+	"cwnd":               {},
+	"initcwnd":           {},
+	"initrwnd":           {},
+	"ssthresh":           {},
+	"reordering":         {},
+	"quickack":           {},
+	"features":           {},
+	"congctl":            {},
+	"nhid":               {},
+	"tos":                {},
+	"dsfield":            {},
+	"weight":             {},
+	"uid":                {},
+	"mark":               {},
+	"ttl-propagate":      {},
+	"fastopen_no_cookie": {},
+}
+
+// ParseIPRouteOutput parses the output of `ip route show` (e.g. `ip -4 route show` and `ip -6 route show table all`) into the routes.
+//
+// Each line is mapped to a Route; "via" is mapped to Gateway, "dev" is mapped to NetworkInterface and "metric" is mapped to Metric.
+// "default" destination is regarded as IPv6 when the line has IPv6 gateway, IPv6 "src" or "pref" attribute (that only IPv6 routes have), otherwise it is regarded as IPv4.
+// The destination that doesn't have the prefix length is regarded as the host route.
+// If the output has the multiple routes for the same destination (e.g. the default routes via the different network interfaces,
+// or the unreachable default route that ends `ip -6 route show`), only the route that has the lowest metric is kept because the kernel forwards packets by that;
+// the first one is kept if they have the same metric.
+// The other attributes (e.g. "proto", "scope", "src" and "table") are ignored, so the routes in the different tables are mixed.
+//
+// The blackhole, unreachable and prohibit routes are parsed as the routes that have neither gateway nor network interface.
+// The local, broadcast, multicast and anycast routes are skipped because they don't forward packets to the other hosts.
+// The throw and nat routes, the multipath routes and the unknown attributes are not supported; this returns an error that wraps
+// ErrUnsupportedIPRouteSyntax with the line number for them.
+func ParseIPRouteOutput(r io.Reader) (Routes, error) {
+	routes := Routes{}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		route, err := parseIPRouteLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ip route output at line %d: %w", lineNum, err)
+		}
+		if route != nil {
+			routes = append(routes, route)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ip route output: %w", err)
+	}
+
+	return lowestMetricRoutes(routes), nil
+}
+
+// LoadIPRouteOutput parses the output of `ip route show` and adds the parsed routes to the routing table at once.
+// Please refer also to ParseIPRouteOutput for the details of parsing.
+//
+// The IPv4 and IPv6 default routes can't coexist in a routing table, so if the output has both of them
+// (e.g. the combined output of `ip -4 route show` and `ip -6 route show`), this returns ErrConflictingDefaultRoutes without adding any route.
+// Load them into the different routing tables in that case. Note that an existing default route of the other address family is
+// overwritten by the loaded one as well as AddRoute.
+func (rt *RouteTable) LoadIPRouteOutput(ctx context.Context, r io.Reader) error {
+	routes, err := ParseIPRouteOutput(r)
+	if err != nil {
+		return err
+	}
+
+	var defaultRoute *Route
+	for _, route := range routes {
+		if prefixLen, _ := route.Destination.Mask.Size(); prefixLen != 0 {
+			continue
+		}
+		if defaultRoute != nil && (defaultRoute.Destination.IP.To4() == nil) != (route.Destination.IP.To4() == nil) {
+			return fmt.Errorf("failed to load ip route output; %s and %s: %w", defaultRoute.Destination, route.Destination, ErrConflictingDefaultRoutes)
+		}
+		defaultRoute = route
+	}
+
+	return rt.AddRoutes(ctx, routes)
+}
+
+func parseIPRouteLine(line string) (*Route, error) {
+	if line[0] == ' ' || line[0] == '\t' {
+		// e.g. "\tnexthop via 192.0.2.1 dev eth0 weight 1"
+		return nil, fmt.Errorf("multipath route => %q: %w", strings.TrimSpace(line), ErrUnsupportedIPRouteSyntax)
+	}
+
+	fields := strings.Fields(line)
+
+	isDiscardRoute := false
+	routeType := fields[0]
+	if _, ok := ipRouteIgnoredTypes[routeType]; ok {
+		return nil, nil
+	}
+	if _, ok := ipRouteUnsupportedTypes[routeType]; ok {
+		return nil, fmt.Errorf("%s route: %w", routeType, ErrUnsupportedIPRouteSyntax)
+	}
+	if _, ok := ipRouteDiscardTypes[routeType]; ok {
+		isDiscardRoute = true
+		fields = fields[1:]
+	} else if routeType == "unicast" {
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing destination: %w", ErrUnsupportedIPRouteSyntax)
+	}
+	dst := fields[0]
+
+	route := &Route{}
+	isIPv6 := false
+	for i := 1; i < len(fields); i++ {
+		key := fields[i]
+		if _, ok := ipRouteFlags[key]; ok {
+			continue
+		}
+
+		if i+1 >= len(fields) {
+			return nil, fmt.Errorf("missing value of %q: %w", key, ErrUnsupportedIPRouteSyntax)
+		}
+		i++
+		value := fields[i]
+
+		switch key {
+		case "via":
+			if (value == "inet" || value == "inet6") && i+1 < len(fields) {
+				i++
+				value = fields[i]
+			}
+			gateway := net.ParseIP(value)
+			if gateway == nil {
+				return nil, fmt.Errorf("invalid gateway => %q", value)
+			}
+			route.Gateway = gateway
+			isIPv6 = isIPv6 || gateway.To4() == nil
+		case "dev":
+			route.NetworkInterface = value
+		case "metric":
+			metric, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric => %q: %w", value, err)
+			}
+			route.Metric = int(metric)
+		case "nexthop":
+			return nil, fmt.Errorf("multipath route: %w", ErrUnsupportedIPRouteSyntax)
+		default:
+			if _, ok := ipRouteAttributes[key]; !ok {
+				return nil, fmt.Errorf("unknown attribute => %q: %w", key, ErrUnsupportedIPRouteSyntax)
+			}
+			switch key {
+			case "src":
+				if src := net.ParseIP(value); src != nil && src.To4() == nil {
+					isIPv6 = true
+				}
+			case "pref":
+				isIPv6 = true
+			}
+			if value == "lock" && i+1 < len(fields) {
+				// e.g. "mtu lock 1400"
+				i++
+			}
+		}
+	}
+
+	destination, err := parseIPRouteDestination(dst, isIPv6)
+	if err != nil {
+		return nil, err
+	}
+	route.Destination = destination
+
+	if isDiscardRoute {
+		// the discarding routes are bound to the loopback interface on the kernel, but that is not the forwarding destination
+		route.Gateway = nil
+		route.NetworkInterface = ""
+	}
+
+	return route, nil
+}
+
+func parseIPRouteDestination(dst string, isIPv6 bool) (*net.IPNet, error) {
+	if dst == "default" {
+		if isIPv6 {
+			return &net.IPNet{
+				IP:   make(net.IP, net.IPv6len),
+				Mask: net.CIDRMask(0, 8*net.IPv6len),
+			}, nil
+		}
+		return &net.IPNet{
+			IP:   make(net.IP, net.IPv4len),
+			Mask: net.CIDRMask(0, 8*net.IPv4len),
+		}, nil
+	}
+
+	if !strings.Contains(dst, "/") {
+		ip := net.ParseIP(dst)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid destination => %q", dst)
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			return &net.IPNet{
+				IP:   ipv4,
+				Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len),
+			}, nil
+		}
+		return &net.IPNet{
+			IP:   ip,
+			Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len),
+		}, nil
+	}
+
+	_, destination, err := net.ParseCIDR(dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination => %q: %w", dst, err)
+	}
+	return destination, nil
+}
+
+// WriteIPBatch writes the routes of the routing table as the `ip -batch` script that consists of "route replace" commands,
+// so that applying the script makes the host have the routes of the routing table idempotently.
+// Note that this doesn't remove the routes that only the host has. Moreover, the kernel identifies a route by the destination
+// and the metric, so a route that the host has with the different metric is kept besides the replaced one.
+// Please use Diff.WriteIPBatch with the routes of the host to reconcile them.
+//
+// Each line honors the gateway, network interface, metric and address family of the route, and the route that has
+// neither gateway nor network interface is written as a blackhole route. The default route is written as "0.0.0.0/0" or "::/0"
+// to make the address family explicit.
+func (rt *RouteTable) WriteIPBatch(ctx context.Context, w io.Writer) error {
+	routes := rt.DumpRouteTable(ctx)
+
+	bw := bufio.NewWriter(w)
+	for _, r := range routes {
+		_, _ = bw.WriteString("route replace " + ipRouteSpec(r, true) + "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write ip batch commands: %w", err)
+	}
+	return nil
+}
+
+// WriteIPBatch writes the diff as the `ip -batch` script; the removed routes are written as "route del" commands,
+// the added routes are written as "route add" commands, and the updated routes are written as "route replace" commands in this order.
+// The kernel identifies a route by the destination and the metric, so the updated route whose metric is changed is written as
+// "route del" of the old route (i.e. UpdatedFrom) and "route add" of the new route instead of "route replace".
+// Please refer also to RouteTable.WriteIPBatch for the details of each line.
+func (d *Diff) WriteIPBatch(w io.Writer) error {
+	deletedRoutes := slices.Clone(d.Removed)
+	addedRoutes := slices.Clone(d.Added)
+	replacedRoutes := Routes{}
+	for i, r := range d.Updated {
+		if i < len(d.UpdatedFrom) && uint32(d.UpdatedFrom[i].Metric) != uint32(r.Metric) {
+			deletedRoutes = append(deletedRoutes, d.UpdatedFrom[i])
+			addedRoutes = append(addedRoutes, r)
+			continue
+		}
+		replacedRoutes = append(replacedRoutes, r)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, cmd := range []struct {
+		command     string
+		routes      Routes
+		withNextHop bool
+	}{
+		{command: "del", routes: deletedRoutes, withNextHop: false},
+		{command: "add", routes: addedRoutes, withNextHop: true},
+		{command: "replace", routes: replacedRoutes, withNextHop: true},
+	} {
+		cmd.routes.Sort()
+		for _, r := range cmd.routes {
+			_, _ = bw.WriteString("route " + cmd.command + " " + ipRouteSpec(r, cmd.withNextHop) + "\n")
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write ip batch commands: %w", err)
+	}
+	return nil
+}
+
+// ipRouteSpec renders the route as the arguments of `ip route` command.
+// If withNextHop is false, this omits the gateway and network interface, so it identifies the route only by the destination and metric.
+func ipRouteSpec(r *Route, withNextHop bool) string {
+	var sb strings.Builder
+
+	isDiscardRoute := r.Gateway == nil && r.NetworkInterface == ""
+	if isDiscardRoute {
+		sb.WriteString("blackhole ")
+	}
+
+	dstIP := canonicalDestinationIP(r.Destination)
+	prefixLen, _ := r.Destination.Mask.Size()
+	sb.WriteString((&net.IPNet{
+		IP:   dstIP,
+		Mask: net.CIDRMask(prefixLen, 8*len(dstIP)),
+	}).String())
+
+	if withNextHop && !isDiscardRoute {
+		if r.Gateway != nil {
+			sb.WriteString(" via ")
+			isIPv4Destination := len(dstIP) == net.IPv4len
+			isIPv4Gateway := r.Gateway.To4() != nil
+			if isIPv4Destination != isIPv4Gateway {
+				if isIPv4Gateway {
+					sb.WriteString("inet ")
+				} else {
+					sb.WriteString("inet6 ")
+				}
+			}
+			sb.WriteString(r.Gateway.String())
+		}
+		if r.NetworkInterface != "" {
+			sb.WriteString(" dev ")
+			sb.WriteString(r.NetworkInterface)
+		}
+	}
+
+	sb.WriteString(" metric ")
+	sb.WriteString(strconv.FormatUint(uint64(uint32(r.Metric)), 10))
+
+	return sb.String()
+}
@@ -0,0 +1,241 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPRouteOutput_IPv4(t *testing.T) {
+	routes, err := ParseIPRouteOutput(strings.NewReader(`default via 192.0.2.1 dev eth0 proto dhcp src 192.0.2.100 metric 100
+192.0.2.0/24 dev eth0 proto kernel scope link src 192.0.2.100
+198.51.100.0/24 via 192.0.2.254 dev eth1 mtu lock 1400 onlink
+203.0.113.1 via inet 192.0.2.254 dev eth1
+blackhole 10.0.0.0/8 proto static
+unreachable 172.16.0.0/12 metric 10
+broadcast 192.0.2.255 dev eth0 table local proto kernel scope link src 192.0.2.100
+local 192.0.2.100 dev eth0 table local proto kernel scope host src 192.0.2.100
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, `0.0.0.0/0	192.0.2.1	eth0	100
+192.0.2.0/24	<nil>	eth0	0
+198.51.100.0/24	192.0.2.254	eth1	0
+203.0.113.1/32	192.0.2.254	eth1	0
+10.0.0.0/8	<nil>		0
+172.16.0.0/12	<nil>		10
+`, routes.String())
+}
+
+func TestParseIPRouteOutput_IPv6(t *testing.T) {
+	routes, err := ParseIPRouteOutput(strings.NewReader(`::1 dev lo proto kernel metric 256 pref medium
+2001:db8::/64 dev eth0 proto ra metric 100 expires 86355sec pref medium
+fe80::/64 dev eth0 proto kernel metric 1024 pref medium
+default via fe80::1 dev eth0 proto ra metric 100 expires 1755sec mtu 1500 pref medium
+unreachable default dev lo proto kernel metric 4294967295 error -101 pref medium
+local ::1 dev lo table local proto kernel metric 0 pref medium
+multicast ff00::/8 dev eth0 table local proto kernel metric 256 pref medium
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, `::1/128	<nil>	lo	256
+2001:db8::/64	<nil>	eth0	100
+fe80::/64	<nil>	eth0	1024
+::/0	fe80::1	eth0	100
+`, routes.String())
+}
+
+func TestParseIPRouteOutput_DuplicateDestinations(t *testing.T) {
+	routes, err := ParseIPRouteOutput(strings.NewReader(`default via 192.0.2.1 dev wlan0 proto dhcp src 192.0.2.100 metric 600
+default via 198.51.100.1 dev eth0 proto dhcp src 198.51.100.100 metric 100
+192.0.2.0/24 dev wlan0 proto kernel scope link src 192.0.2.100 metric 600
+198.51.100.0/24 dev eth0 proto kernel scope link src 198.51.100.100 metric 100
+198.51.100.0/24 dev eth1 proto kernel scope link src 198.51.100.200 metric 100
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, `0.0.0.0/0	198.51.100.1	eth0	100
+192.0.2.0/24	<nil>	wlan0	600
+198.51.100.0/24	<nil>	eth0	100
+`, routes.String())
+}
+
+func TestParseIPRouteOutput_Unsupported(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		output        string
+		expectedError string
+	}{
+		{
+			name: "multipath",
+			output: `192.0.2.0/24 dev eth0
+default proto static metric 100
+	nexthop via 192.0.2.1 dev eth0 weight 1
+`,
+			expectedError: "failed to parse ip route output at line 3: multipath route",
+		},
+		{
+			name:          "throw",
+			output:        "throw 192.0.2.0/24 table 100\n",
+			expectedError: "failed to parse ip route output at line 1: throw route",
+		},
+		{
+			name:          "unknown attribute",
+			output:        "192.0.2.0/24 dev eth0 unknown 1\n",
+			expectedError: `failed to parse ip route output at line 1: unknown attribute => "unknown"`,
+		},
+		{
+			name:          "missing value",
+			output:        "192.0.2.0/24 dev\n",
+			expectedError: `failed to parse ip route output at line 1: missing value of "dev"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseIPRouteOutput(strings.NewReader(tc.output))
+			assert.ErrorIs(t, err, ErrUnsupportedIPRouteSyntax)
+			assert.True(t, strings.HasPrefix(err.Error(), tc.expectedError), err.Error())
+		})
+	}
+}
+
+func TestParseIPRouteOutput_Invalid(t *testing.T) {
+	_, err := ParseIPRouteOutput(strings.NewReader("192.0.2.0/33 dev eth0\n"))
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), `failed to parse ip route output at line 1: invalid destination => "192.0.2.0/33"`), err.Error())
+
+	_, err = ParseIPRouteOutput(strings.NewReader("192.0.2.0/24 via INVALID dev eth0\n"))
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), `failed to parse ip route output at line 1: invalid gateway => "INVALID"`), err.Error())
+
+	_, err = ParseIPRouteOutput(strings.NewReader("192.0.2.0/24 dev eth0 metric -1\n"))
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), `failed to parse ip route output at line 1: invalid metric => "-1"`), err.Error())
+}
+
+func TestRouteTable_LoadIPRouteOutput(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.LoadIPRouteOutput(ctx, strings.NewReader(`default via 192.0.2.1 dev eth0 proto dhcp src 192.0.2.100 metric 100
+192.0.2.0/24 dev eth0 proto kernel scope link src 192.0.2.100
+`))
+	assert.NoError(t, err)
+
+	maybeMatchedRoute, err := rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", maybeMatchedRoute.Unwrap().Gateway.String())
+
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 1))
+	assert.NoError(t, err)
+	assert.Nil(t, maybeMatchedRoute.Unwrap().Gateway)
+
+	err = rtb.LoadIPRouteOutput(ctx, strings.NewReader("throw 192.0.2.0/24\n"))
+	assert.ErrorIs(t, err, ErrUnsupportedIPRouteSyntax)
+
+	// the combined output of `ip -4 route show` and `ip -6 route show` has the default routes that can't coexist
+	err = rtb.LoadIPRouteOutput(ctx, strings.NewReader(`default via 192.0.2.254 dev eth1
+2001:db8::/64 dev eth0 proto ra metric 100 pref medium
+default via fe80::1 dev eth0 proto ra metric 1024 pref medium
+`))
+	assert.ErrorIs(t, err, ErrConflictingDefaultRoutes)
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(8, 8, 8, 8))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", maybeMatchedRoute.Unwrap().Gateway.String())
+	assert.Equal(t, 2, rtb.Len(ctx))
+
+	// the default routes via the different network interfaces; the lowest metric one is used regardless of the order
+	rtb = NewRouteTable()
+	err = rtb.LoadIPRouteOutput(ctx, strings.NewReader(`default via 192.0.2.1 dev wlan0 proto dhcp metric 600
+default via 198.51.100.1 dev eth0 proto dhcp metric 100
+`))
+	assert.NoError(t, err)
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(8, 8, 8, 8))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0/0\t198.51.100.1\teth0\t100", maybeMatchedRoute.Unwrap().String())
+}
+
+func TestRouteTable_LoadIPRouteOutput_IPv6UnreachableDefault(t *testing.T) {
+	ctx := context.Background()
+
+	// `ip -6 route show` ends with the unreachable default route that has the highest metric
+	rtb := NewRouteTable()
+	err := rtb.LoadIPRouteOutput(ctx, strings.NewReader(`::1 dev lo proto kernel metric 256 pref medium
+2001:db8::/64 dev eth0 proto ra metric 100 expires 86355sec pref medium
+fe80::/64 dev eth0 proto kernel metric 1024 pref medium
+default via fe80::1 dev eth0 proto ra metric 100 expires 1755sec mtu 1500 pref medium
+unreachable default dev lo proto kernel metric 4294967295 error -101 pref medium
+`))
+	assert.NoError(t, err)
+
+	maybeMatchedRoute, err := rtb.MatchRoute(ctx, net.ParseIP("2001:db8:ffff::1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "::/0\tfe80::1\teth0\t100", maybeMatchedRoute.Unwrap().String())
+	assert.Equal(t, 4, rtb.Len(ctx))
+}
+
+func TestRouteTable_WriteIPBatch(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.LoadIPRouteOutput(ctx, strings.NewReader(`default via 192.0.2.1 dev eth0 proto dhcp src 192.0.2.100 metric 100
+192.0.2.0/24 dev eth0 proto kernel scope link src 192.0.2.100
+blackhole 10.0.0.0/8 proto static
+2001:db8::/64 dev eth0 proto ra metric 100 expires 86355sec pref medium
+`))
+	assert.NoError(t, err)
+	err = rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(198, 51, 100, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway: net.IP{0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		Metric:  -1,
+	})
+	assert.NoError(t, err)
+
+	var buf strings.Builder
+	err = rtb.WriteIPBatch(ctx, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `route replace 0.0.0.0/0 via 192.0.2.1 dev eth0 metric 100
+route replace blackhole 10.0.0.0/8 metric 0
+route replace 192.0.2.0/24 dev eth0 metric 0
+route replace 198.51.100.0/24 via inet6 fe80::1 metric 4294967295
+route replace 2001:db8::/64 dev eth0 metric 100
+`, buf.String())
+
+	// the script can be parsed as the ip route output without the command
+	routes, err := ParseIPRouteOutput(strings.NewReader(strings.ReplaceAll(buf.String(), "route replace ", "")))
+	assert.NoError(t, err)
+	assert.Len(t, routes, 5)
+}
+
+func TestDiff_WriteIPBatch(t *testing.T) {
+	ctx := context.Background()
+
+	oldTable := NewRouteTable()
+	err := oldTable.LoadIPRouteOutput(ctx, strings.NewReader(`default via 192.0.2.1 dev eth0 metric 100
+192.0.2.0/24 dev eth0
+198.51.100.0/24 dev eth1 metric 10
+blackhole 10.0.0.0/8
+`))
+	assert.NoError(t, err)
+
+	newTable := NewRouteTable()
+	err = newTable.LoadIPRouteOutput(ctx, strings.NewReader(`default via 192.0.2.254 dev eth0 metric 100
+192.0.2.0/24 dev eth0
+198.51.100.0/24 dev eth1 metric 20
+2001:db8::/64 via 2001:db8::1 dev eth1 metric 1024
+`))
+	assert.NoError(t, err)
+
+	var buf strings.Builder
+	err = DiffRouteTables(ctx, oldTable, newTable).WriteIPBatch(&buf)
+	assert.NoError(t, err)
+	// the route whose metric is changed is deleted and added because the kernel doesn't replace it
+	assert.Equal(t, `route del blackhole 10.0.0.0/8 metric 0
+route del 198.51.100.0/24 metric 10
+route add 198.51.100.0/24 dev eth1 metric 20
+route add 2001:db8::/64 via 2001:db8::1 dev eth1 metric 1024
+route replace 0.0.0.0/0 via 192.0.2.254 dev eth0 metric 100
+`, buf.String())
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"net/netip"
 	"sync"
+	"sync/atomic"
 
 	"github.com/moznion/go-optional"
 )
@@ -13,12 +16,25 @@ import (
 // ErrInvalidIPv6Length represents the error that indicates given IPv6 address has invalid length.
 var ErrInvalidIPv6Length = errors.New("given IPv6 address doesn't satisfy the IPv6 length")
 
+// ErrLabelDestinationNotFound represents the error that indicates given label refers to the destination that doesn't exist in the routes.
+var ErrLabelDestinationNotFound = errors.New("given label refers to the destination that doesn't exist in the routes")
+
 // RouteTable is a routing table implementation.
+//
+// This struct type supports JSON marshalling and unmarshalling including the labels. Please refer also to RouteTableJSON for more information about that.
 type RouteTable struct {
 	routes            *node
 	label2Destination map[string]*net.IPNet
 	destination2Label map[string]string
-	mu                sync.Mutex
+	counters          routeCounters
+	index             routeIndex
+	hitCounting       atomic.Bool
+	misses            atomic.Uint64
+	generation        uint64 // this is incremented on every mutation of the prefix tree and the next hop states to invalidate the lookup cache
+	lookupCache       *lookupCache
+	downNextHops      map[string]struct{} // the keys are the gateway addresses that are marked as down; IPv4 address is represented as 4 bytes
+	downInterfaces    map[string]struct{}
+	mu                sync.RWMutex
 }
 
 // NewRouteTable makes a new RouteTable value.
@@ -39,6 +55,26 @@ func (rt *RouteTable) AddRoute(ctx context.Context, route *Route) error {
 	return rt.addRoute(ctx, route)
 }
 
+// AddRoutes adds the routes to the routing table at once.
+// If the destination has already existed in the routing table, this overwrites the route information by the given route as well as AddRoute.
+// If there is an invalid route, this returns an error without adding any routes.
+func (rt *RouteTable) AddRoutes(ctx context.Context, routes Routes) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, route := range routes {
+		if err := validateDestination(route.Destination); err != nil {
+			return fmt.Errorf("failed to add routes; invalid destination => %s: %w", route.Destination, err)
+		}
+	}
+	for _, route := range routes {
+		if err := rt.addRoute(ctx, route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AddRouteWithLabel adds a route to the routing table with a label.
 // If the destination has already existed in the routing table, this overwrites the route information by the given route.
 // The label is capable to use by UpdateRouteByLabel and RemoveRouteByLabel functions instead of the actual destination information.
@@ -74,6 +110,56 @@ func (rt *RouteTable) UpdateRouteByLabel(ctx context.Context, label string, gate
 	})
 }
 
+// UpdateRouteIfExists updates the route whose destination is exactly the same as the destination of the given route.
+// Unlike AddRoute, this doesn't add the route if there is no such route; this returns the updated route that is wrapped by optional,
+// or `None` if the route doesn't exist. The existence check and the update are applied atomically.
+func (rt *RouteTable) UpdateRouteIfExists(ctx context.Context, route *Route) (optional.Option[Route], error) {
+	if err := validateDestination(route.Destination); err != nil {
+		return optional.None[Route](), fmt.Errorf("invalid destination on updating a route => %s: %w", route.Destination, err)
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	existingRoute := rt.lookupExactRoute(route.Destination)
+	if existingRoute == nil {
+		return optional.None[Route](), nil
+	}
+	return rt.updateRoute(ctx, existingRoute, route.Gateway, route.NetworkInterface, route.Metric)
+}
+
+// UpdateRouteByLabelIfExists updates the route that is associated with the given label as well as UpdateRouteByLabel,
+// but this returns the updated route that is wrapped by optional, or `None` if there is no such route.
+// The existence check and the update are applied atomically.
+func (rt *RouteTable) UpdateRouteByLabelIfExists(ctx context.Context, label string, gateway net.IP, nwInterface string, metric int) (optional.Option[Route], error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	destination := rt.label2Destination[label]
+	if destination == nil {
+		return optional.None[Route](), nil
+	}
+	existingRoute := rt.lookupExactRoute(destination)
+	if existingRoute == nil {
+		return optional.None[Route](), nil
+	}
+	return rt.updateRoute(ctx, existingRoute, gateway, nwInterface, metric)
+}
+
+// updateRoute replaces the attributes of the existing route. The caller must hold the lock.
+func (rt *RouteTable) updateRoute(ctx context.Context, existingRoute *Route, gateway net.IP, nwInterface string, metric int) (optional.Option[Route], error) {
+	updatedRoute := &Route{
+		Destination:      existingRoute.Destination, // to keep the identity of the labelled destination
+		Gateway:          gateway,
+		NetworkInterface: nwInterface,
+		Metric:           metric,
+	}
+	if err := rt.addRoute(ctx, updatedRoute); err != nil {
+		return optional.None[Route](), err
+	}
+	return optional.Some(*updatedRoute), nil
+}
+
 func (rt *RouteTable) addRoute(ctx context.Context, route *Route) error {
 	destination := route.Destination
 	terminalRoute := &Route{
@@ -86,7 +172,7 @@ func (rt *RouteTable) addRoute(ctx context.Context, route *Route) error {
 	currentNode := rt.routes // root
 	maskLen, _ := destination.Mask.Size()
 	if maskLen <= 0 {
-		currentNode.route = terminalRoute
+		rt.setNodeRoute(currentNode, terminalRoute)
 		return nil
 	}
 
@@ -114,7 +200,7 @@ func (rt *RouteTable) addRoute(ctx context.Context, route *Route) error {
 
 			maskLen--
 			if maskLen <= 0 { // terminated
-				nextNode.route = terminalRoute
+				rt.setNodeRoute(nextNode, terminalRoute)
 				return nil
 			}
 
@@ -125,6 +211,94 @@ func (rt *RouteTable) addRoute(ctx context.Context, route *Route) error {
 	return nil
 }
 
+// setNodeRoute sets the route (or nil to remove) to the node with maintaining the route counters and the secondary indexes.
+func (rt *RouteTable) setNodeRoute(n *node, route *Route) {
+	if n.route != nil {
+		rt.counters.count(n.route, -1)
+		rt.index.remove(n.route)
+	}
+	if route != nil {
+		rt.counters.count(route, 1)
+		rt.index.add(route)
+	} else {
+		n.hits.Store(0)
+	}
+	n.route = route
+	rt.generation++
+}
+
+// lookupExactRoute returns the route whose destination is exactly the same as the given destination.
+// If there is no such route, this returns nil.
+func (rt *RouteTable) lookupExactRoute(destination *net.IPNet) *Route {
+	dstIP, err := adjustIPLength(destination.IP)
+	if err != nil {
+		return nil
+	}
+
+	maskLen, _ := destination.Mask.Size()
+	if maskLen > len(dstIP)*8 {
+		return nil
+	}
+
+	visitNode := rt.routes
+	for i := 0; i < maskLen; i++ {
+		if toBit(dstIP[i/8], i%8) == 0 {
+			visitNode = visitNode.zeroBitNode
+		} else {
+			visitNode = visitNode.oneBitNode
+		}
+		if visitNode == nil {
+			return nil
+		}
+	}
+	return visitNode.route
+}
+
+// checkVacantDestination returns an error if the node of the prefix tree for the destination already has a route.
+// This is for the loaders that build a new routing table from the serialized routes, where such a destination is not an update but a conflict.
+// Note that the IPv4 and IPv6 default routes share the root node, so they can't coexist.
+func (rt *RouteTable) checkVacantDestination(destination *net.IPNet) error {
+	existing := rt.lookupExactRoute(destination)
+	if existing == nil {
+		return nil
+	}
+	if ones, _ := destination.Mask.Size(); ones == 0 && (existing.Destination.IP.To4() == nil) != (destination.IP.To4() == nil) {
+		return fmt.Errorf("%s and %s: %w", existing.Destination, destination, ErrConflictingDefaultRoutes)
+	}
+	return fmt.Errorf("duplicated destination => %s", destination)
+}
+
+// GetRoute returns the route whose destination is exactly the same as the given destination. This doesn't do the longest match.
+// If there is no such route, this returns `None`.
+func (rt *RouteTable) GetRoute(ctx context.Context, destination *net.IPNet) (optional.Option[Route], error) {
+	if err := validateDestination(destination); err != nil {
+		return optional.None[Route](), fmt.Errorf("invalid destination on getting a route => %s: %w", destination, err)
+	}
+
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return optional.FromNillable[Route](rt.lookupExactRoute(destination)), nil
+}
+
+// GetRouteByLabel returns the route that is associated with the given label. If there is no such route, this returns `None`.
+func (rt *RouteTable) GetRouteByLabel(ctx context.Context, label string) optional.Option[Route] {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	destination := rt.label2Destination[label]
+	if destination == nil {
+		return optional.None[Route]()
+	}
+	return optional.FromNillable[Route](rt.lookupExactRoute(destination))
+}
+
+// Labels returns the labels and the destinations that are associated with them.
+func (rt *RouteTable) Labels(ctx context.Context) map[string]*net.IPNet {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return maps.Clone(rt.label2Destination)
+}
+
 // RemoveRoute removes a route that is associated with a given destination. This returns the removed route information that is wrapped by optional.
 // If there is no route to remove, this does nothing and returns `None` as the removed route.
 func (rt *RouteTable) RemoveRoute(ctx context.Context, destination *net.IPNet) (optional.Option[Route], error) {
@@ -135,11 +309,24 @@ func (rt *RouteTable) RemoveRoute(ctx context.Context, destination *net.IPNet) (
 	if err != nil {
 		return optional.None[Route](), err
 	}
+	rt.removeLabelByDestination(destination)
+	return maybeRemovedRoute, nil
+}
+
+func (rt *RouteTable) removeLabelByDestination(destination *net.IPNet) {
 	if label, ok := rt.destination2Label[destination.String()]; ok {
 		delete(rt.destination2Label, destination.String())
 		delete(rt.label2Destination, label)
 	}
-	return maybeRemovedRoute, nil
+}
+
+// destinationKey2Label returns the labels that are keyed by destinationKey. The caller must hold the lock.
+func (rt *RouteTable) destinationKey2Label() map[string]string {
+	key2Label := make(map[string]string, len(rt.label2Destination))
+	for label, destination := range rt.label2Destination {
+		key2Label[destinationKey(destination)] = label
+	}
+	return key2Label
 }
 
 // RemoveRouteByLabel removes a route that is associated with a given label, instead of the actual destination information. This returns the removed route information that is wrapped by optional.
@@ -167,7 +354,7 @@ func (rt *RouteTable) removeRoute(ctx context.Context, destination *net.IPNet) (
 	maskLen, _ := destination.Mask.Size()
 	if maskLen <= 0 {
 		removedRoute := optional.FromNillable[Route](prevNode.route)
-		prevNode.route = nil
+		rt.setNodeRoute(prevNode, nil)
 		return removedRoute, nil
 	}
 
@@ -200,6 +387,9 @@ func (rt *RouteTable) removeRoute(ctx context.Context, destination *net.IPNet) (
 				removedRoute := optional.None[Route]()
 				if (*nextNode).route != nil {
 					removedRoute = optional.Some[Route](*((*nextNode).route))
+					rt.counters.count((*nextNode).route, -1)
+					rt.index.remove((*nextNode).route)
+					rt.generation++
 					// node terminated: should remove a route
 					if (*nextNode).zeroBitNode == nil && (*nextNode).oneBitNode == nil {
 						// this terminal node doesn't have any children; do pruning including the terminal node itself
@@ -219,6 +409,7 @@ func (rt *RouteTable) removeRoute(ctx context.Context, destination *net.IPNet) (
 					} else {
 						// this node has some children, so it removes only routing info
 						(*nextNode).route = nil
+						(*nextNode).hits.Store(0)
 					}
 				}
 				return removedRoute, nil
@@ -239,57 +430,199 @@ func (rt *RouteTable) removeRoute(ctx context.Context, destination *net.IPNet) (
 	return optional.None[Route](), nil
 }
 
+// ReplaceRoutes reconciles the routing table to the given routes and labels.
+// This applies only the minimal mutations to the routing table; the routes that aren't in the given routes are removed,
+// the routes that don't exist in the routing table are added, and the routes that have different information are updated.
+// The labels are replaced by the given labels that map a label to a destination, and every labelled destination must be in the given routes.
+// If the given routes have the same destination more than once, the latter one wins.
+//
+// Readers never observe the intermediate state of the reconciliation because this function holds the lock during the whole processing.
+// This returns the applied route-level difference.
+// If there is an invalid route or label, this returns an error without modifying the routing table.
+func (rt *RouteTable) ReplaceRoutes(ctx context.Context, routes Routes, labels map[string]*net.IPNet) (*Diff, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	key2Index := make(map[string]int, len(routes))
+	desiredRoutes := make(Routes, 0, len(routes))
+	for _, route := range routes {
+		if err := validateDestination(route.Destination); err != nil {
+			return nil, fmt.Errorf("failed to replace routes; invalid destination => %s: %w", route.Destination, err)
+		}
+		key := destinationKey(route.Destination)
+		if i, ok := key2Index[key]; ok {
+			desiredRoutes[i] = route
+			continue
+		}
+		key2Index[key] = len(desiredRoutes)
+		desiredRoutes = append(desiredRoutes, route)
+	}
+
+	label2Destination := make(map[string]*net.IPNet, len(labels))
+	destination2Label := make(map[string]string, len(labels))
+	for label, destination := range labels {
+		i, ok := key2Index[destinationKey(destination)]
+		if !ok {
+			return nil, fmt.Errorf("failed to replace routes; label => %s, destination => %s: %w", label, destination, ErrLabelDestinationNotFound)
+		}
+		route := desiredRoutes[i]
+		label2Destination[label] = route.Destination
+		destination2Label[route.Destination.String()] = label
+	}
+
+	diff := diffRoutes(rt.scanNode(rt.routes), desiredRoutes)
+	for _, route := range diff.Removed {
+		if _, err := rt.removeRoute(ctx, route.Destination); err != nil {
+			return nil, err
+		}
+	}
+	for _, route := range diff.Added {
+		if err := rt.addRoute(ctx, route); err != nil {
+			return nil, err
+		}
+	}
+	for _, route := range diff.Updated {
+		if err := rt.addRoute(ctx, route); err != nil {
+			return nil, err
+		}
+	}
+
+	rt.label2Destination = label2Destination
+	rt.destination2Label = destination2Label
+
+	return diff, nil
+}
+
 // ClearRoutes removes all routes from the routing table.
 func (rt *RouteTable) ClearRoutes(ctx context.Context) {
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
-	rt.routes = &node{}
-	rt.label2Destination = map[string]*net.IPNet{}
-	rt.destination2Label = map[string]string{}
+	rt.replaceWith(NewRouteTable())
+}
+
+// replaceWith replaces the routes and the labels by the ones of the given routing table. The caller must hold the lock.
+func (rt *RouteTable) replaceWith(newTable *RouteTable) {
+	rt.routes = newTable.routes
+	rt.label2Destination = newTable.label2Destination
+	rt.destination2Label = newTable.destination2Label
+	rt.counters = newTable.counters
+	rt.index = newTable.index
+	rt.generation++
 }
 
 // MatchRoute attempts to check whether the given IP address matches the routing table or not.
 // If there is matched route, this returns that route information that is wrapped by optional.Some.
 // Else, this returns the value of optional.None.
+// The routes via the next hops that are marked as down by SetNextHopState and the routes on the network interfaces
+// that are marked as down by SetInterfaceState are skipped.
 func (rt *RouteTable) MatchRoute(ctx context.Context, target net.IP) (optional.Option[Route], error) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
 	target, err := adjustIPLength(target)
 	if err != nil {
 		return optional.None[Route](), fmt.Errorf("invalid target IP address on matching a route => %s: %w", target, err)
 	}
 
-	var matchedRoute *Route
+	var matchedNode *node
+	if rt.lookupCache != nil {
+		var ok bool
+		matchedNode, ok = rt.lookupCache.get(target, rt.generation)
+		if !ok {
+			matchedNode = rt.matchNode(target)
+			rt.lookupCache.put(target, matchedNode, rt.generation)
+		}
+	} else {
+		matchedNode = rt.matchNode(target)
+	}
+
+	if rt.hitCounting.Load() {
+		if matchedNode != nil {
+			matchedNode.hits.Add(1)
+		} else {
+			rt.misses.Add(1)
+		}
+	}
+	if matchedNode == nil {
+		return optional.None[Route](), nil
+	}
+	return optional.Some[Route](*matchedNode.route), nil
+}
+
+// MatchAddr is the allocation-free variant of MatchRoute; this returns the matched route and true, or the zero value and false
+// if there is no matched route or the target is invalid (i.e. the zero value of netip.Addr).
+// IPv4-mapped IPv6 addresses are regarded as IPv4 addresses as well as MatchRoute.
+// This doesn't use the lookup cache, but the hit counters are counted up if they are enabled.
+//
+// net.IP can be converted to netip.Addr without allocation by netip.AddrFromSlice.
+func (rt *RouteTable) MatchAddr(ctx context.Context, target netip.Addr) (Route, bool) {
+	if !target.IsValid() {
+		return Route{}, false
+	}
+
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	var matchedNode *node
+	if target = target.Unmap(); target.Is4() {
+		ipv4 := target.As4()
+		matchedNode = rt.matchNode(ipv4[:])
+	} else {
+		ipv6 := target.As16()
+		matchedNode = rt.matchNode(ipv6[:])
+	}
+
+	if rt.hitCounting.Load() {
+		if matchedNode != nil {
+			matchedNode.hits.Add(1)
+		} else {
+			rt.misses.Add(1)
+		}
+	}
+	if matchedNode == nil {
+		return Route{}, false
+	}
+	return *matchedNode.route, true
+}
+
+// matchNode returns the node that has the longest matched route for the target. If there is no matched route, this returns nil.
+// The target must be adjusted by adjustIPLength.
+func (rt *RouteTable) matchNode(target net.IP) *node {
+	var matchedNode *node
 	visitNode := rt.routes
 	for _, b := range target {
 		for rightShift := 0; rightShift <= 7; rightShift++ {
-			if visitNode.route != nil {
-				matchedRoute = visitNode.route
+			if visitNode.route != nil && rt.isRouteUsable(visitNode.route) {
+				matchedNode = visitNode
 			}
 
 			bit := toBit(b, rightShift)
 			if bit == 0 {
 				if visitNode.zeroBitNode == nil {
-					return optional.FromNillable[Route](matchedRoute), nil
+					return matchedNode
 				}
 				visitNode = visitNode.zeroBitNode
 			} else {
 				if visitNode.oneBitNode == nil {
-					return optional.FromNillable[Route](matchedRoute), nil
+					return matchedNode
 				}
 				visitNode = visitNode.oneBitNode
 			}
 		}
 	}
-	if visitNode.route != nil {
-		matchedRoute = visitNode.route
+	if visitNode.route != nil && rt.isRouteUsable(visitNode.route) {
+		matchedNode = visitNode
 	}
-
-	return optional.FromNillable[Route](matchedRoute), nil
+	return matchedNode
 }
 
 // FindRoute attempts to find the route information that is matched with the given IP address.
 // If that route is found this returns true.
 // This function doesn't respect the longest match, so the performance of this function would be better than MatchRoute but this doesn't return the actual detailed information.
 func (rt *RouteTable) FindRoute(ctx context.Context, target net.IP) (bool, error) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
 	target, err := adjustIPLength(target)
 	if err != nil {
 		return false, fmt.Errorf("invalid target IP address on finding a route => %s: %w", target, err)
@@ -298,7 +631,7 @@ func (rt *RouteTable) FindRoute(ctx context.Context, target net.IP) (bool, error
 	visitNode := rt.routes
 	for _, b := range target {
 		for rightShift := 0; rightShift <= 7; rightShift++ {
-			if visitNode.route != nil {
+			if visitNode.route != nil && rt.isRouteUsable(visitNode.route) {
 				return true, nil
 			}
 
@@ -316,13 +649,49 @@ func (rt *RouteTable) FindRoute(ctx context.Context, target net.IP) (bool, error
 			}
 		}
 	}
-	return visitNode.route != nil, nil
+	return visitNode.route != nil && rt.isRouteUsable(visitNode.route), nil
+}
+
+// CoveringRoutes returns all routes whose destinations contain the given IP address, ordered from the shortest prefix to the longest one.
+// This is useful to explain why the route is chosen by MatchRoute. Note that this includes the routes that MatchRoute skips
+// because their next hops or network interfaces are marked as down, so the last route is not always the one that MatchRoute returns.
+// This neither uses the lookup cache nor counts up the hit counters.
+func (rt *RouteTable) CoveringRoutes(ctx context.Context, target net.IP) (Routes, error) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	target, err := adjustIPLength(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target IP address on collecting covering routes => %s: %w", target, err)
+	}
+
+	routes := Routes{}
+	visitNode := rt.routes
+	for depth := 0; visitNode != nil; depth++ {
+		if visitNode.route != nil {
+			routes = append(routes, visitNode.route)
+		}
+		if depth >= 8*len(target) {
+			break
+		}
+		if toBit(target[depth/8], depth%8) == 0 {
+			visitNode = visitNode.zeroBitNode
+		} else {
+			visitNode = visitNode.oneBitNode
+		}
+	}
+	return routes, nil
 }
 
 // DumpRouteTable dumps the configurations of the routing table.
+// The routes are ordered by the address family (IPv4 comes first), the destination address, and the prefix length.
 // The result value supports String() method so that be able to do stringify.
 func (rt *RouteTable) DumpRouteTable(ctx context.Context) Routes {
-	return rt.scanNode(rt.routes)
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	routes := rt.scanNode(rt.routes)
+	routes.Sort()
+	return routes
 }
 
 func (rt *RouteTable) scanNode(visitNode *node) Routes {
@@ -342,6 +711,15 @@ func (rt *RouteTable) scanNode(visitNode *node) Routes {
 	return routes
 }
 
+// validateDestination checks whether addRoute accepts the given destination or not.
+func validateDestination(destination *net.IPNet) error {
+	if maskLen, _ := destination.Mask.Size(); maskLen <= 0 {
+		return nil
+	}
+	_, err := adjustIPLength(destination.IP)
+	return err
+}
+
 func toBit(b byte, rightShift int) byte {
 	mask := byte(0b10000000 >> rightShift)
 	return byte((b & mask) >> (7 - rightShift))
@@ -363,4 +741,5 @@ type node struct {
 	zeroBitNode *node
 	oneBitNode  *node
 	route       *Route
+	hits        atomic.Uint64 // the number of matches of the route; this is counted only when the hit counters are enabled
 }
@@ -3,6 +3,8 @@ package iprtb
 import (
 	"context"
 	"net"
+	"net/netip"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -541,6 +543,169 @@ func TestRouteTable_FindRoute_WithInvalidIpv6(t *testing.T) {
 	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
 }
 
+func TestRouteTable_GetRoute(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+
+	route := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	err := rtb.AddRouteWithLabel(ctx, "net", route)
+	assert.NoError(t, err)
+
+	maybeRoute, err := rtb.GetRoute(ctx, route.Destination)
+	assert.NoError(t, err)
+	assert.Equal(t, route, maybeRoute.UnwrapAsPtr())
+	assert.Equal(t, route, rtb.GetRouteByLabel(ctx, "net").UnwrapAsPtr())
+
+	// not the longest prefix match but the exact match
+	maybeRoute, err = rtb.GetRoute(ctx, &net.IPNet{
+		IP:   net.IPv4(192, 0, 2, 1),
+		Mask: net.IPv4Mask(255, 255, 255, 255),
+	})
+	assert.NoError(t, err)
+	assert.True(t, maybeRoute.IsNone())
+	assert.True(t, rtb.GetRouteByLabel(ctx, "unknown").IsNone())
+
+	_, err = rtb.GetRoute(ctx, &net.IPNet{
+		IP:   net.IP{0xff, 0xff, 0xff, 0xff, 0xff},
+		Mask: net.IPv4Mask(255, 255, 255, 0),
+	})
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+}
+
+func TestRouteTable_UpdateRouteIfExists(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+
+	destination := &net.IPNet{
+		IP:   net.IPv4(192, 0, 2, 0),
+		Mask: net.IPv4Mask(255, 255, 255, 0),
+	}
+	err := rtb.AddRouteWithLabel(ctx, "net", &Route{
+		Destination:      destination,
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	})
+	assert.NoError(t, err)
+
+	maybeRoute, err := rtb.UpdateRouteIfExists(ctx, &Route{
+		Destination:      destination,
+		Gateway:          net.IPv4(192, 0, 2, 2),
+		NetworkInterface: "ifb1",
+		Metric:           2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.0/24\t192.0.2.2\tifb1\t2", maybeRoute.Unwrap().String())
+	assert.Equal(t, maybeRoute, rtb.GetRouteByLabel(ctx, "net"))
+
+	maybeRoute, err = rtb.UpdateRouteByLabelIfExists(ctx, "net", net.IPv4(192, 0, 2, 3), "ifb2", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.0/24\t192.0.2.3\tifb2\t3", maybeRoute.Unwrap().String())
+	assert.Equal(t, maybeRoute, rtb.GetRouteByLabel(ctx, "net"))
+
+	// the routes that don't exist are not added
+	maybeRoute, err = rtb.UpdateRouteIfExists(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 128),
+		},
+		NetworkInterface: "ifb0",
+	})
+	assert.NoError(t, err)
+	assert.True(t, maybeRoute.IsNone())
+	maybeRoute, err = rtb.UpdateRouteByLabelIfExists(ctx, "unknown", nil, "ifb0", 0)
+	assert.NoError(t, err)
+	assert.True(t, maybeRoute.IsNone())
+	assert.Equal(t, 1, rtb.Len(ctx))
+
+	_, err = rtb.UpdateRouteIfExists(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IP{0xff, 0xff, 0xff, 0xff, 0xff},
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+	})
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+}
+
+func TestRouteTable_CoveringRoutes(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	routes, err := ParseRoutes(strings.NewReader(`
+default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth0
+10.1.0.0/16 via 192.0.2.3 dev eth0
+10.1.2.3/32 dev eth1
+10.2.0.0/16 dev eth1
+`))
+	assert.NoError(t, err)
+	assert.NoError(t, rtb.AddRoutes(ctx, routes))
+
+	covering, err := rtb.CoveringRoutes(ctx, net.IPv4(10, 1, 2, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, `0.0.0.0/0	192.0.2.1	eth0	0
+10.0.0.0/8	192.0.2.2	eth0	0
+10.1.0.0/16	192.0.2.3	eth0	0
+10.1.2.3/32	<nil>	eth1	0
+`, covering.String())
+
+	matched, err := rtb.MatchRoute(ctx, net.IPv4(10, 1, 2, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, covering[len(covering)-1], matched.UnwrapAsPtr())
+
+	covering, err = rtb.CoveringRoutes(ctx, net.IPv4(10, 3, 0, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, `0.0.0.0/0	192.0.2.1	eth0	0
+10.0.0.0/8	192.0.2.2	eth0	0
+`, covering.String())
+
+	// the routes via the down next hops are included, but MatchRoute skips them
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 3), NextHopDown)
+	covering, err = rtb.CoveringRoutes(ctx, net.IPv4(10, 1, 9, 9))
+	assert.NoError(t, err)
+	assert.Equal(t, `0.0.0.0/0	192.0.2.1	eth0	0
+10.0.0.0/8	192.0.2.2	eth0	0
+10.1.0.0/16	192.0.2.3	eth0	0
+`, covering.String())
+	matched, err = rtb.MatchRoute(ctx, net.IPv4(10, 1, 9, 9))
+	assert.NoError(t, err)
+	assert.Equal(t, covering[1], matched.UnwrapAsPtr())
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 3), NextHopUp)
+
+	covering, err = NewRouteTable().CoveringRoutes(ctx, net.IPv4(10, 3, 0, 1))
+	assert.NoError(t, err)
+	assert.Empty(t, covering)
+
+	_, err = rtb.CoveringRoutes(ctx, net.IP{0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+}
+
+func TestRouteTable_Labels(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	assert.Empty(t, rtb.Labels(ctx))
+
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader("10.0.0.0/8 dev eth0 label core\n192.0.2.0/24 dev eth1\n")))
+	labels := rtb.Labels(ctx)
+	assert.Len(t, labels, 1)
+	assert.Equal(t, "10.0.0.0/8", labels["core"].String())
+
+	// the returned map is a copy
+	delete(labels, "core")
+	assert.Len(t, rtb.Labels(ctx), 1)
+}
+
 func TestRouteTable_WithLabel(t *testing.T) {
 	ctx := context.Background()
 
@@ -743,10 +908,10 @@ func TestRouteTable_DumpRouteTable(t *testing.T) {
 	assert.Contains(t, dumped, route2)
 	assert.Contains(t, dumped, route3)
 	assert.Contains(t, dumped, route4)
-	assert.Equal(t, `2001:db8::ff/128	2001:db8::ff	ifb0	1
-2001:db8::/32	2001:db8::1	ifb0	1
+	assert.Equal(t, `192.0.2.0/24	192.0.2.1	ifb0	1
 192.0.2.255/32	192.0.2.255	ifb0	1
-192.0.2.0/24	192.0.2.1	ifb0	1
+2001:db8::/32	2001:db8::1	ifb0	1
+2001:db8::ff/128	2001:db8::ff	ifb0	1
 `, dumped.String())
 }
 
@@ -1076,3 +1241,258 @@ func TestRouteTable_RemoveRoute_WithNotTerminatedBranchPruning(t *testing.T) {
 	found, _ = rtb.FindRoute(ctx, net.IP{192, 0, 128, 1})
 	assert.False(t, found)
 }
+
+func TestRouteTable_ReplaceRoutes(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+
+	keptRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	err := rtb.AddRoute(ctx, keptRoute)
+	assert.NoError(t, err)
+
+	removedRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(198, 51, 100, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(198, 51, 100, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	err = rtb.AddRouteWithLabel(ctx, "removed", removedRoute)
+	assert.NoError(t, err)
+
+	err = rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(203, 0, 113, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(203, 0, 113, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	})
+	assert.NoError(t, err)
+
+	updatedRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(203, 0, 113, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(203, 0, 113, 2),
+		NetworkInterface: "ifb1",
+		Metric:           2,
+	}
+	addedRoute := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		Gateway:          net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+
+	diff, err := rtb.ReplaceRoutes(ctx, Routes{keptRoute, updatedRoute, addedRoute}, map[string]*net.IPNet{
+		"added": addedRoute.Destination,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Routes{addedRoute}, diff.Added)
+	assert.Equal(t, Routes{updatedRoute}, diff.Updated)
+	assert.Equal(t, Routes{removedRoute}, diff.Removed)
+
+	dumped := rtb.DumpRouteTable(ctx)
+	assert.Len(t, dumped, 3)
+	assert.Contains(t, dumped, keptRoute)
+	assert.Contains(t, dumped, updatedRoute)
+	assert.Contains(t, dumped, addedRoute)
+
+	// the old label has gone
+	maybeRemovedRoute, err := rtb.RemoveRouteByLabel(ctx, "removed")
+	assert.NoError(t, err)
+	assert.True(t, maybeRemovedRoute.IsNone())
+
+	maybeRemovedRoute, err = rtb.RemoveRouteByLabel(ctx, "added")
+	assert.NoError(t, err)
+	assert.Equal(t, addedRoute, maybeRemovedRoute.UnwrapAsPtr())
+
+	// nothing to do
+	diff, err = rtb.ReplaceRoutes(ctx, Routes{keptRoute, updatedRoute}, nil)
+	assert.NoError(t, err)
+	assert.True(t, diff.IsEmpty())
+}
+
+func TestRouteTable_ReplaceRoutes_WithInvalidInput(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	route := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	err := rtb.AddRoute(ctx, route)
+	assert.NoError(t, err)
+
+	_, err = rtb.ReplaceRoutes(ctx, Routes{
+		{
+			Destination: &net.IPNet{
+				IP:   net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // invalid length
+				Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			},
+		},
+	}, nil)
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+
+	_, err = rtb.ReplaceRoutes(ctx, Routes{}, map[string]*net.IPNet{
+		"unknown": route.Destination,
+	})
+	assert.ErrorIs(t, err, ErrLabelDestinationNotFound)
+
+	// the routing table must not be modified
+	dumped := rtb.DumpRouteTable(ctx)
+	assert.Equal(t, Routes{route}, dumped)
+}
+
+func TestRouteTable_AddRoutes(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+
+	route1 := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	route2 := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 255),
+			Mask: net.IPv4Mask(255, 255, 255, 255),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 255),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	err := rtb.AddRoutes(ctx, Routes{route1, route2})
+	assert.NoError(t, err)
+
+	dumped := rtb.DumpRouteTable(ctx)
+	assert.Len(t, dumped, 2)
+	assert.Contains(t, dumped, route1)
+	assert.Contains(t, dumped, route2)
+
+	err = rtb.AddRoutes(ctx, Routes{
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(198, 51, 100, 0),
+				Mask: net.IPv4Mask(255, 255, 255, 0),
+			},
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // invalid length
+				Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			},
+		},
+	})
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+	assert.Len(t, rtb.DumpRouteTable(ctx), 2)
+}
+
+func TestRouteTable_MatchAddr(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	route1 := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	route2 := &Route{
+		Destination: &net.IPNet{
+			IP:   net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		Gateway:          net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}
+	err := rtb.AddRoutes(ctx, Routes{route1, route2})
+	assert.NoError(t, err)
+
+	matchedRoute, ok := rtb.MatchAddr(ctx, netip.MustParseAddr("192.0.2.100"))
+	assert.True(t, ok)
+	assert.Equal(t, *route1, matchedRoute)
+
+	matchedRoute, ok = rtb.MatchAddr(ctx, netip.MustParseAddr("::ffff:192.0.2.100"))
+	assert.True(t, ok)
+	assert.Equal(t, *route1, matchedRoute)
+
+	matchedRoute, ok = rtb.MatchAddr(ctx, netip.MustParseAddr("2001:db8::1"))
+	assert.True(t, ok)
+	assert.Equal(t, *route2, matchedRoute)
+
+	matchedRoute, ok = rtb.MatchAddr(ctx, netip.MustParseAddr("198.51.100.1"))
+	assert.False(t, ok)
+	assert.Equal(t, Route{}, matchedRoute)
+
+	_, ok = rtb.MatchAddr(ctx, netip.Addr{})
+	assert.False(t, ok)
+
+	ipv4Target := netip.MustParseAddr("192.0.2.100")
+	ipv6Target := netip.MustParseAddr("2001:db8::1")
+	missTarget := netip.MustParseAddr("198.51.100.1")
+	netIPTarget := net.IPv4(192, 0, 2, 100)
+	for _, hitCounting := range []bool{false, true} {
+		rtb.EnableHitCounters(ctx, hitCounting)
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = rtb.MatchAddr(ctx, ipv4Target)
+			_, _ = rtb.MatchAddr(ctx, ipv6Target)
+			_, _ = rtb.MatchAddr(ctx, missTarget)
+			if addr, ok := netip.AddrFromSlice(netIPTarget); ok {
+				_, _ = rtb.MatchAddr(ctx, addr)
+			}
+		})
+		assert.Zero(t, allocs, "hit counting => %v", hitCounting)
+	}
+}
+
+func BenchmarkRouteTable_MatchAddr(b *testing.B) {
+	ctx := context.Background()
+	rtb := newBenchmarkRouteTable(b, 100000)
+	target := netip.MustParseAddr("10.0.1.1")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = rtb.MatchAddr(ctx, target)
+	}
+}
+
+// newTestRouteTable makes a routing table that has the routes in the route text syntax.
+func newTestRouteTable(t *testing.T, routeText string) *RouteTable {
+	t.Helper()
+	rtb := NewRouteTable()
+	assert.NoError(t, rtb.LoadRoutes(context.Background(), strings.NewReader(routeText)))
+	return rtb
+}
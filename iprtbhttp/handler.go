@@ -0,0 +1,322 @@
+// Package iprtbhttp provides an http.Handler that exposes the REST API to manage an iprtb.RouteTable.
+package iprtbhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/moznion/go-iprtb"
+	"github.com/moznion/go-optional"
+)
+
+// Handler is an http.Handler that exposes the REST API to manage an iprtb.RouteTable.
+//
+// The endpoints are the following; a destination in the path is CIDR notation (e.g. "/routes/192.0.2.0/24"),
+// and a route in the request and response bodies is represented as iprtb.RouteJSON.
+//
+//   - GET /routes: lists the routes with the labels as iprtb.RouteTableJSON.
+//   - POST /routes: adds a route. The body is RouteRequest; if that has a label, the route is added with the label.
+//   - GET /routes/{destination}: gets the route that has exactly the destination.
+//   - PUT /routes/{destination}: updates the gateway, network interface and metric of the route that has the destination.
+//   - DELETE /routes/{destination}: removes the route that has the destination and responds the removed route.
+//   - GET /labels/{label}: gets the route that is associated with the label.
+//   - PUT /labels/{label}: updates the route that is associated with the label.
+//   - DELETE /labels/{label}: removes the route that is associated with the label and responds the removed route.
+//   - GET /match/{ip}: responds the longest matched route for the IP address.
+//
+// Errors are responded as ErrorResponse with the status code; 400 for the invalid request (e.g. iprtb.ErrInvalidIPv6Length),
+// 404 for the missing route or the unknown path, 405 for the unsupported method and 413 for the request body that exceeds MaxRequestBodySize.
+// The handler can be mounted on an existing mux with http.StripPrefix, e.g. `mux.Handle("/rtb/", http.StripPrefix("/rtb", handler))`.
+type Handler struct {
+	rt  *iprtb.RouteTable
+	mux *http.ServeMux
+}
+
+// RouteRequest is the request body to add or update a route.
+// Destination is ignored on the update endpoints because the route is specified by the path.
+type RouteRequest struct {
+	iprtb.RouteJSON
+	Label string `json:"label,omitempty"`
+}
+
+// ErrorResponse is the response body of an error.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// MaxRequestBodySize is the upper limit of the size of the request body in bytes.
+const MaxRequestBodySize = 1 << 16
+
+// errRouteNotFound represents the error that indicates there is no route that matches the request.
+var errRouteNotFound = errors.New("route not found")
+
+// NewHandler makes a new Handler for the routing table.
+func NewHandler(rt *iprtb.RouteTable) *Handler {
+	h := &Handler{
+		rt:  rt,
+		mux: http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /routes", h.listRoutes)
+	h.mux.HandleFunc("POST /routes", h.addRoute)
+	h.mux.HandleFunc("GET /routes/{destination...}", h.getRoute)
+	h.mux.HandleFunc("PUT /routes/{destination...}", h.updateRoute)
+	h.mux.HandleFunc("DELETE /routes/{destination...}", h.removeRoute)
+	h.mux.HandleFunc("GET /labels/{label}", h.getRouteByLabel)
+	h.mux.HandleFunc("PUT /labels/{label}", h.updateRouteByLabel)
+	h.mux.HandleFunc("DELETE /labels/{label}", h.removeRouteByLabel)
+	h.mux.HandleFunc("GET /match/{ip}", h.matchRoute)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	}
+	if _, pattern := h.mux.Handler(r); pattern == "" {
+		// ServeMux responds the unknown path and the unsupported method by itself in plain text
+		w = &muxErrorResponseWriter{ResponseWriter: w}
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// muxErrorResponseWriter rewrites the plain text error response of http.ServeMux into ErrorResponse.
+// The other responses such as the redirection are written as they are.
+type muxErrorResponseWriter struct {
+	http.ResponseWriter
+	rewritten bool
+}
+
+func (w *muxErrorResponseWriter) WriteHeader(status int) {
+	if status < http.StatusBadRequest {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.rewritten = true
+	w.Header().Del("X-Content-Type-Options")
+	writeJSON(w.ResponseWriter, status, &ErrorResponse{Error: strings.ToLower(http.StatusText(status))})
+}
+
+func (w *muxErrorResponseWriter) Write(b []byte) (int, error) {
+	if w.rewritten {
+		// discards the plain text body
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (h *Handler) listRoutes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.rt)
+}
+
+func (h *Handler) addRoute(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeRouteRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	destination, err := parseDestination(req.Destination)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	route, err := req.toRoute(destination)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if req.Label != "" {
+		err = h.rt.AddRouteWithLabel(r.Context(), req.Label, route)
+	} else {
+		err = h.rt.AddRoute(r.Context(), route)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toRouteJSON(route))
+}
+
+func (h *Handler) getRoute(w http.ResponseWriter, r *http.Request) {
+	destination, err := parseDestination(r.PathValue("destination"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	maybeRoute, err := h.rt.GetRoute(r.Context(), destination)
+	writeRoute(w, maybeRoute, err)
+}
+
+func (h *Handler) updateRoute(w http.ResponseWriter, r *http.Request) {
+	destination, err := parseDestination(r.PathValue("destination"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	req, err := decodeRouteRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	route, err := req.toRoute(destination)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	maybeUpdatedRoute, err := h.rt.UpdateRouteIfExists(r.Context(), route)
+	writeRoute(w, maybeUpdatedRoute, err)
+}
+
+func (h *Handler) removeRoute(w http.ResponseWriter, r *http.Request) {
+	destination, err := parseDestination(r.PathValue("destination"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	maybeRemovedRoute, err := h.rt.RemoveRoute(r.Context(), destination)
+	writeRoute(w, maybeRemovedRoute, err)
+}
+
+func (h *Handler) getRouteByLabel(w http.ResponseWriter, r *http.Request) {
+	writeRoute(w, h.rt.GetRouteByLabel(r.Context(), r.PathValue("label")), nil)
+}
+
+func (h *Handler) updateRouteByLabel(w http.ResponseWriter, r *http.Request) {
+	label := r.PathValue("label")
+	req, err := decodeRouteRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// the destination is given by the label on updating
+	route, err := req.toRoute(nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	maybeUpdatedRoute, err := h.rt.UpdateRouteByLabelIfExists(r.Context(), label, route.Gateway, route.NetworkInterface, route.Metric)
+	writeRoute(w, maybeUpdatedRoute, err)
+}
+
+func (h *Handler) removeRouteByLabel(w http.ResponseWriter, r *http.Request) {
+	maybeRemovedRoute, err := h.rt.RemoveRouteByLabel(r.Context(), r.PathValue("label"))
+	writeRoute(w, maybeRemovedRoute, err)
+}
+
+func (h *Handler) matchRoute(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.PathValue("ip"))
+	if ip == nil {
+		writeError(w, badRequestError{fmt.Errorf("invalid IP address => %q", r.PathValue("ip"))})
+		return
+	}
+	maybeRoute, err := h.rt.MatchRoute(r.Context(), ip)
+	writeRoute(w, maybeRoute, err)
+}
+
+func decodeRouteRequest(r *http.Request) (*RouteRequest, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	var req RouteRequest
+	if err := decoder.Decode(&req); err != nil {
+		return nil, badRequestError{fmt.Errorf("failed to decode the request body: %w", err)}
+	}
+	return &req, nil
+}
+
+func (req *RouteRequest) toRoute(destination *net.IPNet) (*iprtb.Route, error) {
+	var gateway net.IP
+	if req.Gateway != "" && req.Gateway != "<nil>" {
+		gateway = net.ParseIP(req.Gateway)
+		if gateway == nil {
+			return nil, badRequestError{fmt.Errorf("invalid gateway => %q", req.Gateway)}
+		}
+	}
+	return &iprtb.Route{
+		Destination:      destination,
+		Gateway:          gateway,
+		NetworkInterface: req.NetworkInterface,
+		Metric:           req.Metric,
+	}, nil
+}
+
+// toRouteJSON converts the route into iprtb.RouteJSON; a route that doesn't have a gateway is represented with an empty "gateway" property
+// as well as iprtb.RouteTableJSON.
+func toRouteJSON(route *iprtb.Route) *iprtb.RouteJSON {
+	gateway := ""
+	if route.Gateway != nil {
+		gateway = route.Gateway.String()
+	}
+	return &iprtb.RouteJSON{
+		Destination:      route.Destination.String(),
+		Gateway:          gateway,
+		NetworkInterface: route.NetworkInterface,
+		Metric:           route.Metric,
+	}
+}
+
+func parseDestination(destination string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(destination)
+	if err != nil {
+		return nil, badRequestError{fmt.Errorf("invalid destination => %q: %w", destination, err)}
+	}
+	return ipNet, nil
+}
+
+// badRequestError is the error that is caused by the invalid request.
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e badRequestError) Unwrap() error {
+	return e.err
+}
+
+func writeRoute(w http.ResponseWriter, maybeRoute optional.Option[iprtb.Route], err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if maybeRoute.IsNone() {
+		writeError(w, errRouteNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, toRouteJSON(maybeRoute.UnwrapAsPtr()))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var badRequest badRequestError
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytes):
+		status = http.StatusRequestEntityTooLarge
+	case errors.As(err, &badRequest), errors.Is(err, iprtb.ErrInvalidIPv6Length):
+		status = http.StatusBadRequest
+	case errors.Is(err, errRouteNotFound):
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, &ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(&ErrorResponse{Error: fmt.Sprintf("failed to marshal the response: %s", err)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(body, '\n'))
+}
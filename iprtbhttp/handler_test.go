@@ -0,0 +1,157 @@
+package iprtbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moznion/go-iprtb"
+	"github.com/stretchr/testify/assert"
+)
+
+func doRequest(t *testing.T, h http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, path, nil)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeRouteJSON(t *testing.T, rec *httptest.ResponseRecorder) *iprtb.RouteJSON {
+	var route iprtb.RouteJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &route))
+	return &route
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(iprtb.NewRouteTable())
+
+	rec := doRequest(t, h, http.MethodPost, "/routes", `{"destination":"192.0.2.0/24","gateway":"192.0.2.1","networkInterface":"ifb0","metric":1,"label":"net"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, &iprtb.RouteJSON{
+		Destination:      "192.0.2.0/24",
+		Gateway:          "192.0.2.1",
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	}, decodeRouteJSON(t, rec))
+
+	rec = doRequest(t, h, http.MethodPost, "/routes", `{"destination":"2001:db8::/32","networkInterface":"ifb1"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/routes", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var table iprtb.RouteTableJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &table))
+	assert.Len(t, table.Routes, 2)
+	assert.Equal(t, map[string]string{"net": "192.0.2.0/24"}, table.Labels)
+
+	rec = doRequest(t, h, http.MethodGet, "/routes/2001:db8::/32", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &iprtb.RouteJSON{
+		Destination:      "2001:db8::/32",
+		NetworkInterface: "ifb1",
+	}, decodeRouteJSON(t, rec))
+
+	rec = doRequest(t, h, http.MethodPut, "/routes/192.0.2.0/24", `{"gateway":"192.0.2.2","networkInterface":"ifb2","metric":2}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, h, http.MethodGet, "/labels/net", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &iprtb.RouteJSON{
+		Destination:      "192.0.2.0/24",
+		Gateway:          "192.0.2.2",
+		NetworkInterface: "ifb2",
+		Metric:           2,
+	}, decodeRouteJSON(t, rec))
+
+	rec = doRequest(t, h, http.MethodPut, "/labels/net", `{"gateway":"192.0.2.3","networkInterface":"ifb3","metric":3}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, h, http.MethodGet, "/match/192.0.2.100", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &iprtb.RouteJSON{
+		Destination:      "192.0.2.0/24",
+		Gateway:          "192.0.2.3",
+		NetworkInterface: "ifb3",
+		Metric:           3,
+	}, decodeRouteJSON(t, rec))
+
+	rec = doRequest(t, h, http.MethodDelete, "/labels/net", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "192.0.2.0/24", decodeRouteJSON(t, rec).Destination)
+	rec = doRequest(t, h, http.MethodDelete, "/routes/2001:db8::/32", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2001:db8::/32", decodeRouteJSON(t, rec).Destination)
+
+	rec = doRequest(t, h, http.MethodGet, "/routes", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &table))
+	assert.Empty(t, table.Routes)
+}
+
+func TestHandler_Errors(t *testing.T) {
+	h := NewHandler(iprtb.NewRouteTable())
+	rec := doRequest(t, h, http.MethodPost, "/routes", `{"destination":"192.0.2.0/24","networkInterface":"ifb0","label":"net"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"invalid destination on adding", http.MethodPost, "/routes", `{"destination":"192.0.2.0"}`, http.StatusBadRequest},
+		{"invalid gateway", http.MethodPost, "/routes", `{"destination":"198.51.100.0/24","gateway":"invalid"}`, http.StatusBadRequest},
+		{"unknown property", http.MethodPost, "/routes", `{"destination":"198.51.100.0/24","unknown":1}`, http.StatusBadRequest},
+		{"malformed body", http.MethodPost, "/routes", `{`, http.StatusBadRequest},
+		{"invalid destination on getting", http.MethodGet, "/routes/invalid", "", http.StatusBadRequest},
+		{"missing route", http.MethodGet, "/routes/198.51.100.0/24", "", http.StatusNotFound},
+		{"updating missing route", http.MethodPut, "/routes/198.51.100.0/24", `{"networkInterface":"ifb1"}`, http.StatusNotFound},
+		{"removing missing route", http.MethodDelete, "/routes/198.51.100.0/24", "", http.StatusNotFound},
+		{"missing label", http.MethodGet, "/labels/unknown", "", http.StatusNotFound},
+		{"updating missing label", http.MethodPut, "/labels/unknown", `{"networkInterface":"ifb1"}`, http.StatusNotFound},
+		{"removing missing label", http.MethodDelete, "/labels/unknown", "", http.StatusNotFound},
+		{"invalid IP address", http.MethodGet, "/match/invalid", "", http.StatusBadRequest},
+		{"unmatched IP address", http.MethodGet, "/match/198.51.100.1", "", http.StatusNotFound},
+		{"unsupported method", http.MethodPatch, "/routes", "", http.StatusMethodNotAllowed},
+		{"unknown path", http.MethodGet, "/unknown", "", http.StatusNotFound},
+		{"too large body", http.MethodPost, "/routes", `{"destination":"198.51.100.0/24","networkInterface":"` + strings.Repeat("x", MaxRequestBodySize) + `"}`, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := doRequest(t, h, tc.method, tc.path, tc.body)
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			var errResp ErrorResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errResp))
+			assert.NotEmpty(t, errResp.Error)
+		})
+	}
+
+	rec = doRequest(t, h, http.MethodPatch, "/routes/192.0.2.0/24", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "{\"error\":\"method not allowed\"}\n", rec.Body.String())
+	assert.Equal(t, "DELETE, GET, HEAD, PUT", rec.Header().Get("Allow"))
+}
+
+func TestHandler_WriteErrorWithInvalidIPv6Length(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, iprtb.ErrInvalidIPv6Length)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_WithStripPrefix(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/rtb/", http.StripPrefix("/rtb", NewHandler(iprtb.NewRouteTable())))
+
+	rec := doRequest(t, mux, http.MethodPost, "/rtb/routes", `{"destination":"192.0.2.0/24","networkInterface":"ifb0"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = doRequest(t, mux, http.MethodGet, "/rtb/match/192.0.2.1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ifb0", decodeRouteJSON(t, rec).NetworkInterface)
+}
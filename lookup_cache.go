@@ -0,0 +1,175 @@
+package iprtb
+
+import (
+	"container/list"
+	"context"
+	"hash/maphash"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// EnableLookupCache enables the bounded cache of the results of MatchRoute with given capacity (the number of target IP addresses).
+// If the capacity is zero or negative, this disables the cache. Calling this again discards the cached results.
+//
+// The cache is invalidated whenever the routing table is modified (e.g. AddRoute, RemoveRoute, UpdateRouteByLabel and ClearRoutes),
+// so MatchRoute always returns the same result as the one without the cache. This is suitable for the workload that
+// matches the same IP addresses repeatedly and modifies the routing table rarely.
+// The cache evicts the least recently used results approximately, and the large cache is sharded by the target IP address,
+// so the concurrent lookups don't serialize on a single lock.
+func (rt *RouteTable) EnableLookupCache(ctx context.Context, capacity int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if capacity <= 0 {
+		rt.lookupCache = nil
+		return
+	}
+	rt.lookupCache = newLookupCache(capacity)
+}
+
+const (
+	// lookupCacheShardCapacity is the minimum capacity per shard of the lookup cache; the small cache isn't sharded.
+	lookupCacheShardCapacity = 64
+	// maxLookupCacheShards is the maximum number of the shards of the lookup cache. This must be a power of two.
+	maxLookupCacheShards = 64
+)
+
+// lookupCache is a bounded cache that maps a target IP address to the matched node.
+// The cache is split into the shards by the hash of the target, and each shard has its own lock,
+// so the concurrent lookups for the different targets rarely contend with each other.
+// The capacity is shared by the shards; when the cache is full, a new entry evicts an entry of its shard
+// by the second chance algorithm that approximates LRU, so a cache hit only marks the entry as referenced under the read lock.
+type lookupCache struct {
+	capacity int64
+	size     atomic.Int64
+	shards   []*lookupCacheShard // the length is a power of two
+	seed     maphash.Seed
+}
+
+// lookupCacheShard is a shard of lookupCache. The shard remembers the generation of the routing table of the cached entries,
+// and all the entries are purged at once when a result of a newer generation is put into the shard.
+type lookupCacheShard struct {
+	generation uint64
+	entries    map[string]*list.Element
+	queue      *list.List // the front is the most recently put or referenced entry
+	mu         sync.RWMutex
+}
+
+type lookupCacheEntry struct {
+	key         string
+	matchedNode *node // nil means no route matched
+	referenced  atomic.Bool
+}
+
+func newLookupCache(capacity int) *lookupCache {
+	numOfShards := 1
+	for numOfShards < maxLookupCacheShards && capacity/(numOfShards*2) >= lookupCacheShardCapacity {
+		numOfShards *= 2
+	}
+
+	shards := make([]*lookupCacheShard, numOfShards)
+	for i := range shards {
+		shards[i] = &lookupCacheShard{
+			entries: make(map[string]*list.Element, capacity/numOfShards),
+			queue:   list.New(),
+		}
+	}
+	return &lookupCache{
+		capacity: int64(capacity),
+		shards:   shards,
+		seed:     maphash.MakeSeed(),
+	}
+}
+
+func (c *lookupCache) shard(target net.IP) *lookupCacheShard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[maphash.Bytes(c.seed, target)&uint64(len(c.shards)-1)]
+}
+
+// get returns the cached matched node for the target. The second return value is false if there is no valid cache entry.
+func (c *lookupCache) get(target net.IP, generation uint64) (*node, bool) {
+	s := c.shard(target)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.generation != generation {
+		return nil, false
+	}
+	elem, ok := s.entries[string(target)]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lookupCacheEntry)
+	if !entry.referenced.Load() { // avoid writing the shared memory on every hit
+		entry.referenced.Store(true)
+	}
+	return entry.matchedNode, true
+}
+
+func (c *lookupCache) put(target net.IP, matchedNode *node, generation uint64) {
+	s := c.shard(target)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.purgeIfStale(s, generation)
+
+	key := string(target)
+	if elem, ok := s.entries[key]; ok {
+		elem.Value.(*lookupCacheEntry).matchedNode = matchedNode
+		s.queue.MoveToFront(elem)
+		return
+	}
+
+	if c.size.Load() >= c.capacity {
+		if !c.evict(s) {
+			// the other shards occupy the whole capacity
+			return
+		}
+	}
+	s.entries[key] = s.queue.PushFront(&lookupCacheEntry{
+		key:         key,
+		matchedNode: matchedNode,
+	})
+	c.size.Add(1)
+}
+
+// evict evicts the oldest entry that isn't referenced since it was put or given the second chance.
+// This returns false if the shard has no entry. The caller must hold the lock of the shard.
+func (c *lookupCache) evict(s *lookupCacheShard) bool {
+	for elem := s.queue.Back(); elem != nil; elem = s.queue.Back() {
+		entry := elem.Value.(*lookupCacheEntry)
+		if entry.referenced.Load() {
+			// give the second chance; this terminates because every entry is moved at most once
+			entry.referenced.Store(false)
+			s.queue.MoveToFront(elem)
+			continue
+		}
+		s.queue.Remove(elem)
+		delete(s.entries, entry.key)
+		c.size.Add(-1)
+		return true
+	}
+	return false
+}
+
+// purgeIfStale purges all the entries of the shard if the given generation is newer than the one of the entries.
+// The caller must hold the lock of the shard.
+func (c *lookupCache) purgeIfStale(s *lookupCacheShard, generation uint64) {
+	if generation == s.generation {
+		return
+	}
+	s.generation = generation
+	if n := s.queue.Len(); n > 0 {
+		clear(s.entries)
+		s.queue.Init()
+		c.size.Add(-int64(n))
+	}
+}
+
+// len returns the number of the cached entries including the ones of the shards that are not purged yet.
+func (c *lookupCache) len() int {
+	return int(c.size.Load())
+}
@@ -0,0 +1,217 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTable_EnableLookupCache(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	rtb.EnableLookupCache(ctx, 2)
+
+	err := rtb.AddRouteWithLabel(ctx, "net", &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+	})
+	assert.NoError(t, err)
+
+	maybeMatchedRoute, err := rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 100))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.0/24", maybeMatchedRoute.Unwrap().Destination.String())
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+	assert.True(t, maybeMatchedRoute.IsNone())
+	assert.Equal(t, 2, rtb.lookupCache.len())
+
+	// cached results
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 100))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.0/24", maybeMatchedRoute.Unwrap().Destination.String())
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+	assert.True(t, maybeMatchedRoute.IsNone())
+
+	// AddRoute invalidates the cache
+	err = rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 100),
+			Mask: net.IPv4Mask(255, 255, 255, 255),
+		},
+		NetworkInterface: "ifb1",
+	})
+	assert.NoError(t, err)
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 100))
+	assert.NoError(t, err)
+	assert.Equal(t, "ifb1", maybeMatchedRoute.Unwrap().NetworkInterface)
+
+	// UpdateRouteByLabel invalidates the cache
+	err = rtb.UpdateRouteByLabel(ctx, "net", net.IPv4(192, 0, 2, 2), "ifb0", 1)
+	assert.NoError(t, err)
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.2", maybeMatchedRoute.Unwrap().Gateway.String())
+
+	// RemoveRoute invalidates the cache
+	_, err = rtb.RemoveRoute(ctx, &net.IPNet{
+		IP:   net.IPv4(192, 0, 2, 100),
+		Mask: net.IPv4Mask(255, 255, 255, 255),
+	})
+	assert.NoError(t, err)
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 100))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.0/24", maybeMatchedRoute.Unwrap().Destination.String())
+
+	// ClearRoutes invalidates the cache
+	rtb.ClearRoutes(ctx)
+	maybeMatchedRoute, err = rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 100))
+	assert.NoError(t, err)
+	assert.True(t, maybeMatchedRoute.IsNone())
+
+	rtb.EnableLookupCache(ctx, 0)
+	assert.Nil(t, rtb.lookupCache)
+}
+
+func TestRouteTable_EnableLookupCache_WithHitCounters(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	rtb.EnableLookupCache(ctx, 16)
+	rtb.EnableHitCounters(ctx, true)
+
+	err := rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		NetworkInterface: "ifb0",
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := rtb.MatchRoute(ctx, net.IPv4(192, 0, 2, 1))
+		assert.NoError(t, err)
+		_, err = rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+		assert.NoError(t, err)
+	}
+
+	counters := rtb.HitCounters(ctx)
+	assert.Equal(t, uint64(3), counters.Routes[0].Hits)
+	assert.Equal(t, uint64(3), counters.Misses)
+}
+
+func TestLookupCache_Eviction(t *testing.T) {
+	c := newLookupCache(2)
+	n1, n2, n3 := &node{}, &node{}, &node{}
+
+	c.put(net.IPv4(192, 0, 2, 1).To4(), n1, 0)
+	c.put(net.IPv4(192, 0, 2, 2).To4(), n2, 0)
+	_, ok := c.get(net.IPv4(192, 0, 2, 1).To4(), 0) // 192.0.2.1 becomes the most recently used
+	assert.True(t, ok)
+	c.put(net.IPv4(192, 0, 2, 3).To4(), n3, 0)
+
+	assert.Equal(t, 2, c.len())
+	_, ok = c.get(net.IPv4(192, 0, 2, 2).To4(), 0)
+	assert.False(t, ok)
+	cached, ok := c.get(net.IPv4(192, 0, 2, 1).To4(), 0)
+	assert.True(t, ok)
+	assert.Same(t, n1, cached)
+	cached, ok = c.get(net.IPv4(192, 0, 2, 3).To4(), 0)
+	assert.True(t, ok)
+	assert.Same(t, n3, cached)
+
+	// the entries of an old generation are stale, and putting a result of a newer generation purges all of them
+	_, ok = c.get(net.IPv4(192, 0, 2, 3).To4(), 1)
+	assert.False(t, ok)
+	c.put(net.IPv4(192, 0, 2, 3).To4(), n3, 1)
+	assert.Equal(t, 1, c.len())
+	cached, ok = c.get(net.IPv4(192, 0, 2, 3).To4(), 1)
+	assert.True(t, ok)
+	assert.Same(t, n3, cached)
+	_, ok = c.get(net.IPv4(192, 0, 2, 1).To4(), 1)
+	assert.False(t, ok)
+}
+
+func TestLookupCache_Sharding(t *testing.T) {
+	assert.Len(t, newLookupCache(lookupCacheShardCapacity).shards, 1)
+	assert.Len(t, newLookupCache(2*lookupCacheShardCapacity).shards, 2)
+	assert.Len(t, newLookupCache(1000000).shards, maxLookupCacheShards)
+
+	// the shards share the capacity, so all the entries are cached regardless of the distribution over the shards
+	c := newLookupCache(1000)
+	assert.Len(t, c.shards, 8)
+	nodes := make([]*node, 1000)
+	for i := range nodes {
+		nodes[i] = &node{}
+		c.put(net.IPv4(192, 0, byte(i>>8), byte(i)).To4(), nodes[i], 0)
+	}
+	assert.Equal(t, 1000, c.len())
+	for i := range nodes {
+		cached, ok := c.get(net.IPv4(192, 0, byte(i>>8), byte(i)).To4(), 0)
+		assert.True(t, ok)
+		assert.Same(t, nodes[i], cached)
+	}
+
+	// a new entry evicts an entry of its shard
+	c.put(net.IPv4(198, 51, 100, 1).To4(), &node{}, 0)
+	assert.Equal(t, 1000, c.len())
+
+	// a newer generation purges the entries shard by shard
+	c.put(net.IPv4(198, 51, 100, 1).To4(), &node{}, 1)
+	assert.Less(t, c.len(), 1000)
+	assert.Greater(t, c.len(), 1)
+}
+
+func BenchmarkRouteTable_MatchRoute(b *testing.B) {
+	ctx := context.Background()
+	rtb := newBenchmarkRouteTable(b, 100000)
+	targets := make([]net.IP, 1000)
+	for i := range targets {
+		targets[i] = net.IPv4(10, 0, byte(i>>8), byte(i))
+	}
+
+	b.Run("without cache", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rtb.MatchRoute(ctx, targets[i%len(targets)])
+		}
+	})
+
+	rtb.EnableLookupCache(ctx, len(targets))
+	b.Run("with cache", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rtb.MatchRoute(ctx, targets[i%len(targets)])
+		}
+	})
+}
+
+func BenchmarkRouteTable_MatchRoute_Parallel(b *testing.B) {
+	ctx := context.Background()
+	rtb := newBenchmarkRouteTable(b, 100000)
+	targets := make([]net.IP, 1000)
+	for i := range targets {
+		targets[i] = net.IPv4(10, 0, byte(i>>8), byte(i))
+	}
+	matchRoutesInParallel := func(b *testing.B) {
+		var workerID atomic.Uint64
+		b.RunParallel(func(pb *testing.PB) {
+			i := int(workerID.Add(1)) * 97 // each worker starts from the different target
+			for pb.Next() {
+				_, _ = rtb.MatchRoute(ctx, targets[i%len(targets)])
+				i++
+			}
+		})
+	}
+
+	b.Run("without cache", matchRoutesInParallel)
+	rtb.EnableLookupCache(ctx, len(targets))
+	b.Run("with cache", matchRoutesInParallel)
+}
@@ -0,0 +1,448 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/moznion/go-optional"
+)
+
+// the MRT types and subtypes (RFC 6396 and RFC 8050)
+const (
+	mrtTypeTableDumpV2 = 13
+
+	mrtSubtypePeerIndexTable        = 1
+	mrtSubtypeRIBIPv4Unicast        = 2
+	mrtSubtypeRIBIPv6Unicast        = 4
+	mrtSubtypeRIBIPv4UnicastAddPath = 8
+	mrtSubtypeRIBIPv6UnicastAddPath = 10
+)
+
+// the BGP path attribute types and flags (RFC 4271 and RFC 4760)
+const (
+	bgpAttrFlagExtendedLength = 0x10
+
+	bgpAttrTypeNextHop       = 3
+	bgpAttrTypeMultiExitDisc = 4
+	bgpAttrTypeMPReachNLRI   = 14
+)
+
+const mrtHeaderLen = 12
+
+// maxMRTRecordLen is the upper limit of the length of a MRT record, to prevent a corrupted length from allocating a huge buffer.
+const maxMRTRecordLen = 1 << 26
+
+// ErrInvalidMRT represents the error that indicates given data is not valid as MRT TABLE_DUMP_V2.
+var ErrInvalidMRT = errors.New("invalid MRT TABLE_DUMP_V2 data")
+
+// MRTPeer is a peer entry of the PEER_INDEX_TABLE of MRT TABLE_DUMP_V2.
+type MRTPeer struct {
+	BGPID net.IP
+	IP    net.IP
+	AS    uint32
+}
+
+// MRTRIBEntry is a RIB entry of MRT TABLE_DUMP_V2; that represents a route which a peer advertised.
+// NextHop is extracted from NEXT_HOP attribute or the next hop of MP_REACH_NLRI attribute, and MultiExitDisc is extracted from
+// MULTI_EXIT_DISC attribute.
+type MRTRIBEntry struct {
+	Peer           *MRTPeer
+	OriginatedTime time.Time
+	PathID         optional.Option[uint32]
+	NextHop        net.IP
+	MultiExitDisc  optional.Option[uint32]
+}
+
+// MRTRIBRecord is a RIB_IPV4_UNICAST or RIB_IPV6_UNICAST record of MRT TABLE_DUMP_V2; that has the routes to the prefix from each peer.
+type MRTRIBRecord struct {
+	SequenceNumber uint32
+	Prefix         *net.IPNet
+	Entries        []*MRTRIBEntry
+}
+
+// MRTReader reads the RIB records from MRT TABLE_DUMP_V2 data (e.g. RouteViews and RIPE RIS RIB dumps) in streaming.
+// This holds only a record at once, so that it is capable to read the huge dumps.
+// The returned records don't refer to the internal buffer, so they are still valid after the next read.
+type MRTReader struct {
+	r     io.Reader
+	buf   []byte
+	peers []*MRTPeer
+}
+
+// NewMRTReader makes a new MRTReader that reads from the given reader.
+// If the dump is compressed (e.g. bzip2 or gzip), please give the decompressing reader.
+func NewMRTReader(r io.Reader) *MRTReader {
+	return &MRTReader{
+		r: r,
+	}
+}
+
+// Next reads the next RIB_IPV4_UNICAST or RIB_IPV6_UNICAST record (including their ADDPATH variants).
+// The other records are skipped, except the PEER_INDEX_TABLE that is used to resolve the peer of each RIB entry.
+// This returns io.EOF when it reaches the end of the data.
+func (mr *MRTReader) Next() (*MRTRIBRecord, error) {
+	for {
+		var header [mrtHeaderLen]byte
+		if _, err := io.ReadFull(mr.r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to read MRT header: %w", unexpectedEOF(err))
+		}
+
+		timestamp := binary.BigEndian.Uint32(header[0:4])
+		mrtType := binary.BigEndian.Uint16(header[4:6])
+		subtype := binary.BigEndian.Uint16(header[6:8])
+		length := binary.BigEndian.Uint32(header[8:12])
+		if length > maxMRTRecordLen {
+			return nil, fmt.Errorf("too long MRT record => %d bytes: %w", length, ErrInvalidMRT)
+		}
+
+		if uint32(cap(mr.buf)) < length {
+			mr.buf = make([]byte, length)
+		}
+		body := mr.buf[:length]
+		if _, err := io.ReadFull(mr.r, body); err != nil {
+			return nil, fmt.Errorf("failed to read MRT record: %w", unexpectedEOF(err))
+		}
+
+		if mrtType != mrtTypeTableDumpV2 {
+			continue
+		}
+
+		switch subtype {
+		case mrtSubtypePeerIndexTable:
+			peers, err := parseMRTPeerIndexTable(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse PEER_INDEX_TABLE: %w", err)
+			}
+			mr.peers = peers
+		case mrtSubtypeRIBIPv4Unicast, mrtSubtypeRIBIPv6Unicast, mrtSubtypeRIBIPv4UnicastAddPath, mrtSubtypeRIBIPv6UnicastAddPath:
+			if mr.peers == nil {
+				return nil, fmt.Errorf("RIB record appears before PEER_INDEX_TABLE: %w", ErrInvalidMRT)
+			}
+			ipLen := net.IPv4len
+			if subtype == mrtSubtypeRIBIPv6Unicast || subtype == mrtSubtypeRIBIPv6UnicastAddPath {
+				ipLen = net.IPv6len
+			}
+			isAddPath := subtype == mrtSubtypeRIBIPv4UnicastAddPath || subtype == mrtSubtypeRIBIPv6UnicastAddPath
+			record, err := mr.parseRIB(body, ipLen, isAddPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse RIB record (timestamp => %d): %w", timestamp, err)
+			}
+			return record, nil
+		}
+	}
+}
+
+func parseMRTPeerIndexTable(body []byte) ([]*MRTPeer, error) {
+	d := &bytesDecoder{b: body}
+
+	d.skip(4) // collector BGP ID
+	viewNameLen := d.uint16()
+	d.skip(int(viewNameLen))
+	peerCount := d.uint16()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	peers := make([]*MRTPeer, 0, peerCount)
+	for i := 0; i < int(peerCount); i++ {
+		peerType := d.uint8()
+		bgpID := net.IP(bytes.Clone(d.bytes(4)))
+
+		ipLen := net.IPv4len
+		if peerType&0x01 != 0 {
+			ipLen = net.IPv6len
+		}
+		ip := net.IP(bytes.Clone(d.bytes(ipLen)))
+
+		var as uint32
+		if peerType&0x02 != 0 {
+			as = d.uint32()
+		} else {
+			as = uint32(d.uint16())
+		}
+		if d.err != nil {
+			return nil, fmt.Errorf("peer entry[%d]: %w", i, d.err)
+		}
+
+		peers = append(peers, &MRTPeer{
+			BGPID: bgpID,
+			IP:    ip,
+			AS:    as,
+		})
+	}
+
+	return peers, nil
+}
+
+func (mr *MRTReader) parseRIB(body []byte, ipLen int, isAddPath bool) (*MRTRIBRecord, error) {
+	d := &bytesDecoder{b: body}
+
+	sequenceNumber := d.uint32()
+	prefix, err := d.prefix(ipLen, ErrInvalidMRT)
+	if err != nil {
+		return nil, err
+	}
+	entryCount := d.uint16()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	entries := make([]*MRTRIBEntry, 0, entryCount)
+	for i := 0; i < int(entryCount); i++ {
+		peerIndex := d.uint16()
+		originatedTime := d.uint32()
+		pathID := optional.None[uint32]()
+		if isAddPath {
+			pathID = optional.Some[uint32](d.uint32())
+		}
+		attrLen := d.uint16()
+		attrs := d.bytes(int(attrLen))
+		if d.err != nil {
+			return nil, fmt.Errorf("RIB entry[%d] of %s: %w", i, prefix, d.err)
+		}
+		if int(peerIndex) >= len(mr.peers) {
+			return nil, fmt.Errorf("RIB entry[%d] of %s refers to the unknown peer index => %d: %w", i, prefix, peerIndex, ErrInvalidMRT)
+		}
+
+		nextHop, med, err := parseMRTBGPAttributes(attrs)
+		if err != nil {
+			return nil, fmt.Errorf("RIB entry[%d] of %s: %w", i, prefix, err)
+		}
+
+		entries = append(entries, &MRTRIBEntry{
+			Peer:           mr.peers[peerIndex],
+			OriginatedTime: time.Unix(int64(originatedTime), 0),
+			PathID:         pathID,
+			NextHop:        nextHop,
+			MultiExitDisc:  med,
+		})
+	}
+
+	return &MRTRIBRecord{
+		SequenceNumber: sequenceNumber,
+		Prefix:         prefix,
+		Entries:        entries,
+	}, nil
+}
+
+// parseMRTBGPAttributes extracts the next hop and MULTI_EXIT_DISC from the BGP path attributes of MRT RIB entry.
+// NOTE: MP_REACH_NLRI attribute in MRT RIB entry is abbreviated; that only has the next hop length and the next hop (RFC 6396 section 4.3.4).
+func parseMRTBGPAttributes(attrs []byte) (net.IP, optional.Option[uint32], error) {
+	var nextHop net.IP
+	med := optional.None[uint32]()
+
+	err := forEachBGPAttribute(attrs, func(attrType byte, value []byte) error {
+		switch attrType {
+		case bgpAttrTypeNextHop:
+			if len(value) != net.IPv4len {
+				return fmt.Errorf("invalid NEXT_HOP length => %d: %w", len(value), ErrInvalidMRT)
+			}
+			if nextHop == nil {
+				nextHop = net.IP(bytes.Clone(value))
+			}
+		case bgpAttrTypeMultiExitDisc:
+			if len(value) != 4 {
+				return fmt.Errorf("invalid MULTI_EXIT_DISC length => %d: %w", len(value), ErrInvalidMRT)
+			}
+			med = optional.Some[uint32](binary.BigEndian.Uint32(value))
+		case bgpAttrTypeMPReachNLRI:
+			if len(value) < 1 || int(value[0]) > len(value)-1 {
+				return fmt.Errorf("invalid MP_REACH_NLRI: %w", ErrInvalidMRT)
+			}
+			mpNextHop, err := mpReachNextHop(value[1:1+int(value[0])], ErrInvalidMRT)
+			if err != nil {
+				return err
+			}
+			nextHop = mpNextHop // MP_REACH_NLRI takes precedence over NEXT_HOP
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, optional.None[uint32](), err
+	}
+
+	return nextHop, med, nil
+}
+
+// mpReachNextHop extracts the next hop address from the next hop field of MP_REACH_NLRI.
+// If the field has both of global and link-local IPv6 addresses (RFC 2545), this returns the global one.
+// If the length of the field is unsupported, this returns an error that wraps errInvalid.
+func mpReachNextHop(b []byte, errInvalid error) (net.IP, error) {
+	switch len(b) {
+	case net.IPv4len, net.IPv6len:
+		return net.IP(bytes.Clone(b)), nil
+	case 2 * net.IPv6len:
+		return net.IP(bytes.Clone(b[:net.IPv6len])), nil
+	default:
+		return nil, fmt.Errorf("unsupported next hop length of MP_REACH_NLRI => %d: %w", len(b), errInvalid)
+	}
+}
+
+// forEachBGPAttribute calls the given function with the type and value of each BGP path attribute.
+func forEachBGPAttribute(attrs []byte, f func(attrType byte, value []byte) error) error {
+	d := &bytesDecoder{b: attrs}
+	for d.remaining() > 0 {
+		flags := d.uint8()
+		attrType := d.uint8()
+		var length int
+		if flags&bgpAttrFlagExtendedLength != 0 {
+			length = int(d.uint16())
+		} else {
+			length = int(d.uint8())
+		}
+		value := d.bytes(length)
+		if d.err != nil {
+			return fmt.Errorf("broken BGP path attribute (type => %d): %w", attrType, d.err)
+		}
+		if err := f(attrType, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadMRTRIB reads the RIB records from MRT TABLE_DUMP_V2 data in streaming and adds them to the routing table as routes.
+// This returns the number of the added routes.
+//
+// selectEntry chooses the RIB entry that is used as the route of the prefix from the RIB entries that each peer advertised;
+// if that returns nil, the prefix is skipped. If selectEntry is nil, the first RIB entry that has the next hop is chosen.
+// The next hop of the chosen entry is mapped to Gateway and MULTI_EXIT_DISC is mapped to Metric.
+// The routes are added in batches, so if this returns an error, the routes that were read before the error may have been added.
+func (rt *RouteTable) LoadMRTRIB(ctx context.Context, r io.Reader, selectEntry func(record *MRTRIBRecord) *MRTRIBEntry) (int, error) {
+	if selectEntry == nil {
+		selectEntry = selectFirstMRTRIBEntry
+	}
+
+	const batchSize = 4096
+	batch := make(Routes, 0, batchSize)
+	numOfAdded := 0
+
+	mr := NewMRTReader(r)
+	for {
+		record, err := mr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return numOfAdded, fmt.Errorf("failed to load MRT RIB: %w", err)
+		}
+
+		entry := selectEntry(record)
+		if entry == nil {
+			continue
+		}
+		batch = append(batch, &Route{
+			Destination: record.Prefix,
+			Gateway:     entry.NextHop,
+			Metric:      int(entry.MultiExitDisc.TakeOr(0)),
+		})
+
+		if len(batch) >= batchSize {
+			if err := rt.AddRoutes(ctx, batch); err != nil {
+				return numOfAdded, fmt.Errorf("failed to load MRT RIB: %w", err)
+			}
+			numOfAdded += len(batch)
+			batch = batch[:0]
+		}
+	}
+
+	if err := rt.AddRoutes(ctx, batch); err != nil {
+		return numOfAdded, fmt.Errorf("failed to load MRT RIB: %w", err)
+	}
+	numOfAdded += len(batch)
+
+	return numOfAdded, nil
+}
+
+func selectFirstMRTRIBEntry(record *MRTRIBRecord) *MRTRIBEntry {
+	for _, entry := range record.Entries {
+		if entry.NextHop != nil {
+			return entry
+		}
+	}
+	return nil
+}
+
+// bytesDecoder is a helper to decode the big-endian binary data. Once it fails, it keeps the error and the following operations do nothing.
+type bytesDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *bytesDecoder) remaining() int {
+	return len(d.b)
+}
+
+func (d *bytesDecoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.b) {
+		d.err = fmt.Errorf("insufficient data; want %d bytes but has %d bytes: %w", n, len(d.b), io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := d.b[:n:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *bytesDecoder) skip(n int) {
+	d.bytes(n)
+}
+
+func (d *bytesDecoder) uint8() byte {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *bytesDecoder) uint16() uint16 {
+	b := d.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *bytesDecoder) uint32() uint32 {
+	b := d.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// prefix decodes the prefix that is encoded as the prefix length (1 byte) and the minimum bytes of the address.
+// If the prefix length exceeds the address length, this returns an error that wraps errInvalid.
+func (d *bytesDecoder) prefix(ipLen int, errInvalid error) (*net.IPNet, error) {
+	prefixLen := int(d.uint8())
+	if d.err != nil {
+		return nil, d.err
+	}
+	if prefixLen > 8*ipLen {
+		return nil, fmt.Errorf("invalid prefix length => %d: %w", prefixLen, errInvalid)
+	}
+	b := d.bytes((prefixLen + 7) / 8)
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	ip := make(net.IP, ipLen)
+	copy(ip, b)
+	mask := net.CIDRMask(prefixLen, 8*ipLen)
+	return &net.IPNet{
+		IP:   ip.Mask(mask),
+		Mask: mask,
+	}, nil
+}
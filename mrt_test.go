@@ -0,0 +1,193 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildMRTRecord(mrtType uint16, subtype uint16, body []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 1700000000)
+	b = binary.BigEndian.AppendUint16(b, mrtType)
+	b = binary.BigEndian.AppendUint16(b, subtype)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(body)))
+	return append(b, body...)
+}
+
+func buildMRTPeerIndexTable() []byte {
+	b := []byte{192, 0, 2, 100}                                                  // collector BGP ID
+	b = binary.BigEndian.AppendUint16(b, 4)                                      // view name length
+	b = append(b, "test"...)                                                     // view name
+	b = binary.BigEndian.AppendUint16(b, 2)                                      // peer count
+	b = append(b, 0x02)                                                          // peer type: IPv4 and 4 bytes AS
+	b = append(b, 192, 0, 2, 1)                                                  // peer BGP ID
+	b = append(b, 192, 0, 2, 1)                                                  // peer IP
+	b = binary.BigEndian.AppendUint32(b, 4200000000)                             // peer AS
+	b = append(b, 0x01)                                                          // peer type: IPv6 and 2 bytes AS
+	b = append(b, 192, 0, 2, 2)                                                  // peer BGP ID
+	b = append(b, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x02) // peer IP
+	b = binary.BigEndian.AppendUint16(b, 64500)                                  // peer AS
+	return b
+}
+
+type mrtTestRIBEntry struct {
+	peerIndex uint16
+	attrs     []byte
+}
+
+func buildMRTRIB(prefixLen byte, prefix []byte, entries ...mrtTestRIBEntry) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 0) // sequence number
+	b = append(b, prefixLen)
+	b = append(b, prefix...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = binary.BigEndian.AppendUint16(b, e.peerIndex)
+		b = binary.BigEndian.AppendUint32(b, 1700000000) // originated time
+		b = binary.BigEndian.AppendUint16(b, uint16(len(e.attrs)))
+		b = append(b, e.attrs...)
+	}
+	return b
+}
+
+var (
+	mrtTestOriginAttr  = []byte{0x40, 1, 1, 0}                               // ORIGIN: IGP
+	mrtTestASPathAttr  = []byte{0x50, 2, 0, 6, 2, 1, 0xfa, 0x56, 0xea, 0x00} // AS_PATH (extended length): AS_SEQUENCE [4200000000]
+	mrtTestNextHopAttr = []byte{0x40, 3, 4, 192, 0, 2, 1}                    // NEXT_HOP: 192.0.2.1
+	mrtTestMEDAttr     = []byte{0x80, 4, 4, 0, 0, 0, 100}                    // MULTI_EXIT_DISC: 100
+	mrtTestMPReachAttr = append([]byte{0x80, 14, 33, 32},                    // MP_REACH_NLRI (abbreviated): global and link-local next hops
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x02,
+		0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x02)
+)
+
+func buildMRTTestDump() []byte {
+	var dump []byte
+	dump = append(dump, buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypePeerIndexTable, buildMRTPeerIndexTable())...)
+	dump = append(dump, buildMRTRecord(16, 4, []byte{0, 1, 2, 3})...) // BGP4MP record must be skipped
+	dump = append(dump, buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypeRIBIPv4Unicast, buildMRTRIB(24, []byte{198, 51, 100},
+		mrtTestRIBEntry{peerIndex: 0, attrs: bytes.Join([][]byte{mrtTestOriginAttr, mrtTestASPathAttr, mrtTestNextHopAttr, mrtTestMEDAttr}, nil)},
+	))...)
+	dump = append(dump, buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypeRIBIPv4Unicast, buildMRTRIB(0, nil,
+		mrtTestRIBEntry{peerIndex: 0, attrs: mrtTestOriginAttr}, // no next hop
+		mrtTestRIBEntry{peerIndex: 0, attrs: bytes.Join([][]byte{mrtTestOriginAttr, mrtTestNextHopAttr}, nil)},
+	))...)
+	dump = append(dump, buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypeRIBIPv6Unicast, buildMRTRIB(32, []byte{0x20, 0x01, 0x0d, 0xb8},
+		mrtTestRIBEntry{peerIndex: 1, attrs: bytes.Join([][]byte{mrtTestOriginAttr, mrtTestMPReachAttr}, nil)},
+	))...)
+	return dump
+}
+
+func TestMRTReader(t *testing.T) {
+	mr := NewMRTReader(bytes.NewReader(buildMRTTestDump()))
+
+	record, err := mr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "198.51.100.0/24", record.Prefix.String())
+	assert.Len(t, record.Entries, 1)
+	assert.Equal(t, "192.0.2.1", record.Entries[0].NextHop.String())
+	assert.Equal(t, uint32(100), record.Entries[0].MultiExitDisc.Unwrap())
+	assert.True(t, record.Entries[0].PathID.IsNone())
+	assert.Equal(t, uint32(4200000000), record.Entries[0].Peer.AS)
+	assert.Equal(t, "192.0.2.1", record.Entries[0].Peer.IP.String())
+	assert.Equal(t, int64(1700000000), record.Entries[0].OriginatedTime.Unix())
+
+	record, err = mr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0/0", record.Prefix.String())
+	assert.Len(t, record.Entries, 2)
+	assert.Nil(t, record.Entries[0].NextHop)
+	assert.Equal(t, "192.0.2.1", record.Entries[1].NextHop.String())
+	assert.True(t, record.Entries[1].MultiExitDisc.IsNone())
+
+	record, err = mr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::/32", record.Prefix.String())
+	assert.Len(t, record.Entries, 1)
+	assert.Equal(t, "2001:db8::2", record.Entries[0].NextHop.String())
+	assert.Equal(t, uint32(64500), record.Entries[0].Peer.AS)
+	assert.Equal(t, "2001:db8::2", record.Entries[0].Peer.IP.String())
+
+	_, err = mr.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestMRTReader_Invalid(t *testing.T) {
+	t.Run("RIB before PEER_INDEX_TABLE", func(t *testing.T) {
+		dump := buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypeRIBIPv4Unicast, buildMRTRIB(24, []byte{198, 51, 100}))
+		_, err := NewMRTReader(bytes.NewReader(dump)).Next()
+		assert.ErrorIs(t, err, ErrInvalidMRT)
+	})
+
+	t.Run("unknown peer index", func(t *testing.T) {
+		dump := buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypePeerIndexTable, buildMRTPeerIndexTable())
+		dump = append(dump, buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypeRIBIPv4Unicast, buildMRTRIB(24, []byte{198, 51, 100},
+			mrtTestRIBEntry{peerIndex: 2, attrs: mrtTestNextHopAttr},
+		))...)
+		_, err := NewMRTReader(bytes.NewReader(dump)).Next()
+		assert.ErrorIs(t, err, ErrInvalidMRT)
+	})
+
+	t.Run("invalid prefix length", func(t *testing.T) {
+		dump := buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypePeerIndexTable, buildMRTPeerIndexTable())
+		dump = append(dump, buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypeRIBIPv4Unicast, buildMRTRIB(33, []byte{198, 51, 100, 0, 0}))...)
+		_, err := NewMRTReader(bytes.NewReader(dump)).Next()
+		assert.ErrorIs(t, err, ErrInvalidMRT)
+	})
+
+	t.Run("broken attribute", func(t *testing.T) {
+		dump := buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypePeerIndexTable, buildMRTPeerIndexTable())
+		dump = append(dump, buildMRTRecord(mrtTypeTableDumpV2, mrtSubtypeRIBIPv4Unicast, buildMRTRIB(24, []byte{198, 51, 100},
+			mrtTestRIBEntry{peerIndex: 0, attrs: []byte{0x40, 3, 4, 192, 0}},
+		))...)
+		_, err := NewMRTReader(bytes.NewReader(dump)).Next()
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		dump := buildMRTTestDump()
+		for i := 1; i < len(dump); i++ {
+			mr := NewMRTReader(bytes.NewReader(dump[:i]))
+			var err error
+			for err == nil {
+				_, err = mr.Next()
+			}
+			if !errors.Is(err, io.EOF) {
+				assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "length => %d", i)
+			}
+		}
+	})
+}
+
+func TestRouteTable_LoadMRTRIB(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	numOfAdded, err := rtb.LoadMRTRIB(ctx, bytes.NewReader(buildMRTTestDump()), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, numOfAdded)
+
+	maybeMatchedRoute, err := rtb.MatchRoute(ctx, net.IPv4(198, 51, 100, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "198.51.100.0/24", maybeMatchedRoute.Unwrap().Destination.String())
+	assert.Equal(t, "192.0.2.1", maybeMatchedRoute.Unwrap().Gateway.String())
+	assert.Equal(t, 100, maybeMatchedRoute.Unwrap().Metric)
+
+	// the selector can skip the prefix
+	rtb = NewRouteTable()
+	numOfAdded, err = rtb.LoadMRTRIB(ctx, bytes.NewReader(buildMRTTestDump()), func(record *MRTRIBRecord) *MRTRIBEntry {
+		for _, entry := range record.Entries {
+			if entry.Peer.AS == 64500 {
+				return entry
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numOfAdded)
+	assert.Equal(t, "2001:db8::/32	2001:db8::2		0\n", rtb.DumpRouteTable(ctx).String())
+}
@@ -0,0 +1,181 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"slices"
+)
+
+// NextHopState is the health state of a next hop (i.e. a gateway).
+type NextHopState int
+
+const (
+	// NextHopUp means the next hop is reachable. This is the initial state of every next hop.
+	NextHopUp NextHopState = iota
+	// NextHopDown means the next hop is unreachable, so the routes via that are skipped on matching.
+	NextHopDown
+)
+
+func (s NextHopState) String() string {
+	switch s {
+	case NextHopUp:
+		return "up"
+	case NextHopDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// SetNextHopState sets the health state of the next hop.
+//
+// While a next hop is down, MatchRoute, MatchAddr, MatchRoutes, MatchAddrs and FindRoute skip the routes via that gateway
+// and fall back to the less-specific covering route, without removing the routes from the routing table.
+// (A destination has a single route in the routing table, so there is no other candidate for the same prefix.)
+// Bringing the next hop up again restores the original selection.
+// The state is kept regardless of the mutations of the routes, e.g. adding a route via a down next hop and ClearRoutes.
+func (rt *RouteTable) SetNextHopState(ctx context.Context, gateway net.IP, state NextHopState) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	key := nextHopKey(gateway)
+	_, isDown := rt.downNextHops[key]
+	if isDown == (state == NextHopDown) {
+		return
+	}
+
+	if state == NextHopDown {
+		if rt.downNextHops == nil {
+			rt.downNextHops = map[string]struct{}{}
+		}
+		rt.downNextHops[key] = struct{}{}
+	} else {
+		delete(rt.downNextHops, key)
+	}
+	rt.generation++ // the cached results can be changed
+}
+
+// NextHopState returns the health state of the next hop.
+func (rt *RouteTable) NextHopState(ctx context.Context, gateway net.IP) NextHopState {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	if _, isDown := rt.downNextHops[nextHopKey(gateway)]; isDown {
+		return NextHopDown
+	}
+	return NextHopUp
+}
+
+// DownNextHops returns the next hops that are marked as down. The result is ordered by the address family (IPv4 comes first) and the address.
+func (rt *RouteTable) DownNextHops(ctx context.Context) []net.IP {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	gateways := make([]net.IP, 0, len(rt.downNextHops))
+	for key := range rt.downNextHops {
+		gateways = append(gateways, net.IP(key))
+	}
+	slices.SortFunc(gateways, func(a net.IP, b net.IP) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return slices.Compare(a, b)
+	})
+	return gateways
+}
+
+// InterfaceState is the state of a network interface.
+type InterfaceState int
+
+const (
+	// InterfaceUp means the network interface is up. This is the initial state of every network interface.
+	InterfaceUp InterfaceState = iota
+	// InterfaceDown means the network interface is down, so the routes on that are skipped on matching.
+	InterfaceDown
+)
+
+func (s InterfaceState) String() string {
+	switch s {
+	case InterfaceUp:
+		return "up"
+	case InterfaceDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// SetInterfaceState sets the state of the network interface.
+//
+// While a network interface is down, the routes on that are skipped on matching as well as the routes via a down next hop
+// (please refer also to SetNextHopState), without removing the routes from the routing table.
+// Use RemoveRoutesByInterface to remove them instead.
+func (rt *RouteTable) SetInterfaceState(ctx context.Context, nwInterface string, state InterfaceState) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	_, isDown := rt.downInterfaces[nwInterface]
+	if isDown == (state == InterfaceDown) {
+		return
+	}
+
+	if state == InterfaceDown {
+		if rt.downInterfaces == nil {
+			rt.downInterfaces = map[string]struct{}{}
+		}
+		rt.downInterfaces[nwInterface] = struct{}{}
+	} else {
+		delete(rt.downInterfaces, nwInterface)
+	}
+	rt.generation++ // the cached results can be changed
+}
+
+// InterfaceState returns the state of the network interface.
+func (rt *RouteTable) InterfaceState(ctx context.Context, nwInterface string) InterfaceState {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	if _, isDown := rt.downInterfaces[nwInterface]; isDown {
+		return InterfaceDown
+	}
+	return InterfaceUp
+}
+
+// DownInterfaces returns the network interfaces that are marked as down in the lexical order.
+func (rt *RouteTable) DownInterfaces(ctx context.Context) []string {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	nwInterfaces := make([]string, 0, len(rt.downInterfaces))
+	for nwInterface := range rt.downInterfaces {
+		nwInterfaces = append(nwInterfaces, nwInterface)
+	}
+	slices.Sort(nwInterfaces)
+	return nwInterfaces
+}
+
+// isRouteUsable returns false if the route is via a next hop or on a network interface that is marked as down. The caller must hold the lock.
+func (rt *RouteTable) isRouteUsable(route *Route) bool {
+	if len(rt.downInterfaces) != 0 && route.NetworkInterface != "" {
+		if _, isDown := rt.downInterfaces[route.NetworkInterface]; isDown {
+			return false
+		}
+	}
+	if len(rt.downNextHops) == 0 || route.Gateway == nil {
+		return true
+	}
+	_, isDown := rt.downNextHops[string(canonicalNextHop(route.Gateway))] // this doesn't allocate unlike nextHopKey
+	return !isDown
+}
+
+func nextHopKey(gateway net.IP) string {
+	return string(canonicalNextHop(gateway))
+}
+
+// canonicalNextHop returns the 4 bytes representation for IPv4 address, or the given address as is.
+func canonicalNextHop(gateway net.IP) net.IP {
+	if ipv4 := gateway.To4(); ipv4 != nil {
+		return ipv4
+	}
+	return gateway
+}
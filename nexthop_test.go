@@ -0,0 +1,149 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTable_SetNextHopState(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	rtb.EnableLookupCache(ctx, 16)
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader(`
+default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth0
+10.1.0.0/16 via 192.0.2.3 dev eth0
+10.1.2.0/24 dev eth1
+2001:db8::/32 via 2001:db8::1 dev eth2
+`)))
+
+	matchedGateway := func(target string) string {
+		maybeRoute, err := rtb.MatchRoute(ctx, net.ParseIP(target))
+		assert.NoError(t, err)
+
+		// the other lookups agree with MatchRoute
+		route, ok := rtb.MatchAddr(ctx, netip.MustParseAddr(target))
+		assert.Equal(t, maybeRoute.IsSome(), ok)
+		if ok {
+			assert.Equal(t, maybeRoute.Unwrap(), route)
+		}
+		results, err := rtb.MatchRoutes(ctx, []net.IP{net.ParseIP(target)}, BatchMatchOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, maybeRoute, results[0])
+		found, err := rtb.FindRoute(ctx, net.ParseIP(target))
+		assert.NoError(t, err)
+		assert.Equal(t, maybeRoute.IsSome(), found)
+
+		if maybeRoute.IsNone() {
+			return "none"
+		}
+		return maybeRoute.Unwrap().Gateway.String()
+	}
+
+	assert.Equal(t, "192.0.2.3", matchedGateway("10.1.1.1"))
+	assert.Equal(t, NextHopUp, rtb.NextHopState(ctx, net.IPv4(192, 0, 2, 3)))
+
+	// falls back to the less-specific covering route
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 3), NextHopDown)
+	assert.Equal(t, NextHopDown, rtb.NextHopState(ctx, net.IPv4(192, 0, 2, 3).To4()))
+	assert.Equal(t, "192.0.2.2", matchedGateway("10.1.1.1"))
+	assert.Equal(t, "<nil>", matchedGateway("10.1.2.1")) // not affected
+
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 2), NextHopDown)
+	assert.Equal(t, "192.0.2.1", matchedGateway("10.1.1.1"))
+
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 1), NextHopDown)
+	assert.Equal(t, "none", matchedGateway("10.1.1.1"))
+	assert.Equal(t, "2001:db8::1", matchedGateway("2001:db8::2"))
+
+	rtb.SetNextHopState(ctx, net.ParseIP("2001:db8::1"), NextHopDown)
+	assert.Equal(t, "none", matchedGateway("2001:db8::2"))
+	assert.Equal(t, []net.IP{
+		net.IPv4(192, 0, 2, 1).To4(),
+		net.IPv4(192, 0, 2, 2).To4(),
+		net.IPv4(192, 0, 2, 3).To4(),
+		net.ParseIP("2001:db8::1"),
+	}, rtb.DownNextHops(ctx))
+
+	// the routes are not removed
+	assert.Equal(t, 5, rtb.Len(ctx))
+
+	// bringing the next hops up restores the original selection
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 3), NextHopUp)
+	assert.Equal(t, "192.0.2.3", matchedGateway("10.1.1.1"))
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 1), NextHopUp)
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 1), NextHopUp) // does nothing
+	rtb.SetNextHopState(ctx, net.IPv4(192, 0, 2, 2), NextHopUp)
+	rtb.SetNextHopState(ctx, net.ParseIP("2001:db8::1"), NextHopUp)
+	assert.Empty(t, rtb.DownNextHops(ctx))
+	assert.Equal(t, "2001:db8::1", matchedGateway("2001:db8::2"))
+
+	// the state is kept for the routes that are added later
+	rtb.SetNextHopState(ctx, net.IPv4(198, 51, 100, 1), NextHopDown)
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader("10.1.1.0/24 via 198.51.100.1 dev eth3\n")))
+	assert.Equal(t, "192.0.2.3", matchedGateway("10.1.1.1"))
+}
+
+func TestNextHopState_String(t *testing.T) {
+	assert.Equal(t, "up", NextHopUp.String())
+	assert.Equal(t, "down", NextHopDown.String())
+	assert.Equal(t, "unknown", NextHopState(-1).String())
+}
+
+func TestRouteTable_SetInterfaceState(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	rtb.EnableLookupCache(ctx, 16)
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader(`
+default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth1
+10.1.0.0/16 dev eth2
+10.1.2.0/24 via 192.0.2.3
+`)))
+
+	matchedDestination := func(target string) string {
+		maybeRoute, err := rtb.MatchRoute(ctx, net.ParseIP(target))
+		assert.NoError(t, err)
+		route, ok := rtb.MatchAddr(ctx, netip.MustParseAddr(target))
+		assert.Equal(t, maybeRoute.IsSome(), ok)
+		if maybeRoute.IsNone() {
+			return "none"
+		}
+		assert.Equal(t, maybeRoute.Unwrap(), route)
+		return maybeRoute.Unwrap().Destination.String()
+	}
+
+	assert.Equal(t, "10.1.0.0/16", matchedDestination("10.1.1.1"))
+
+	rtb.SetInterfaceState(ctx, "eth2", InterfaceDown)
+	assert.Equal(t, InterfaceDown, rtb.InterfaceState(ctx, "eth2"))
+	assert.Equal(t, "10.0.0.0/8", matchedDestination("10.1.1.1"))
+	assert.Equal(t, "10.1.2.0/24", matchedDestination("10.1.2.1")) // without the network interface
+
+	rtb.SetInterfaceState(ctx, "eth1", InterfaceDown)
+	rtb.SetInterfaceState(ctx, "eth0", InterfaceDown)
+	assert.Equal(t, "none", matchedDestination("10.1.1.1"))
+	assert.Equal(t, []string{"eth0", "eth1", "eth2"}, rtb.DownInterfaces(ctx))
+	assert.Equal(t, 4, rtb.Len(ctx))
+
+	rtb.SetInterfaceState(ctx, "eth0", InterfaceUp)
+	assert.Equal(t, "0.0.0.0/0", matchedDestination("10.1.1.1"))
+	rtb.SetInterfaceState(ctx, "eth1", InterfaceUp)
+	rtb.SetInterfaceState(ctx, "eth2", InterfaceUp)
+	assert.Equal(t, InterfaceUp, rtb.InterfaceState(ctx, "eth2"))
+	assert.Empty(t, rtb.DownInterfaces(ctx))
+	assert.Equal(t, "10.1.0.0/16", matchedDestination("10.1.1.1"))
+}
+
+func TestInterfaceState_String(t *testing.T) {
+	assert.Equal(t, "up", InterfaceUp.String())
+	assert.Equal(t, "down", InterfaceDown.String())
+	assert.Equal(t, "unknown", InterfaceState(-1).String())
+}
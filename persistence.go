@@ -0,0 +1,606 @@
+package iprtb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/moznion/go-optional"
+)
+
+// DefaultSnapshotThreshold is the default number of the logged mutations that triggers a snapshot of PersistentRouteTable.
+const DefaultSnapshotThreshold = 10000
+
+// ErrCorruptedWAL represents the error that indicates the write-ahead log is corrupted other than a torn write at the tail.
+var ErrCorruptedWAL = errors.New("write-ahead log is corrupted")
+
+// errTornWALRecord represents the error that indicates the record of the write-ahead log is incomplete or zero-filled, i.e. torn by a crash on appending that.
+var errTornWALRecord = errors.New("write-ahead log record is torn")
+
+// ErrPersistentRouteTableClosed represents the error that indicates the PersistentRouteTable has already been closed.
+var ErrPersistentRouteTableClosed = errors.New("persistent routing table has already been closed")
+
+// PersistenceOptions is the options of OpenPersistentRouteTable.
+type PersistenceOptions struct {
+	// SnapshotThreshold is the number of the logged mutations that triggers a snapshot and the compaction of the write-ahead log.
+	// Zero means DefaultSnapshotThreshold, and a negative value disables the automatic snapshot (Snapshot can still be called explicitly).
+	SnapshotThreshold int
+	// NoSync disables fsync on every mutation. This makes the mutations faster, but the recent mutations can be lost
+	// on a crash of the OS (a crash of the process doesn't lose them).
+	NoSync bool
+}
+
+// PersistentRouteTable is a RouteTable that survives restarts by a write-ahead log and snapshots in a directory.
+//
+// Every mutation through this type is appended to the write-ahead log (and synced unless PersistenceOptions.NoSync) before
+// it is applied to the routing table. When the number of the logged mutations reaches PersistenceOptions.SnapshotThreshold,
+// the routing table is written as the binary snapshot of RouteTable.WriteTo and the log is compacted.
+// OpenPersistentRouteTable recovers the routing table from the latest snapshot and the log; a record that is torn by a crash
+// at the tail of the log is discarded.
+//
+// If the automatic snapshot fails, the mutation that triggered it still succeeds because it has already been logged and applied.
+// The snapshot is retried on the following mutations, and the last failure is returned by Close unless a later snapshot succeeds.
+//
+// Read the routes through RouteTable. The mutations that are applied to RouteTable directly are NOT persisted.
+type PersistentRouteTable struct {
+	rt                *RouteTable
+	dir               string
+	opts              PersistenceOptions
+	seq               uint64   // the sequence number of the current snapshot and write-ahead log
+	wal               *os.File // nil after Close
+	walSize           int64    // the size of the write-ahead log that consists of the complete records
+	numOfLogged       int      // the number of the logged mutations since the current snapshot
+	snapshotThreshold int
+	snapshotErr       error // the last failure of the automatic snapshot
+	mu                sync.Mutex
+}
+
+const (
+	walOpAddRoute byte = iota + 1
+	walOpAddRouteWithLabel
+	walOpUpdateRouteByLabel
+	walOpRemoveRoute
+	walOpRemoveRouteByLabel
+	walOpClearRoutes
+)
+
+const (
+	snapshotFilePrefix = "snapshot-"
+	walFilePrefix      = "wal-"
+	tmpFileSuffix      = ".tmp"
+	walRecordHeaderLen = 8       // payload length (4 bytes) and CRC-32C of the payload (4 bytes), big endian
+	maxWALRecordLen    = 1 << 20 // to prevent a corrupted length from allocating a huge buffer
+)
+
+// OpenPersistentRouteTable opens the persistent routing table in the directory, and recovers the routes and labels from that.
+// If the directory doesn't exist, this creates it and the routing table is empty.
+//
+// The directory has "snapshot-<seq>" that is the snapshot of the routing table and "wal-<seq>" that is the write-ahead log
+// of the mutations after that snapshot. The files of the older sequence numbers are removed on the snapshot.
+func OpenPersistentRouteTable(ctx context.Context, dir string, opts PersistenceOptions) (*PersistentRouteTable, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the directory for the persistent routing table: %w", err)
+	}
+
+	snapshotSeqs, walSeqs, err := listPersistenceFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PersistentRouteTable{
+		rt:                NewRouteTable(),
+		dir:               dir,
+		opts:              opts,
+		snapshotThreshold: opts.SnapshotThreshold,
+	}
+	if p.snapshotThreshold == 0 {
+		p.snapshotThreshold = DefaultSnapshotThreshold
+	}
+
+	if len(snapshotSeqs) > 0 {
+		p.seq = snapshotSeqs[len(snapshotSeqs)-1]
+		if err := p.loadSnapshot(); err != nil {
+			return nil, err
+		}
+	}
+
+	walSeqs = slices.DeleteFunc(walSeqs, func(seq uint64) bool {
+		return seq < p.seq
+	})
+	for i, seq := range walSeqs {
+		numOfReplayed, err := p.replayWAL(ctx, seq, i == len(walSeqs)-1)
+		if err != nil {
+			return nil, err
+		}
+		p.numOfLogged += numOfReplayed
+	}
+	if len(walSeqs) > 0 {
+		p.seq = walSeqs[len(walSeqs)-1]
+	}
+
+	p.wal, err = os.OpenFile(p.walPath(p.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the write-ahead log: %w", err)
+	}
+	stat, err := p.wal.Stat()
+	if err != nil {
+		_ = p.wal.Close()
+		return nil, fmt.Errorf("failed to stat the write-ahead log: %w", err)
+	}
+	p.walSize = stat.Size()
+	if err := syncDir(dir); err != nil {
+		_ = p.wal.Close()
+		return nil, err
+	}
+	p.removeObsoleteFiles()
+	return p, nil
+}
+
+// RouteTable returns the routing table to read the routes. Please don't mutate it directly because such mutations are not persisted.
+func (p *PersistentRouteTable) RouteTable() *RouteTable {
+	return p.rt
+}
+
+// AddRoute logs and does RouteTable.AddRoute.
+func (p *PersistentRouteTable) AddRoute(ctx context.Context, route *Route) error {
+	if err := validateDestination(route.Destination); err != nil {
+		return fmt.Errorf("invalid destination on adding a route => %s: %w", route.Destination, err)
+	}
+	return p.mutate(ctx, func(sw *snapshotWriter) {
+		sw.write([]byte{walOpAddRoute})
+		sw.writeRoute(route)
+	}, func() error {
+		return p.rt.AddRoute(ctx, route)
+	})
+}
+
+// AddRouteWithLabel logs and does RouteTable.AddRouteWithLabel.
+func (p *PersistentRouteTable) AddRouteWithLabel(ctx context.Context, label string, route *Route) error {
+	if err := validateDestination(route.Destination); err != nil {
+		return fmt.Errorf("invalid destination on adding a route => %s: %w", route.Destination, err)
+	}
+	return p.mutate(ctx, func(sw *snapshotWriter) {
+		sw.write([]byte{walOpAddRouteWithLabel})
+		sw.writeString(label)
+		sw.writeRoute(route)
+	}, func() error {
+		return p.rt.AddRouteWithLabel(ctx, label, route)
+	})
+}
+
+// UpdateRouteByLabel logs and does RouteTable.UpdateRouteByLabel.
+func (p *PersistentRouteTable) UpdateRouteByLabel(ctx context.Context, label string, gateway net.IP, nwInterface string, metric int) error {
+	return p.mutate(ctx, func(sw *snapshotWriter) {
+		sw.write([]byte{walOpUpdateRouteByLabel})
+		sw.writeString(label)
+		sw.writeRouteAttributes(gateway, nwInterface, metric)
+	}, func() error {
+		return p.rt.UpdateRouteByLabel(ctx, label, gateway, nwInterface, metric)
+	})
+}
+
+// RemoveRoute logs and does RouteTable.RemoveRoute.
+func (p *PersistentRouteTable) RemoveRoute(ctx context.Context, destination *net.IPNet) (optional.Option[Route], error) {
+	if err := validateDestination(destination); err != nil {
+		return optional.None[Route](), fmt.Errorf("invalid destination on removing a route => %s: %w", destination, err)
+	}
+	var maybeRemovedRoute optional.Option[Route]
+	err := p.mutate(ctx, func(sw *snapshotWriter) {
+		sw.write([]byte{walOpRemoveRoute})
+		sw.writeDestination(destination)
+	}, func() error {
+		var err error
+		maybeRemovedRoute, err = p.rt.RemoveRoute(ctx, destination)
+		return err
+	})
+	return maybeRemovedRoute, err
+}
+
+// RemoveRouteByLabel logs and does RouteTable.RemoveRouteByLabel.
+func (p *PersistentRouteTable) RemoveRouteByLabel(ctx context.Context, label string) (optional.Option[Route], error) {
+	var maybeRemovedRoute optional.Option[Route]
+	err := p.mutate(ctx, func(sw *snapshotWriter) {
+		sw.write([]byte{walOpRemoveRouteByLabel})
+		sw.writeString(label)
+	}, func() error {
+		var err error
+		maybeRemovedRoute, err = p.rt.RemoveRouteByLabel(ctx, label)
+		return err
+	})
+	return maybeRemovedRoute, err
+}
+
+// ClearRoutes logs and does RouteTable.ClearRoutes.
+func (p *PersistentRouteTable) ClearRoutes(ctx context.Context) error {
+	return p.mutate(ctx, func(sw *snapshotWriter) {
+		sw.write([]byte{walOpClearRoutes})
+	}, func() error {
+		p.rt.ClearRoutes(ctx)
+		return nil
+	})
+}
+
+// Snapshot writes the snapshot of the routing table and compacts the write-ahead log.
+// This is called automatically according to PersistenceOptions.SnapshotThreshold.
+func (p *PersistentRouteTable) Snapshot(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.wal == nil {
+		return ErrPersistentRouteTableClosed
+	}
+	if err := p.snapshot(); err != nil {
+		return err
+	}
+	p.snapshotErr = nil
+	return nil
+}
+
+// Close closes the write-ahead log. The routing table that is returned by RouteTable is still readable after this.
+// If the last automatic snapshot has failed, this returns that error after closing.
+func (p *PersistentRouteTable) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.wal == nil {
+		return ErrPersistentRouteTableClosed
+	}
+	err := p.wal.Close()
+	p.wal = nil
+	if err != nil {
+		return fmt.Errorf("failed to close the write-ahead log: %w", err)
+	}
+	if p.snapshotErr != nil {
+		return fmt.Errorf("the last automatic snapshot has failed: %w", p.snapshotErr)
+	}
+	return nil
+}
+
+// mutate appends the record that is encoded by encode to the write-ahead log, and then applies the mutation by apply.
+// The record is validated by the encoder before appending, so that the log never has a record that can't be replayed.
+func (p *PersistentRouteTable) mutate(ctx context.Context, encode func(sw *snapshotWriter), apply func() error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.wal == nil {
+		return ErrPersistentRouteTableClosed
+	}
+
+	var payload bytes.Buffer
+	sw := &snapshotWriter{
+		w:    bufio.NewWriter(&payload),
+		hash: crc32.New(snapshotCRCTable),
+	}
+	encode(sw)
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	if sw.err != nil {
+		return fmt.Errorf("failed to encode a write-ahead log record: %w", sw.err)
+	}
+
+	record := make([]byte, walRecordHeaderLen, walRecordHeaderLen+payload.Len())
+	binary.BigEndian.PutUint32(record[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(record[4:8], sw.hash.Sum32())
+	record = append(record, payload.Bytes()...)
+	if _, err := p.wal.Write(record); err != nil {
+		p.discardIncompleteRecord()
+		return fmt.Errorf("failed to append a record to the write-ahead log: %w", err)
+	}
+	if !p.opts.NoSync {
+		if err := p.wal.Sync(); err != nil {
+			p.discardIncompleteRecord()
+			return fmt.Errorf("failed to sync the write-ahead log: %w", err)
+		}
+	}
+	p.walSize += int64(len(record))
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	p.numOfLogged++
+	if p.snapshotThreshold > 0 && p.numOfLogged >= p.snapshotThreshold {
+		// the mutation has been persisted by the log, so the failure of the snapshot doesn't fail the mutation
+		p.snapshotErr = p.snapshot()
+	}
+	return nil
+}
+
+// discardIncompleteRecord truncates the record that failed to be appended, so that the following records are not regarded as torn ones
+// on the recovery. If that fails, this closes the write-ahead log to reject the following mutations. The caller must hold the lock.
+func (p *PersistentRouteTable) discardIncompleteRecord() {
+	if err := p.wal.Truncate(p.walSize); err != nil {
+		_ = p.wal.Close()
+		p.wal = nil
+	}
+}
+
+// snapshot writes "snapshot-<seq+1>" and switches the write-ahead log to "wal-<seq+1>", and then removes the older files.
+// A crash at any point leaves the files that recover the same routing table. The caller must hold the lock.
+func (p *PersistentRouteTable) snapshot() error {
+	nextSeq := p.seq + 1
+
+	snapshotPath := p.snapshotPath(nextSeq)
+	f, err := os.OpenFile(snapshotPath+tmpFileSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create a snapshot: %w", err)
+	}
+	if _, err := p.rt.WriteTo(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync a snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close a snapshot: %w", err)
+	}
+	if err := os.Rename(snapshotPath+tmpFileSuffix, snapshotPath); err != nil {
+		return fmt.Errorf("failed to rename a snapshot: %w", err)
+	}
+
+	// the new snapshot must be removed on the following failures, or the recovery ignores the mutations that are logged after this
+	wal, err := os.OpenFile(p.walPath(nextSeq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		_ = os.Remove(snapshotPath)
+		return fmt.Errorf("failed to create the write-ahead log: %w", err)
+	}
+	if err := syncDir(p.dir); err != nil {
+		_ = wal.Close()
+		_ = os.Remove(snapshotPath)
+		_ = os.Remove(p.walPath(nextSeq))
+		return err
+	}
+
+	_ = p.wal.Close()
+	p.wal = wal
+	p.walSize = 0
+	p.seq = nextSeq
+	p.numOfLogged = 0
+	p.removeObsoleteFiles()
+	return nil
+}
+
+func (p *PersistentRouteTable) loadSnapshot() error {
+	f, err := os.Open(p.snapshotPath(p.seq))
+	if err != nil {
+		return fmt.Errorf("failed to open the snapshot: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if _, err := p.rt.ReadFrom(f); err != nil {
+		return fmt.Errorf("failed to load the snapshot => %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// replayWAL applies the records of the write-ahead log to the routing table, and returns the number of the applied records.
+// If isLast is true, an incomplete record, a zero-filled tail, or a final record that has the checksum mismatch is regarded as
+// a torn write by a crash, so the log is truncated there. Any other broken record is never regarded as a torn write,
+// and this returns ErrCorruptedWAL for that.
+func (p *PersistentRouteTable) replayWAL(ctx context.Context, seq uint64, isLast bool) (int, error) {
+	path := p.walPath(seq)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the write-ahead log: %w", err)
+	}
+
+	numOfReplayed := 0
+	offset := 0
+	for offset < len(data) {
+		payload, err := readWALRecord(data[offset:])
+		if err != nil {
+			if !isLast || !errors.Is(err, errTornWALRecord) {
+				return 0, fmt.Errorf("%s at offset %d: %w", path, offset, err)
+			}
+			if err := truncateFile(path, int64(offset)); err != nil {
+				return 0, err
+			}
+			break
+		}
+		if err := p.applyWALRecord(ctx, payload); err != nil {
+			return 0, fmt.Errorf("failed to apply the record of %s at offset %d: %w", path, offset, err)
+		}
+		offset += walRecordHeaderLen + len(payload)
+		numOfReplayed++
+	}
+	return numOfReplayed, nil
+}
+
+func readWALRecord(data []byte) ([]byte, error) {
+	if len(data) < walRecordHeaderLen {
+		return nil, fmt.Errorf("incomplete record header: %w: %w", errTornWALRecord, ErrCorruptedWAL)
+	}
+	length := binary.BigEndian.Uint32(data[0:4])
+	if length == 0 {
+		// every record has the operation at least, so the empty record is the zero-filled tail that a crash leaves
+		// when the file size has been updated but the data has not been written yet
+		if isZeroFilled(data) {
+			return nil, fmt.Errorf("zero-filled record: %w: %w", errTornWALRecord, ErrCorruptedWAL)
+		}
+		return nil, fmt.Errorf("empty record: %w", ErrCorruptedWAL)
+	}
+	if length > maxWALRecordLen {
+		return nil, fmt.Errorf("too long record; length => %d: %w", length, ErrCorruptedWAL)
+	}
+	if int(length) > len(data)-walRecordHeaderLen {
+		return nil, fmt.Errorf("incomplete record; length => %d: %w: %w", length, errTornWALRecord, ErrCorruptedWAL)
+	}
+	payload := data[walRecordHeaderLen : walRecordHeaderLen+int(length)]
+	if crc32.Checksum(payload, snapshotCRCTable) != binary.BigEndian.Uint32(data[4:8]) {
+		if walRecordHeaderLen+int(length) == len(data) {
+			// the final record can be partially written by a crash, even though the file has the whole length of that
+			return nil, fmt.Errorf("checksum mismatch of the final record: %w: %w", errTornWALRecord, ErrCorruptedWAL)
+		}
+		return nil, fmt.Errorf("checksum mismatch: %w", ErrCorruptedWAL)
+	}
+	return payload, nil
+}
+
+func isZeroFilled(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *PersistentRouteTable) applyWALRecord(ctx context.Context, payload []byte) error {
+	sr := newSnapshotReader(bytes.NewReader(payload))
+	op, err := sr.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case walOpAddRoute:
+		route, err := sr.readRoute()
+		if err != nil {
+			return err
+		}
+		return p.rt.AddRoute(ctx, route)
+	case walOpAddRouteWithLabel:
+		label, err := sr.readString()
+		if err != nil {
+			return err
+		}
+		route, err := sr.readRoute()
+		if err != nil {
+			return err
+		}
+		return p.rt.AddRouteWithLabel(ctx, label, route)
+	case walOpUpdateRouteByLabel:
+		label, err := sr.readString()
+		if err != nil {
+			return err
+		}
+		gateway, nwInterface, metric, err := sr.readRouteAttributes()
+		if err != nil {
+			return err
+		}
+		return p.rt.UpdateRouteByLabel(ctx, label, gateway, nwInterface, metric)
+	case walOpRemoveRoute:
+		destination, err := sr.readDestination()
+		if err != nil {
+			return err
+		}
+		_, err = p.rt.RemoveRoute(ctx, destination)
+		return err
+	case walOpRemoveRouteByLabel:
+		label, err := sr.readString()
+		if err != nil {
+			return err
+		}
+		_, err = p.rt.RemoveRouteByLabel(ctx, label)
+		return err
+	case walOpClearRoutes:
+		p.rt.ClearRoutes(ctx)
+		return nil
+	default:
+		return fmt.Errorf("unknown operation => %d: %w", op, ErrCorruptedWAL)
+	}
+}
+
+// removeObsoleteFiles removes the snapshots and the write-ahead logs that are older than the current sequence number
+// and the temporary files. This is best effort because the obsolete files don't affect the recovery.
+func (p *PersistentRouteTable) removeObsoleteFiles() {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, tmpFileSuffix) {
+			_ = os.Remove(filepath.Join(p.dir, name))
+			continue
+		}
+		if seq, ok := parsePersistenceFileSeq(name, snapshotFilePrefix); ok && seq < p.seq {
+			_ = os.Remove(filepath.Join(p.dir, name))
+		}
+		if seq, ok := parsePersistenceFileSeq(name, walFilePrefix); ok && seq < p.seq {
+			_ = os.Remove(filepath.Join(p.dir, name))
+		}
+	}
+}
+
+func (p *PersistentRouteTable) snapshotPath(seq uint64) string {
+	return filepath.Join(p.dir, fmt.Sprintf("%s%020d", snapshotFilePrefix, seq))
+}
+
+func (p *PersistentRouteTable) walPath(seq uint64) string {
+	return filepath.Join(p.dir, fmt.Sprintf("%s%020d", walFilePrefix, seq))
+}
+
+// listPersistenceFiles returns the sequence numbers of the snapshots and the write-ahead logs in the directory in ascending order.
+func listPersistenceFiles(dir string) ([]uint64, []uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the directory for the persistent routing table: %w", err)
+	}
+
+	var snapshotSeqs, walSeqs []uint64
+	for _, entry := range entries {
+		if seq, ok := parsePersistenceFileSeq(entry.Name(), snapshotFilePrefix); ok {
+			snapshotSeqs = append(snapshotSeqs, seq)
+		}
+		if seq, ok := parsePersistenceFileSeq(entry.Name(), walFilePrefix); ok {
+			walSeqs = append(walSeqs, seq)
+		}
+	}
+	slices.Sort(snapshotSeqs)
+	slices.Sort(walSeqs)
+	return snapshotSeqs, walSeqs, nil
+}
+
+func parsePersistenceFileSeq(name string, prefix string) (uint64, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimPrefix(name, prefix), 10, 64)
+	return seq, err == nil
+}
+
+func truncateFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open the write-ahead log to truncate the torn record: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate the torn record of the write-ahead log: %w", err)
+	}
+	return f.Sync()
+}
+
+// syncDir syncs the directory to make the creation and the renaming of the files in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open the directory to sync: %w", err)
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return fmt.Errorf("failed to sync the directory: %w", err)
+	}
+	return nil
+}
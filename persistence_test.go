@@ -0,0 +1,432 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// persistenceTestMutations returns the mutations that cover all kinds of the write-ahead log records.
+func persistenceTestMutations() []func(ctx context.Context, p *PersistentRouteTable) error {
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	_, v4Host, _ := net.ParseCIDR("192.0.2.100/32")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	_, defaultRoute, _ := net.ParseCIDR("0.0.0.0/0")
+
+	return []func(ctx context.Context, p *PersistentRouteTable) error{
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			return p.AddRoute(ctx, &Route{Destination: defaultRoute, Gateway: net.IPv4(192, 0, 2, 1), NetworkInterface: "eth0"})
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			return p.AddRouteWithLabel(ctx, "v4", &Route{Destination: v4, NetworkInterface: "eth1", Metric: 10})
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			return p.AddRouteWithLabel(ctx, "v6", &Route{Destination: v6, Gateway: net.ParseIP("2001:db8::1"), NetworkInterface: "eth2", Metric: -1})
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			return p.UpdateRouteByLabel(ctx, "v4", net.IPv4(192, 0, 2, 254), "eth3", 20)
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			return p.AddRoute(ctx, &Route{Destination: v4Host, NetworkInterface: "eth4"})
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			_, err := p.RemoveRouteByLabel(ctx, "v6")
+			return err
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			_, err := p.RemoveRoute(ctx, v4Host)
+			return err
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			return p.ClearRoutes(ctx)
+		},
+		func(ctx context.Context, p *PersistentRouteTable) error {
+			return p.AddRouteWithLabel(ctx, "v6", &Route{Destination: v6, NetworkInterface: "eth5"})
+		},
+	}
+}
+
+// persistenceTestState is the comparable state of the routing table.
+type persistenceTestState struct {
+	routes string
+	labels map[string]string
+}
+
+func persistenceStateOf(ctx context.Context, rt *RouteTable) persistenceTestState {
+	labels := map[string]string{}
+	for label, destination := range rt.Labels(ctx) {
+		labels[label] = destination.String()
+	}
+	return persistenceTestState{
+		routes: rt.DumpRouteTable(ctx).String(),
+		labels: labels,
+	}
+}
+
+func TestPersistentRouteTable(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "rtb")
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, p.RouteTable().Len(ctx))
+
+	for _, mutate := range persistenceTestMutations() {
+		assert.NoError(t, mutate(ctx, p))
+
+		// every mutation is recovered without closing, as well as a crash of the process
+		recovered, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, persistenceStateOf(ctx, p.RouteTable()), persistenceStateOf(ctx, recovered.RouteTable()))
+		assert.NoError(t, recovered.Close())
+	}
+	assert.NoError(t, p.Close())
+
+	p, err = OpenPersistentRouteTable(ctx, dir, PersistenceOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::/32\t<nil>\teth5\t0\n", p.RouteTable().DumpRouteTable(ctx).String())
+	assert.Equal(t, "2001:db8::/32", p.RouteTable().Labels(ctx)["v6"].String())
+	assert.NoError(t, p.Close())
+}
+
+func TestPersistentRouteTable_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: 3, NoSync: true})
+	assert.NoError(t, err)
+	for _, mutate := range persistenceTestMutations()[:7] {
+		assert.NoError(t, mutate(ctx, p))
+	}
+	expected := persistenceStateOf(ctx, p.RouteTable())
+	assert.NoError(t, p.Close())
+
+	// 7 mutations => 2 snapshots and 1 logged mutation
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	assert.Equal(t, []string{"snapshot-00000000000000000002", "wal-00000000000000000002"}, names)
+	walStat, err := os.Stat(filepath.Join(dir, "wal-00000000000000000002"))
+	assert.NoError(t, err)
+	assert.NotZero(t, walStat.Size())
+
+	p, err = OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, persistenceStateOf(ctx, p.RouteTable()))
+
+	// explicit snapshot
+	assert.NoError(t, p.Snapshot(ctx))
+	walStat, err = os.Stat(filepath.Join(dir, "wal-00000000000000000003"))
+	assert.NoError(t, err)
+	assert.Zero(t, walStat.Size())
+	assert.NoError(t, p.Close())
+
+	p, err = OpenPersistentRouteTable(ctx, dir, PersistenceOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, persistenceStateOf(ctx, p.RouteTable()))
+	assert.NoError(t, p.Close())
+}
+
+func TestPersistentRouteTable_RecoverFromTruncatedLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: -1})
+	assert.NoError(t, err)
+
+	walPath := filepath.Join(dir, "wal-00000000000000000000")
+	walSizes := []int64{0}
+	states := []persistenceTestState{persistenceStateOf(ctx, p.RouteTable())}
+	for _, mutate := range persistenceTestMutations() {
+		assert.NoError(t, mutate(ctx, p))
+		stat, err := os.Stat(walPath)
+		assert.NoError(t, err)
+		walSizes = append(walSizes, stat.Size())
+		states = append(states, persistenceStateOf(ctx, p.RouteTable()))
+	}
+	assert.NoError(t, p.Close())
+
+	wal, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+
+	// a crash at any point of writing the log recovers the state of the last complete record
+	for size := int64(0); size <= int64(len(wal)); size++ {
+		crashedDir := t.TempDir()
+		crashedWALPath := filepath.Join(crashedDir, "wal-00000000000000000000")
+		assert.NoError(t, os.WriteFile(crashedWALPath, wal[:size], 0o644))
+
+		numOfCompleteRecords := 0
+		for i, walSize := range walSizes {
+			if walSize <= size {
+				numOfCompleteRecords = i
+			}
+		}
+
+		recovered, err := OpenPersistentRouteTable(ctx, crashedDir, PersistenceOptions{})
+		assert.NoError(t, err, "size => %d", size)
+		assert.Equal(t, states[numOfCompleteRecords], persistenceStateOf(ctx, recovered.RouteTable()), "size => %d", size)
+
+		// the torn record is truncated, so the following mutations are recovered as well
+		stat, err := os.Stat(crashedWALPath)
+		assert.NoError(t, err)
+		assert.Equal(t, walSizes[numOfCompleteRecords], stat.Size(), "size => %d", size)
+		assert.NoError(t, recovered.AddRoute(ctx, &Route{
+			Destination:      &net.IPNet{IP: net.IPv4(198, 51, 100, 0), Mask: net.CIDRMask(24, 32)},
+			NetworkInterface: "eth9",
+		}))
+		expected := persistenceStateOf(ctx, recovered.RouteTable())
+		assert.NoError(t, recovered.Close())
+
+		recovered, err = OpenPersistentRouteTable(ctx, crashedDir, PersistenceOptions{})
+		assert.NoError(t, err, "size => %d", size)
+		assert.Equal(t, expected, persistenceStateOf(ctx, recovered.RouteTable()), "size => %d", size)
+		assert.NoError(t, recovered.Close())
+	}
+}
+
+func TestPersistentRouteTable_RecoverFromCrashOnSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: -1})
+	assert.NoError(t, err)
+	for _, mutate := range persistenceTestMutations()[:5] {
+		assert.NoError(t, mutate(ctx, p))
+	}
+	expected := persistenceStateOf(ctx, p.RouteTable())
+	oldWAL, err := os.ReadFile(filepath.Join(dir, "wal-00000000000000000000"))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Snapshot(ctx))
+	assert.NoError(t, p.Close())
+
+	t.Run("crash before renaming the snapshot", func(t *testing.T) {
+		crashedDir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(crashedDir, "wal-00000000000000000000"), oldWAL, 0o644))
+		assert.NoError(t, os.WriteFile(filepath.Join(crashedDir, "snapshot-00000000000000000001.tmp"), []byte("IPRT"), 0o644))
+
+		recovered, err := OpenPersistentRouteTable(ctx, crashedDir, PersistenceOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, persistenceStateOf(ctx, recovered.RouteTable()))
+		assert.NoError(t, recovered.Close())
+		_, err = os.Stat(filepath.Join(crashedDir, "snapshot-00000000000000000001.tmp"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("crash before switching the log", func(t *testing.T) {
+		crashedDir := t.TempDir()
+		snapshot, err := os.ReadFile(filepath.Join(dir, "snapshot-00000000000000000001"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(crashedDir, "snapshot-00000000000000000001"), snapshot, 0o644))
+		assert.NoError(t, os.WriteFile(filepath.Join(crashedDir, "wal-00000000000000000000"), oldWAL, 0o644))
+
+		recovered, err := OpenPersistentRouteTable(ctx, crashedDir, PersistenceOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, persistenceStateOf(ctx, recovered.RouteTable()))
+		assert.NoError(t, recovered.Close())
+		_, err = os.Stat(filepath.Join(crashedDir, "wal-00000000000000000000"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestPersistentRouteTable_RecoverFromTornTail(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: -1})
+	assert.NoError(t, err)
+	mutations := persistenceTestMutations()
+	for _, mutate := range mutations[:3] {
+		assert.NoError(t, mutate(ctx, p))
+	}
+	expected := persistenceStateOf(ctx, p.RouteTable())
+	walPath := filepath.Join(dir, "wal-00000000000000000000")
+	stat, err := os.Stat(walPath)
+	assert.NoError(t, err)
+	assert.NoError(t, mutations[3](ctx, p))
+	assert.NoError(t, p.Close())
+
+	fullWAL, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	wal, lastRecord := fullWAL[:stat.Size()], fullWAL[stat.Size():]
+	brokenLastRecord := append([]byte{}, lastRecord...)
+	brokenLastRecord[len(brokenLastRecord)-1] ^= 0xff
+
+	for _, tc := range []struct {
+		name string
+		tail []byte
+	}{
+		{
+			name: "zero-filled tail",
+			tail: make([]byte, 64),
+		},
+		{
+			name: "zero-filled record",
+			tail: make([]byte, len(lastRecord)),
+		},
+		{
+			name: "final record that has the checksum mismatch",
+			tail: brokenLastRecord,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			crashedDir := t.TempDir()
+			crashedWALPath := filepath.Join(crashedDir, "wal-00000000000000000000")
+			assert.NoError(t, os.WriteFile(crashedWALPath, append(append([]byte{}, wal...), tc.tail...), 0o644))
+
+			recovered, err := OpenPersistentRouteTable(ctx, crashedDir, PersistenceOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, expected, persistenceStateOf(ctx, recovered.RouteTable()))
+			assert.NoError(t, recovered.Close())
+
+			stat, err := os.Stat(crashedWALPath)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(wal)), stat.Size())
+		})
+	}
+
+	// the zero-filled tail of the log that is not the last one is not regarded as a torn write
+	crashedDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(crashedDir, "wal-00000000000000000000"), append(append([]byte{}, wal...), make([]byte, 64)...), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(crashedDir, "wal-00000000000000000001"), nil, 0o644))
+	_, err = OpenPersistentRouteTable(ctx, crashedDir, PersistenceOptions{})
+	assert.ErrorIs(t, err, ErrCorruptedWAL)
+}
+
+func TestPersistentRouteTable_CorruptedLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: -1})
+	assert.NoError(t, err)
+	for _, mutate := range persistenceTestMutations()[:3] {
+		assert.NoError(t, mutate(ctx, p))
+	}
+	assert.NoError(t, p.Close())
+
+	wal, err := os.ReadFile(filepath.Join(dir, "wal-00000000000000000000"))
+	assert.NoError(t, err)
+	wal[walRecordHeaderLen] ^= 0xff // breaks the first record
+
+	// the broken record of the log that is not the last one is not regarded as a torn write
+	corruptedDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(corruptedDir, "wal-00000000000000000000"), wal, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(corruptedDir, "wal-00000000000000000001"), nil, 0o644))
+	_, err = OpenPersistentRouteTable(ctx, corruptedDir, PersistenceOptions{})
+	assert.ErrorIs(t, err, ErrCorruptedWAL)
+
+	// the broken record in the middle of the last log is not regarded as a torn write either, and the log is kept as is
+	corruptedDir = t.TempDir()
+	corruptedWALPath := filepath.Join(corruptedDir, "wal-00000000000000000000")
+	assert.NoError(t, os.WriteFile(corruptedWALPath, wal, 0o644))
+	_, err = OpenPersistentRouteTable(ctx, corruptedDir, PersistenceOptions{})
+	assert.ErrorIs(t, err, ErrCorruptedWAL)
+	corruptedWAL, err := os.ReadFile(corruptedWALPath)
+	assert.NoError(t, err)
+	assert.Equal(t, wal, corruptedWAL)
+
+	// the empty record in the middle of the last log
+	corruptedDir = t.TempDir()
+	emptyRecordWAL := append(make([]byte, walRecordHeaderLen), wal...)
+	assert.NoError(t, os.WriteFile(filepath.Join(corruptedDir, "wal-00000000000000000000"), emptyRecordWAL, 0o644))
+	_, err = OpenPersistentRouteTable(ctx, corruptedDir, PersistenceOptions{})
+	assert.ErrorIs(t, err, ErrCorruptedWAL)
+
+	// the broken snapshot
+	corruptedDir = t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(corruptedDir, "snapshot-00000000000000000001"), []byte("broken"), 0o644))
+	_, err = OpenPersistentRouteTable(ctx, corruptedDir, PersistenceOptions{})
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+}
+
+func TestPersistentRouteTable_InvalidMutationAndClose(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{})
+	assert.NoError(t, err)
+
+	invalidDestination := &net.IPNet{
+		IP:   net.IP{0xff, 0xff, 0xff, 0xff, 0xff},
+		Mask: net.CIDRMask(24, 32),
+	}
+	err = p.AddRoute(ctx, &Route{Destination: invalidDestination})
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+	err = p.AddRouteWithLabel(ctx, "label", &Route{Destination: invalidDestination})
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+	_, err = p.RemoveRoute(ctx, invalidDestination)
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+
+	// the mutations that can't be replayed are rejected
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	err = p.AddRoute(ctx, &Route{Destination: v4, Gateway: net.IP{1, 2, 3, 4, 5}})
+	assert.ErrorIs(t, err, ErrUnencodableSnapshotData)
+	err = p.AddRoute(ctx, &Route{Destination: v4, NetworkInterface: strings.Repeat("x", maxSnapshotStringLen+1)})
+	assert.ErrorIs(t, err, ErrUnencodableSnapshotData)
+	err = p.AddRouteWithLabel(ctx, strings.Repeat("x", maxSnapshotStringLen+1), &Route{Destination: v4})
+	assert.ErrorIs(t, err, ErrUnencodableSnapshotData)
+	err = p.AddRoute(ctx, &Route{Destination: &net.IPNet{IP: net.IPv4(192, 0, 2, 0), Mask: net.CIDRMask(120, 128)}})
+	assert.ErrorIs(t, err, ErrUnencodableSnapshotData)
+	err = p.UpdateRouteByLabel(ctx, "label", net.IP{1, 2, 3, 4, 5}, "eth0", 0)
+	assert.ErrorIs(t, err, ErrUnencodableSnapshotData)
+	assert.Equal(t, 0, p.RouteTable().Len(ctx))
+
+	// the invalid mutations are not logged
+	stat, err := os.Stat(filepath.Join(dir, "wal-00000000000000000000"))
+	assert.NoError(t, err)
+	assert.Zero(t, stat.Size())
+
+	assert.NoError(t, p.Close())
+	assert.ErrorIs(t, p.Close(), ErrPersistentRouteTableClosed)
+	assert.ErrorIs(t, p.ClearRoutes(ctx), ErrPersistentRouteTableClosed)
+	assert.ErrorIs(t, p.Snapshot(ctx), ErrPersistentRouteTableClosed)
+
+	reopened, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, reopened.RouteTable().Len(ctx))
+	assert.NoError(t, reopened.Close())
+}
+
+func TestPersistentRouteTable_SnapshotFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// the directory at the path of the temporary snapshot file makes the snapshot fail
+	blocker := filepath.Join(dir, "snapshot-00000000000000000001.tmp")
+	assert.NoError(t, os.MkdirAll(filepath.Join(blocker, "blocker"), 0o755))
+
+	p, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: 1})
+	assert.NoError(t, err)
+
+	// the mutation succeeds because it has been logged and applied
+	mutations := persistenceTestMutations()
+	assert.NoError(t, mutations[0](ctx, p))
+	assert.NoError(t, mutations[1](ctx, p))
+	assert.Error(t, p.Snapshot(ctx))
+	expected := persistenceStateOf(ctx, p.RouteTable())
+
+	err = p.Close()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrPersistentRouteTableClosed)
+
+	reopened, err := OpenPersistentRouteTable(ctx, dir, PersistenceOptions{SnapshotThreshold: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, persistenceStateOf(ctx, reopened.RouteTable()))
+
+	// the succeeded snapshot clears the failure
+	assert.NoError(t, os.RemoveAll(blocker))
+	assert.NoError(t, reopened.Snapshot(ctx))
+	assert.NoError(t, reopened.Close())
+
+	reopened, err = OpenPersistentRouteTable(ctx, dir, PersistenceOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, persistenceStateOf(ctx, reopened.RouteTable()))
+	assert.NoError(t, reopened.Close())
+}
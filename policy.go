@@ -0,0 +1,234 @@
+package iprtb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/moznion/go-optional"
+)
+
+// ErrPolicyTableNameMissing represents the error that indicates given policy rule looks up a table, but the table name is missing.
+var ErrPolicyTableNameMissing = errors.New("given policy rule doesn't have the table name to look up")
+
+// ErrUnknownPolicyAction represents the error that indicates given policy rule has an unknown action.
+var ErrUnknownPolicyAction = errors.New("given policy rule has an unknown action")
+
+// PolicyAction is the action of a policy rule.
+type PolicyAction int
+
+const (
+	// PolicyActionTable looks up the routing table that is specified by PolicyRule.Table.
+	// If the routing table has no matched route, the evaluation falls through to the next rule.
+	PolicyActionTable PolicyAction = iota
+	// PolicyActionBlackhole silently discards the packet.
+	PolicyActionBlackhole
+	// PolicyActionUnreachable rejects the packet as the unreachable destination.
+	PolicyActionUnreachable
+)
+
+func (a PolicyAction) String() string {
+	switch a {
+	case PolicyActionTable:
+		return "table"
+	case PolicyActionBlackhole:
+		return "blackhole"
+	case PolicyActionUnreachable:
+		return "unreachable"
+	default:
+		return "unknown"
+	}
+}
+
+// PolicyRule is a rule of the policy routing, like `ip rule` of Linux.
+// A rule matches when all the given selectors match; the nil prefix and the zero MarkMask match anything.
+type PolicyRule struct {
+	// Priority is the priority of the rule. The rules are evaluated in ascending order of the priority,
+	// and the rules that have the same priority are evaluated in the order of addition.
+	Priority int
+	// Source is the prefix that the source address must be in.
+	Source *net.IPNet
+	// Destination is the prefix that the destination address must be in.
+	Destination *net.IPNet
+	// Mark is the value that the masked mark must equal to. This is used only if MarkMask is not zero.
+	Mark uint32
+	// MarkMask is the mask that is applied to the mark before comparing it with Mark.
+	MarkMask uint32
+	// Action is the action of the rule.
+	Action PolicyAction
+	// Table is the name of the routing table to look up. This is required only if Action is PolicyActionTable.
+	Table string
+}
+
+func (r *PolicyRule) matches(src net.IP, dst net.IP, mark uint32) bool {
+	if r.Source != nil && !r.Source.Contains(src) {
+		return false
+	}
+	if r.Destination != nil && !r.Destination.Contains(dst) {
+		return false
+	}
+	return mark&r.MarkMask == r.Mark&r.MarkMask
+}
+
+// PolicyLookupResult is the result of PolicyRouter.Lookup.
+type PolicyLookupResult struct {
+	// Rule is the rule that decided the result.
+	Rule PolicyRule
+	// Route is the matched route in the routing table of the rule. This is always None if the action of the rule is not PolicyActionTable.
+	Route optional.Option[Route]
+}
+
+// PolicyRouter is the policy routing implementation that selects a routing table by the ordered rules, like `ip rule` of Linux.
+// This holds the named routing tables; the routing tables can be still mutated directly after the registration.
+// PolicyRouter has no rule by default, so that every lookup results in no decision until the rules are added.
+type PolicyRouter struct {
+	tables map[string]*RouteTable
+	rules  []*PolicyRule // ordered by the priority
+	mu     sync.RWMutex
+}
+
+// NewPolicyRouter makes a new PolicyRouter value.
+func NewPolicyRouter() *PolicyRouter {
+	return &PolicyRouter{
+		tables: map[string]*RouteTable{},
+	}
+}
+
+// SetTable registers the routing table by the name. If the name has already been registered, this replaces the routing table.
+func (pr *PolicyRouter) SetTable(ctx context.Context, name string, rt *RouteTable) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.tables[name] = rt
+}
+
+// Table returns the routing table that is registered by the name. If there is no such routing table, the boolean is false.
+func (pr *PolicyRouter) Table(ctx context.Context, name string) (*RouteTable, bool) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	rt, ok := pr.tables[name]
+	return rt, ok
+}
+
+// RemoveTable unregisters the routing table. The rules that look up the removed routing table are kept,
+// and they fall through on lookup as well as the routing table has no matched route.
+func (pr *PolicyRouter) RemoveTable(ctx context.Context, name string) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	delete(pr.tables, name)
+}
+
+// TableNames returns the names of the registered routing tables in the lexical order.
+func (pr *PolicyRouter) TableNames(ctx context.Context) []string {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	names := make([]string, 0, len(pr.tables))
+	for name := range pr.tables {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// AddRule adds the rule. The rule is inserted after the existing rules that have the same or the lower priority.
+// The given rule is copied, so modifying that after the addition doesn't affect the policy router.
+func (pr *PolicyRouter) AddRule(ctx context.Context, rule *PolicyRule) error {
+	switch rule.Action {
+	case PolicyActionTable:
+		if rule.Table == "" {
+			return fmt.Errorf("failed to add a policy rule; priority => %d: %w", rule.Priority, ErrPolicyTableNameMissing)
+		}
+	case PolicyActionBlackhole, PolicyActionUnreachable:
+	default:
+		return fmt.Errorf("failed to add a policy rule; priority => %d, action => %d: %w", rule.Priority, rule.Action, ErrUnknownPolicyAction)
+	}
+	for _, prefix := range []*net.IPNet{rule.Source, rule.Destination} {
+		if prefix == nil {
+			continue
+		}
+		if err := validateDestination(prefix); err != nil {
+			return fmt.Errorf("failed to add a policy rule; priority => %d, prefix => %s: %w", rule.Priority, prefix, err)
+		}
+	}
+
+	copiedRule := *rule
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	i := slices.IndexFunc(pr.rules, func(r *PolicyRule) bool {
+		return r.Priority > copiedRule.Priority
+	})
+	if i < 0 {
+		i = len(pr.rules)
+	}
+	pr.rules = slices.Insert(pr.rules, i, &copiedRule)
+	return nil
+}
+
+// RemoveRulesByPriority removes all rules that have the given priority, and returns the number of the removed rules.
+func (pr *PolicyRouter) RemoveRulesByPriority(ctx context.Context, priority int) int {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	numOfRules := len(pr.rules)
+	pr.rules = slices.DeleteFunc(pr.rules, func(r *PolicyRule) bool {
+		return r.Priority == priority
+	})
+	return numOfRules - len(pr.rules)
+}
+
+// Rules returns the copies of the rules in the evaluation order.
+func (pr *PolicyRouter) Rules(ctx context.Context) []PolicyRule {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	rules := make([]PolicyRule, len(pr.rules))
+	for i, r := range pr.rules {
+		rules[i] = *r
+	}
+	return rules
+}
+
+// Lookup evaluates the rules in the priority order against the source address, the destination address and the mark.
+//
+// If a matched rule looks up a routing table and that has a matched route for the destination, this returns the rule and the route.
+// If the routing table has no matched route (or the routing table is not registered), the evaluation falls through to the next rule.
+// If a matched rule is PolicyActionBlackhole or PolicyActionUnreachable, this returns the rule without a route.
+// If no rule decides the result, this returns the value of optional.None.
+func (pr *PolicyRouter) Lookup(ctx context.Context, src net.IP, dst net.IP, mark uint32) (optional.Option[PolicyLookupResult], error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	for _, rule := range pr.rules {
+		if !rule.matches(src, dst, mark) {
+			continue
+		}
+
+		if rule.Action != PolicyActionTable {
+			return optional.Some(PolicyLookupResult{
+				Rule:  *rule,
+				Route: optional.None[Route](),
+			}), nil
+		}
+
+		rt, ok := pr.tables[rule.Table]
+		if !ok {
+			continue
+		}
+		maybeRoute, err := rt.MatchRoute(ctx, dst)
+		if err != nil {
+			return optional.None[PolicyLookupResult](), fmt.Errorf("failed to look up the table => %s: %w", rule.Table, err)
+		}
+		if maybeRoute.IsSome() {
+			return optional.Some(PolicyLookupResult{
+				Rule:  *rule,
+				Route: maybeRoute,
+			}), nil
+		}
+	}
+	return optional.None[PolicyLookupResult](), nil
+}
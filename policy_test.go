@@ -0,0 +1,134 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyRouter_Lookup(t *testing.T) {
+	ctx := context.Background()
+
+	mainTable := NewRouteTable()
+	assert.NoError(t, mainTable.LoadRoutes(ctx, strings.NewReader(`
+default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth1
+`)))
+	vpnTable := NewRouteTable()
+	assert.NoError(t, vpnTable.LoadRoutes(ctx, strings.NewReader(`
+10.1.0.0/16 via 198.51.100.1 dev tun0
+`)))
+	markedTable := NewRouteTable()
+	assert.NoError(t, markedTable.LoadRoutes(ctx, strings.NewReader(`
+default via 203.0.113.1 dev eth2
+`)))
+
+	pr := NewPolicyRouter()
+	pr.SetTable(ctx, "main", mainTable)
+	pr.SetTable(ctx, "vpn", vpnTable)
+	pr.SetTable(ctx, "marked", markedTable)
+	assert.Equal(t, []string{"main", "marked", "vpn"}, pr.TableNames(ctx))
+
+	_, office, _ := net.ParseCIDR("172.16.0.0/12")
+	_, blocked, _ := net.ParseCIDR("10.99.0.0/16")
+	_, forbidden, _ := net.ParseCIDR("10.98.0.0/16")
+	assert.NoError(t, pr.AddRule(ctx, &PolicyRule{Priority: 32766, Action: PolicyActionTable, Table: "main"}))
+	assert.NoError(t, pr.AddRule(ctx, &PolicyRule{Priority: 100, Source: office, Action: PolicyActionTable, Table: "vpn"}))
+	assert.NoError(t, pr.AddRule(ctx, &PolicyRule{Priority: 10, Destination: blocked, Action: PolicyActionBlackhole}))
+	assert.NoError(t, pr.AddRule(ctx, &PolicyRule{Priority: 10, Destination: forbidden, Action: PolicyActionUnreachable}))
+	assert.NoError(t, pr.AddRule(ctx, &PolicyRule{Priority: 200, Mark: 0x1, MarkMask: 0xff, Action: PolicyActionTable, Table: "marked"}))
+	assert.NoError(t, pr.AddRule(ctx, &PolicyRule{Priority: 300, Action: PolicyActionTable, Table: "missing"}))
+
+	priorities := []int{}
+	for _, r := range pr.Rules(ctx) {
+		priorities = append(priorities, r.Priority)
+	}
+	assert.Equal(t, []int{10, 10, 100, 200, 300, 32766}, priorities)
+	assert.Equal(t, blocked, pr.Rules(ctx)[0].Destination) // the insertion order is kept for the same priority
+
+	lookup := func(src string, dst string, mark uint32) (string, string) {
+		maybeResult, err := pr.Lookup(ctx, net.ParseIP(src), net.ParseIP(dst), mark)
+		assert.NoError(t, err)
+		if maybeResult.IsNone() {
+			return "none", ""
+		}
+		result := maybeResult.Unwrap()
+		if result.Route.IsNone() {
+			return result.Rule.Action.String(), ""
+		}
+		return result.Rule.Table, result.Route.Unwrap().Gateway.String()
+	}
+
+	for _, tt := range []struct {
+		src             string
+		dst             string
+		mark            uint32
+		expectedTable   string
+		expectedGateway string
+	}{
+		{"172.16.0.1", "10.1.2.3", 0, "vpn", "198.51.100.1"},
+		{"172.16.0.1", "10.2.2.3", 0, "main", "192.0.2.2"}, // falls through because the vpn table has no matched route
+		{"192.168.0.1", "10.1.2.3", 0, "main", "192.0.2.2"},
+		{"192.168.0.1", "10.1.2.3", 0x101, "marked", "203.0.113.1"},
+		{"192.168.0.1", "10.1.2.3", 0x102, "main", "192.0.2.2"},
+		{"172.16.0.1", "10.99.0.1", 0x1, "blackhole", ""},
+		{"172.16.0.1", "10.98.0.1", 0, "unreachable", ""},
+	} {
+		table, gateway := lookup(tt.src, tt.dst, tt.mark)
+		assert.Equal(t, tt.expectedTable, table, "%s -> %s (mark %#x)", tt.src, tt.dst, tt.mark)
+		assert.Equal(t, tt.expectedGateway, gateway, "%s -> %s (mark %#x)", tt.src, tt.dst, tt.mark)
+	}
+
+	// the registered tables are looked up with their current routes
+	err := vpnTable.LoadRoutes(ctx, strings.NewReader("10.2.0.0/16 via 198.51.100.2 dev tun0\n"))
+	assert.NoError(t, err)
+	table, gateway := lookup("172.16.0.1", "10.2.2.3", 0)
+	assert.Equal(t, "vpn", table)
+	assert.Equal(t, "198.51.100.2", gateway)
+
+	pr.RemoveTable(ctx, "vpn")
+	table, _ = lookup("172.16.0.1", "10.2.2.3", 0)
+	assert.Equal(t, "main", table)
+	_, ok := pr.Table(ctx, "vpn")
+	assert.False(t, ok)
+	rt, ok := pr.Table(ctx, "main")
+	assert.True(t, ok)
+	assert.Equal(t, mainTable, rt)
+
+	assert.Equal(t, 2, pr.RemoveRulesByPriority(ctx, 10))
+	assert.Equal(t, 0, pr.RemoveRulesByPriority(ctx, 10))
+	table, gateway = lookup("172.16.0.1", "10.99.0.1", 0)
+	assert.Equal(t, "main", table)
+	assert.Equal(t, "192.0.2.2", gateway)
+
+	_, err = pr.Lookup(ctx, net.ParseIP("172.16.0.1"), net.IP{0x20, 0x01}, 0)
+	assert.ErrorIs(t, err, ErrInvalidIPv6Length)
+
+	// no rule decides the result
+	assert.Equal(t, 1, pr.RemoveRulesByPriority(ctx, 32766))
+	table, _ = lookup("192.168.0.1", "10.2.2.3", 0)
+	assert.Equal(t, "none", table)
+}
+
+func TestPolicyRouter_AddRule_Invalid(t *testing.T) {
+	ctx := context.Background()
+	pr := NewPolicyRouter()
+
+	assert.ErrorIs(t, pr.AddRule(ctx, &PolicyRule{Action: PolicyActionTable}), ErrPolicyTableNameMissing)
+	assert.ErrorIs(t, pr.AddRule(ctx, &PolicyRule{Action: PolicyAction(-1)}), ErrUnknownPolicyAction)
+	assert.ErrorIs(t, pr.AddRule(ctx, &PolicyRule{
+		Source: &net.IPNet{IP: net.IP{0x20, 0x01}, Mask: net.CIDRMask(16, 128)},
+		Action: PolicyActionBlackhole,
+	}), ErrInvalidIPv6Length)
+	assert.Empty(t, pr.Rules(ctx))
+}
+
+func TestPolicyAction_String(t *testing.T) {
+	assert.Equal(t, "table", PolicyActionTable.String())
+	assert.Equal(t, "blackhole", PolicyActionBlackhole.String())
+	assert.Equal(t, "unreachable", PolicyActionUnreachable.String())
+	assert.Equal(t, "unknown", PolicyAction(-1).String())
+}
@@ -0,0 +1,372 @@
+package iprtb
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// the route flags of Linux kernel (include/uapi/linux/route.h and include/uapi/linux/ipv6_route.h)
+const (
+	rtfUp      = 0x0001
+	rtfGateway = 0x0002
+	rtfHost    = 0x0004
+	rtfReject  = 0x0200
+	rtfLocal   = 0x80000000
+)
+
+// procNetRouteLineWidth is the width of each line of /proc/net/route; the kernel pads each line with spaces.
+const procNetRouteLineWidth = 127
+
+const procNetRouteHeader = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT"
+
+// procNetNoInterface is the network interface name that represents the route doesn't have any network interface.
+const procNetNoInterface = "*"
+
+// ErrInvalidProcNetRoute represents the error that indicates given data is not valid as /proc/net/route or /proc/net/ipv6_route.
+var ErrInvalidProcNetRoute = errors.New("invalid format of /proc/net route")
+
+// ParseProcNetRoute parses the contents of /proc/net/route into the routes.
+//
+// The addresses are regarded as the little-endian hex that is what the kernel on little-endian hosts shows.
+// "Iface", "Gateway", "Mask" and "Metric" columns are mapped onto Route, and "Flags" column is used as the following:
+// the routes that have RTF_REJECT are parsed as the routes that have neither gateway nor network interface, the other routes that
+// don't have RTF_UP are skipped, and "Gateway" is mapped only if the route has RTF_GATEWAY.
+// If the contents have the multiple routes for the same destination (e.g. the default routes via the different network interfaces),
+// only the route that has the lowest metric is kept because the kernel forwards packets by that; the first one is kept if they have the same metric.
+func ParseProcNetRoute(r io.Reader) (Routes, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read /proc/net/route: %w", err)
+		}
+		return nil, fmt.Errorf("failed to parse /proc/net/route; missing header: %w", ErrInvalidProcNetRoute)
+	}
+
+	column2Index := map[string]int{}
+	for i, column := range strings.Fields(scanner.Text()) {
+		column2Index[column] = i
+	}
+	for _, column := range []string{"Iface", "Destination", "Gateway", "Flags", "Metric", "Mask"} {
+		if _, ok := column2Index[column]; !ok {
+			return nil, fmt.Errorf("failed to parse /proc/net/route; missing %q column in the header: %w", column, ErrInvalidProcNetRoute)
+		}
+	}
+
+	routes := Routes{}
+	lineNum := 1
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != len(column2Index) {
+			return nil, fmt.Errorf("failed to parse /proc/net/route at line %d; the number of columns mismatches: %w", lineNum, ErrInvalidProcNetRoute)
+		}
+
+		route, err := parseProcNetRouteFields(
+			fields[column2Index["Iface"]],
+			fields[column2Index["Destination"]],
+			fields[column2Index["Gateway"]],
+			fields[column2Index["Flags"]],
+			fields[column2Index["Metric"]],
+			fields[column2Index["Mask"]],
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse /proc/net/route at line %d; %w", lineNum, err)
+		}
+		if route != nil {
+			routes = append(routes, route)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read /proc/net/route: %w", err)
+	}
+
+	return lowestMetricRoutes(routes), nil
+}
+
+func parseProcNetRouteFields(iface string, destination string, gateway string, flags string, metric string, mask string) (*Route, error) {
+	flagsValue, err := strconv.ParseUint(flags, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flags => %q: %w", flags, ErrInvalidProcNetRoute)
+	}
+	if flagsValue&(rtfUp|rtfReject) == 0 {
+		return nil, nil
+	}
+
+	dstIP, err := parseLittleEndianHexIPv4(destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination => %q: %w", destination, err)
+	}
+	maskIP, err := parseLittleEndianHexIPv4(mask)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mask => %q: %w", mask, err)
+	}
+	ipMask := net.IPMask(maskIP)
+	if ones, bits := ipMask.Size(); ones == 0 && bits == 0 {
+		return nil, fmt.Errorf("non-canonical mask => %q: %w", mask, ErrInvalidProcNetRoute)
+	}
+
+	metricValue, err := strconv.ParseUint(metric, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric => %q: %w", metric, ErrInvalidProcNetRoute)
+	}
+
+	route := &Route{
+		Destination: &net.IPNet{
+			IP:   dstIP.Mask(ipMask),
+			Mask: ipMask,
+		},
+		Metric: int(metricValue),
+	}
+	if flagsValue&rtfReject != 0 {
+		return route, nil
+	}
+
+	if flagsValue&rtfGateway != 0 {
+		gatewayIP, err := parseLittleEndianHexIPv4(gateway)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway => %q: %w", gateway, err)
+		}
+		route.Gateway = gatewayIP
+	}
+	if iface != procNetNoInterface {
+		route.NetworkInterface = iface
+	}
+
+	return route, nil
+}
+
+// ParseProcNetIPv6Route parses the contents of /proc/net/ipv6_route into the routes.
+//
+// "destination", "destination prefix length", "next hop", "metric", "flags" and "device name" columns are mapped onto Route,
+// and the source columns are ignored. The flags are handled as well as ParseProcNetRoute, and additionally the local routes
+// (i.e. RTF_LOCAL) are skipped because they don't forward packets to the other hosts.
+// The routes for the same destination are handled as well as ParseProcNetRoute, so the reject default route on the loopback interface
+// that the kernel always has doesn't shadow the actual default route.
+func ParseProcNetIPv6Route(r io.Reader) (Routes, error) {
+	routes := Routes{}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 10 {
+			return nil, fmt.Errorf("failed to parse /proc/net/ipv6_route at line %d; the number of columns mismatches: %w", lineNum, ErrInvalidProcNetRoute)
+		}
+
+		route, err := parseProcNetIPv6RouteFields(fields[0], fields[1], fields[4], fields[5], fields[8], fields[9])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse /proc/net/ipv6_route at line %d; %w", lineNum, err)
+		}
+		if route != nil {
+			routes = append(routes, route)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read /proc/net/ipv6_route: %w", err)
+	}
+
+	return lowestMetricRoutes(routes), nil
+}
+
+func parseProcNetIPv6RouteFields(destination string, prefixLen string, nextHop string, metric string, flags string, device string) (*Route, error) {
+	flagsValue, err := strconv.ParseUint(flags, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flags => %q: %w", flags, ErrInvalidProcNetRoute)
+	}
+	if flagsValue&(rtfUp|rtfReject) == 0 || flagsValue&rtfLocal != 0 {
+		return nil, nil
+	}
+
+	dstIP, err := parseHexIPv6(destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination => %q: %w", destination, err)
+	}
+	prefixLenValue, err := strconv.ParseUint(prefixLen, 16, 8)
+	if err != nil || prefixLenValue > 8*net.IPv6len {
+		return nil, fmt.Errorf("invalid destination prefix length => %q: %w", prefixLen, ErrInvalidProcNetRoute)
+	}
+	metricValue, err := strconv.ParseUint(metric, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric => %q: %w", metric, ErrInvalidProcNetRoute)
+	}
+
+	ipMask := net.CIDRMask(int(prefixLenValue), 8*net.IPv6len)
+	route := &Route{
+		Destination: &net.IPNet{
+			IP:   dstIP.Mask(ipMask),
+			Mask: ipMask,
+		},
+		Metric: int(metricValue),
+	}
+	if flagsValue&rtfReject != 0 {
+		return route, nil
+	}
+
+	if flagsValue&rtfGateway != 0 {
+		nextHopIP, err := parseHexIPv6(nextHop)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next hop => %q: %w", nextHop, err)
+		}
+		route.Gateway = nextHopIP
+	}
+	if device != procNetNoInterface {
+		route.NetworkInterface = device
+	}
+
+	return route, nil
+}
+
+// LoadProcNetRoute parses the contents of /proc/net/route and adds the parsed routes to the routing table at once.
+// Please refer also to ParseProcNetRoute for the details of parsing.
+func (rt *RouteTable) LoadProcNetRoute(ctx context.Context, r io.Reader) error {
+	routes, err := ParseProcNetRoute(r)
+	if err != nil {
+		return err
+	}
+	return rt.AddRoutes(ctx, routes)
+}
+
+// LoadProcNetIPv6Route parses the contents of /proc/net/ipv6_route and adds the parsed routes to the routing table at once.
+// Please refer also to ParseProcNetIPv6Route for the details of parsing.
+func (rt *RouteTable) LoadProcNetIPv6Route(ctx context.Context, r io.Reader) error {
+	routes, err := ParseProcNetIPv6Route(r)
+	if err != nil {
+		return err
+	}
+	return rt.AddRoutes(ctx, routes)
+}
+
+// WriteProcNetRoute writes the IPv4 routes of the routing table in the /proc/net/route format, so that ParseProcNetRoute can read it.
+// The routes that have neither gateway nor network interface are written as the reject routes, and the routes that don't have
+// network interface are written with "*" as Iface. The addresses are written as the little-endian hex.
+func (rt *RouteTable) WriteProcNetRoute(ctx context.Context, w io.Writer) error {
+	routes := rt.DumpRouteTable(ctx)
+
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, "%-*s\n", procNetRouteLineWidth, procNetRouteHeader)
+	for _, r := range routes {
+		dstIP := canonicalDestinationIP(r.Destination)
+		if len(dstIP) != net.IPv4len {
+			continue
+		}
+		prefixLen, _ := r.Destination.Mask.Size()
+		mask := net.CIDRMask(prefixLen, 8*net.IPv4len)
+
+		flags, iface := procNetFlagsAndInterface(r)
+		if prefixLen == 8*net.IPv4len {
+			flags |= rtfHost
+		}
+		gateway := r.Gateway.To4()
+		if gateway == nil {
+			gateway = net.IPv4zero.To4()
+		}
+
+		line := fmt.Sprintf("%s\t%08X\t%08X\t%04X\t%d\t%d\t%d\t%08X\t%d\t%d\t%d",
+			iface,
+			binary.LittleEndian.Uint32(dstIP),
+			binary.LittleEndian.Uint32(gateway),
+			flags,
+			0, 0,
+			uint32(r.Metric),
+			binary.LittleEndian.Uint32(mask),
+			0, 0, 0,
+		)
+		_, _ = fmt.Fprintf(bw, "%-*s\n", procNetRouteLineWidth, line)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write /proc/net/route: %w", err)
+	}
+	return nil
+}
+
+// WriteProcNetIPv6Route writes the IPv6 routes of the routing table in the /proc/net/ipv6_route format, so that ParseProcNetIPv6Route can read it.
+// The routes that have neither gateway nor network interface are written as the reject routes, and the routes that don't have
+// network interface are written with "*" as the device name.
+func (rt *RouteTable) WriteProcNetIPv6Route(ctx context.Context, w io.Writer) error {
+	routes := rt.DumpRouteTable(ctx)
+
+	bw := bufio.NewWriter(w)
+	for _, r := range routes {
+		dstIP := canonicalDestinationIP(r.Destination)
+		if len(dstIP) != net.IPv6len {
+			continue
+		}
+		prefixLen, _ := r.Destination.Mask.Size()
+
+		flags, iface := procNetFlagsAndInterface(r)
+		gateway := net.IPv6zero
+		if r.Gateway != nil && r.Gateway.To4() == nil {
+			gateway = r.Gateway
+		}
+
+		_, _ = fmt.Fprintf(bw, "%s %02x %s %02x %s %08x %08x %08x %08x %8s\n",
+			hex.EncodeToString(dstIP),
+			prefixLen,
+			hex.EncodeToString(net.IPv6zero),
+			0,
+			hex.EncodeToString(gateway),
+			uint32(r.Metric),
+			0, 0,
+			flags,
+			iface,
+		)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write /proc/net/ipv6_route: %w", err)
+	}
+	return nil
+}
+
+func procNetFlagsAndInterface(r *Route) (uint32, string) {
+	flags := uint32(rtfUp)
+	if r.Gateway == nil && r.NetworkInterface == "" {
+		return flags | rtfReject, procNetNoInterface
+	}
+	if r.Gateway != nil {
+		flags |= rtfGateway
+	}
+	iface := r.NetworkInterface
+	if iface == "" {
+		iface = procNetNoInterface
+	}
+	return flags, iface
+}
+
+func parseLittleEndianHexIPv4(s string) (net.IP, error) {
+	if len(s) != 2*net.IPv4len {
+		return nil, ErrInvalidProcNetRoute
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, ErrInvalidProcNetRoute
+	}
+	return binary.LittleEndian.AppendUint32(make(net.IP, 0, net.IPv4len), uint32(v)), nil
+}
+
+func parseHexIPv6(s string) (net.IP, error) {
+	if len(s) != 2*net.IPv6len {
+		return nil, ErrInvalidProcNetRoute
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidProcNetRoute
+	}
+	return b, nil
+}
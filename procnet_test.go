@@ -0,0 +1,191 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const procNetRouteFixture = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT                                                       
+eth0	00000000	010200C0	0003	0	0	100	00000000	0	0	0                                                                               
+eth0	000200C0	00000000	0001	0	0	100	00FFFFFF	0	0	0                                                                               
+eth1	FF6433C6	FE0200C0	0007	0	0	0	FFFFFFFF	0	0	0                                                                               
+*	0000000A	00000000	0201	0	0	0	000000FF	0	0	0                                                                               
+eth2	0071CB00	00000000	0000	0	0	0	00FFFFFF	0	0	0                                                                               
+`
+
+const procNetIPv6RouteFixture = `20010db8000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000003 00000000 00450003     eth0
+00000000000000000000000000000001 80 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000002 00000000 80200001       lo
+20010db8000100000000000000000000 30 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`
+
+func TestParseProcNetRoute(t *testing.T) {
+	routes, err := ParseProcNetRoute(strings.NewReader(procNetRouteFixture))
+	assert.NoError(t, err)
+	assert.Equal(t, `0.0.0.0/0	192.0.2.1	eth0	100
+192.0.2.0/24	<nil>	eth0	100
+198.51.100.255/32	192.0.2.254	eth1	0
+10.0.0.0/8	<nil>		0
+`, routes.String())
+}
+
+func TestParseProcNetIPv6Route(t *testing.T) {
+	routes, err := ParseProcNetIPv6Route(strings.NewReader(procNetIPv6RouteFixture))
+	assert.NoError(t, err)
+	assert.Equal(t, `2001:db8::/64	<nil>	eth0	256
+fe80::/64	<nil>	eth0	256
+::/0	fe80::1	eth0	1024
+2001:db8:1::/48	<nil>		4294967295
+`, routes.String())
+}
+
+func TestRouteTable_LoadProcNetRoute_MultipleDefaultRoutes(t *testing.T) {
+	ctx := context.Background()
+
+	// the kernel lists the default routes via eth0 and wlan0 in the order of the metric
+	rtb := NewRouteTable()
+	err := rtb.LoadProcNetRoute(ctx, strings.NewReader(`Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT                                                       
+eth0	00000000	010200C0	0003	0	0	100	00000000	0	0	0                                                                               
+wlan0	00000000	016433C6	0003	0	0	600	00000000	0	0	0                                                                               
+eth0	000200C0	00000000	0001	0	0	100	00FFFFFF	0	0	0                                                                               
+wlan0	006433C6	00000000	0001	0	0	600	00FFFFFF	0	0	0                                                                               
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rtb.Len(ctx))
+
+	maybeMatchedRoute, err := rtb.MatchRoute(ctx, net.IPv4(8, 8, 8, 8))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0/0\t192.0.2.1\teth0\t100", maybeMatchedRoute.Unwrap().String())
+}
+
+func TestRouteTable_LoadProcNetIPv6Route_RejectDefaultRoute(t *testing.T) {
+	ctx := context.Background()
+
+	// the kernel always has the reject default route on the loopback interface that follows the actual default route
+	rtb := NewRouteTable()
+	err := rtb.LoadProcNetIPv6Route(ctx, strings.NewReader(`20010db8000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000064 00000003 00000000 00450003     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000002 00000258 00000001 00000000 00450003    wlan0
+00000000000000000000000000000001 80 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000002 00000000 80200001       lo
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rtb.Len(ctx))
+
+	maybeMatchedRoute, err := rtb.MatchRoute(ctx, net.ParseIP("2001:db8:ffff::1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "::/0\tfe80::1\teth0\t100", maybeMatchedRoute.Unwrap().String())
+}
+
+func TestParseProcNetRoute_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		contents      string
+		expectedError string
+	}{
+		{
+			name:          "empty",
+			contents:      "",
+			expectedError: "failed to parse /proc/net/route; missing header",
+		},
+		{
+			name:          "missing column",
+			contents:      "Iface\tDestination\tGateway\n",
+			expectedError: `failed to parse /proc/net/route; missing "Flags" column in the header`,
+		},
+		{
+			name:          "mismatched number of columns",
+			contents:      procNetRouteHeader + "\neth0\t00000000\n",
+			expectedError: "failed to parse /proc/net/route at line 2; the number of columns mismatches",
+		},
+		{
+			name:          "invalid destination",
+			contents:      procNetRouteHeader + "\neth0\tXXXXXXXX\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n",
+			expectedError: `failed to parse /proc/net/route at line 2; invalid destination => "XXXXXXXX"`,
+		},
+		{
+			name:          "non-canonical mask",
+			contents:      procNetRouteHeader + "\neth0\t000200C0\t00000000\t0001\t0\t0\t0\t00FF00FF\t0\t0\t0\n",
+			expectedError: `failed to parse /proc/net/route at line 2; non-canonical mask => "00FF00FF"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseProcNetRoute(strings.NewReader(tc.contents))
+			assert.ErrorIs(t, err, ErrInvalidProcNetRoute)
+			assert.True(t, strings.HasPrefix(err.Error(), tc.expectedError), err.Error())
+		})
+	}
+}
+
+func TestParseProcNetIPv6Route_Invalid(t *testing.T) {
+	_, err := ParseProcNetIPv6Route(strings.NewReader("20010db8000000000000000000000000 40 eth0\n"))
+	assert.ErrorIs(t, err, ErrInvalidProcNetRoute)
+	assert.True(t, strings.HasPrefix(err.Error(), "failed to parse /proc/net/ipv6_route at line 1; the number of columns mismatches"), err.Error())
+
+	_, err = ParseProcNetIPv6Route(strings.NewReader("20010db8000000000000000000000000 81 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0\n"))
+	assert.ErrorIs(t, err, ErrInvalidProcNetRoute)
+	assert.True(t, strings.HasPrefix(err.Error(), `failed to parse /proc/net/ipv6_route at line 1; invalid destination prefix length => "81"`), err.Error())
+}
+
+func TestRouteTable_WriteProcNetRoute(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.LoadProcNetRoute(ctx, strings.NewReader(procNetRouteFixture))
+	assert.NoError(t, err)
+	err = rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		NetworkInterface: "ifb0",
+	}) // IPv6 route must not be written
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = rtb.WriteProcNetRoute(ctx, &buf)
+	assert.NoError(t, err)
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.Len(t, lines, 6) // header + 4 routes + the last empty string
+	for _, line := range lines[:5] {
+		assert.Len(t, line, procNetRouteLineWidth)
+	}
+	assert.Equal(t, fmt.Sprintf("%-*s", procNetRouteLineWidth, "eth0\t00000000\t010200C0\t0003\t0\t0\t100\t00000000\t0\t0\t0"), lines[1])
+
+	routes, err := ParseProcNetRoute(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `0.0.0.0/0	192.0.2.1	eth0	100
+10.0.0.0/8	<nil>		0
+192.0.2.0/24	<nil>	eth0	100
+198.51.100.255/32	192.0.2.254	eth1	0
+`, routes.String())
+}
+
+func TestRouteTable_WriteProcNetIPv6Route(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.LoadProcNetIPv6Route(ctx, strings.NewReader(procNetIPv6RouteFixture))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = rtb.WriteProcNetIPv6Route(ctx, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000000 00000000 00000003     eth0
+20010db8000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000000 00000000 00000001     eth0
+20010db8000100000000000000000000 30 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000000 00000000 00000201        *
+fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000000 00000000 00000001     eth0
+`, buf.String())
+
+	routes, err := ParseProcNetIPv6Route(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, routes, 4)
+}
@@ -0,0 +1,101 @@
+package iprtb
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// routeIndex is the secondary indexes of the routes that are maintained on every mutation of the prefix tree,
+// to look up the routes by the network interface and the gateway without traversing the prefix tree.
+// The inner maps are keyed by the routes that are stored in the prefix tree, so maintaining them doesn't allocate for each route.
+type routeIndex struct {
+	byInterface map[string]map[*Route]struct{}
+	byGateway   map[string]map[*Route]struct{} // the keys are nextHopKey
+}
+
+// add adds the route to the indexes.
+func (idx *routeIndex) add(route *Route) {
+	if route.NetworkInterface != "" {
+		if idx.byInterface == nil {
+			idx.byInterface = map[string]map[*Route]struct{}{}
+		}
+		routes := idx.byInterface[route.NetworkInterface]
+		if routes == nil {
+			routes = map[*Route]struct{}{}
+			idx.byInterface[route.NetworkInterface] = routes
+		}
+		routes[route] = struct{}{}
+	}
+	if route.Gateway != nil {
+		if idx.byGateway == nil {
+			idx.byGateway = map[string]map[*Route]struct{}{}
+		}
+		gateway := canonicalNextHop(route.Gateway)
+		routes := idx.byGateway[string(gateway)] // this doesn't allocate the key unless that is new
+		if routes == nil {
+			routes = map[*Route]struct{}{}
+			idx.byGateway[string(gateway)] = routes
+		}
+		routes[route] = struct{}{}
+	}
+}
+
+// remove removes the route from the indexes.
+func (idx *routeIndex) remove(route *Route) {
+	if route.NetworkInterface != "" {
+		routes := idx.byInterface[route.NetworkInterface]
+		delete(routes, route)
+		if len(routes) == 0 {
+			delete(idx.byInterface, route.NetworkInterface)
+		}
+	}
+	if route.Gateway != nil {
+		gateway := canonicalNextHop(route.Gateway)
+		routes := idx.byGateway[string(gateway)]
+		delete(routes, route)
+		if len(routes) == 0 {
+			delete(idx.byGateway, string(gateway))
+		}
+	}
+}
+
+// RemoveRoutesByInterface removes all routes that use the given network interface, and the labels of them.
+// This looks up the routes by the secondary index instead of traversing the prefix tree, and applies the removal atomically.
+// This returns the removed routes that are ordered by the address family (IPv4 comes first), the destination address, and the prefix length.
+func (rt *RouteTable) RemoveRoutesByInterface(ctx context.Context, nwInterface string) (Routes, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	removedRoutes, err := rt.removeIndexedRoutes(ctx, rt.index.byInterface[nwInterface])
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove the routes by the network interface => %s: %w", nwInterface, err)
+	}
+	return removedRoutes, nil
+}
+
+// RemoveRoutesByGateway removes all routes via the given gateway, and the labels of them.
+// This looks up the routes by the secondary index instead of traversing the prefix tree, and applies the removal atomically.
+// This returns the removed routes that are ordered by the address family (IPv4 comes first), the destination address, and the prefix length.
+func (rt *RouteTable) RemoveRoutesByGateway(ctx context.Context, gateway net.IP) (Routes, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	removedRoutes, err := rt.removeIndexedRoutes(ctx, rt.index.byGateway[nextHopKey(gateway)])
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove the routes by the gateway => %s: %w", gateway, err)
+	}
+	return removedRoutes, nil
+}
+
+// removeIndexedRoutes removes the routes of the index entry and the labels of them. The caller must hold the lock.
+func (rt *RouteTable) removeIndexedRoutes(ctx context.Context, indexedRoutes map[*Route]struct{}) (Routes, error) {
+	// copy the routes before the removal because removeRoute mutates the index entry
+	routes := make(Routes, 0, len(indexedRoutes))
+	for route := range indexedRoutes {
+		routes = append(routes, route)
+	}
+	routes.Sort()
+
+	return rt.removeRoutes(ctx, routes)
+}
@@ -0,0 +1,97 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTable_RemoveRoutesByInterface(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader(`
+default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth1
+10.1.0.0/16 via 192.0.2.2 dev eth1
+10.2.0.0/16 dev eth1
+2001:db8::/32 dev eth1
+198.51.100.0/24 dev eth2
+`)))
+	_, dst, _ := net.ParseCIDR("10.1.0.0/16")
+	assert.NoError(t, rtb.AddRouteWithLabel(ctx, "label", &Route{
+		Destination:      dst,
+		Gateway:          net.ParseIP("192.0.2.2"),
+		NetworkInterface: "eth1",
+	}))
+
+	// the updated route must be indexed by the new network interface
+	_, dst, _ = net.ParseCIDR("198.51.100.0/24")
+	assert.NoError(t, rtb.AddRoute(ctx, &Route{Destination: dst, NetworkInterface: "eth1"}))
+
+	removed, err := rtb.RemoveRoutesByInterface(ctx, "eth1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "10.1.0.0/16", "10.2.0.0/16", "198.51.100.0/24", "2001:db8::/32"}, destinations(removed))
+	assert.Equal(t, 1, rtb.Len(ctx))
+	assert.Empty(t, rtb.Labels(ctx))
+
+	removed, err = rtb.RemoveRoutesByInterface(ctx, "eth1")
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+	removed, err = rtb.RemoveRoutesByInterface(ctx, "eth2")
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	maybeRoute, err := rtb.MatchRoute(ctx, net.ParseIP("10.1.1.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0/0", maybeRoute.Unwrap().Destination.String())
+}
+
+func TestRouteTable_RemoveRoutesByGateway(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	assert.NoError(t, rtb.LoadRoutes(ctx, strings.NewReader(`
+default via 192.0.2.1 dev eth0
+10.0.0.0/8 via 192.0.2.2 dev eth1
+10.1.0.0/16 via 192.0.2.2 dev eth1
+10.2.0.0/16 via 192.0.2.3 dev eth1
+2001:db8::/32 via 2001:db8::1 dev eth1
+`)))
+
+	removed, err := rtb.RemoveRoutesByGateway(ctx, net.IPv4(192, 0, 2, 2).To4())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "10.1.0.0/16"}, destinations(removed))
+	assert.Equal(t, 3, rtb.Len(ctx))
+
+	removed, err = rtb.RemoveRoutesByGateway(ctx, net.ParseIP("2001:db8::1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::/32"}, destinations(removed))
+
+	// the indexes are replaced together with the routes
+	rtb.ClearRoutes(ctx)
+	removed, err = rtb.RemoveRoutesByGateway(ctx, net.ParseIP("192.0.2.3"))
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	_, dst, _ := net.ParseCIDR("10.3.0.0/16")
+	_, err = rtb.ReplaceRoutes(ctx, Routes{
+		{Destination: dst, Gateway: net.ParseIP("192.0.2.3"), NetworkInterface: "eth1"},
+	}, nil)
+	assert.NoError(t, err)
+	removed, err = rtb.RemoveRoutesByGateway(ctx, net.ParseIP("192.0.2.3"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.3.0.0/16"}, destinations(removed))
+	assert.Equal(t, 0, rtb.Len(ctx))
+}
+
+func destinations(routes Routes) []string {
+	dsts := make([]string, len(routes))
+	for i, r := range routes {
+		dsts[i] = r.Destination.String()
+	}
+	return dsts
+}
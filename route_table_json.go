@@ -0,0 +1,141 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// RouteTableJSONVersion is the version of the JSON document format of RouteTable that this library emits.
+const RouteTableJSONVersion = 1
+
+// ErrUnsupportedFormatVersion represents the error that indicates given serialized data has the unsupported format version.
+var ErrUnsupportedFormatVersion = errors.New("given data has the unsupported format version")
+
+// RouteTableJSON is an intermediate representation for RouteTable to do JSON marshalling and unmarshalling.
+//
+// Routes are ordered by the address family (IPv4 comes first), the destination address, and the prefix length,
+// so the marshalled result of the same routing table is always identical.
+// Labels map a label to the destination of the route in CIDR notation.
+// A route that doesn't have a gateway is represented with an empty "gateway" property.
+type RouteTableJSON struct {
+	Version int               `json:"version"`
+	Routes  []*RouteJSON      `json:"routes"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// MarshalJSON marshals the routing table including the labels into the versioned JSON document. Please refer also to RouteTableJSON.
+func (rt *RouteTable) MarshalJSON() ([]byte, error) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	routes := rt.scanNode(rt.routes)
+	routes.Sort()
+
+	rtj := &RouteTableJSON{
+		Version: RouteTableJSONVersion,
+		Routes:  make([]*RouteJSON, 0, len(routes)),
+		Labels:  make(map[string]string, len(rt.label2Destination)),
+	}
+	for _, r := range routes {
+		gateway := ""
+		if r.Gateway != nil {
+			gateway = r.Gateway.String()
+		}
+		rtj.Routes = append(rtj.Routes, &RouteJSON{
+			Destination:      r.Destination.String(),
+			Gateway:          gateway,
+			NetworkInterface: r.NetworkInterface,
+			Metric:           r.Metric,
+		})
+	}
+	for label, destination := range rt.label2Destination {
+		rtj.Labels[label] = destination.String()
+	}
+
+	return json.Marshal(rtj)
+}
+
+// UnmarshalJSON unmarshals the versioned JSON document into the routing table. Please refer also to RouteTableJSON.
+//
+// The decoding is strict; unknown properties, unsupported version, invalid routes, duplicated destinations, the IPv4 and IPv6
+// default routes that can't coexist (ErrConflictingDefaultRoutes) and labels that refer to the unknown destination are rejected,
+// and the error message tells which entry is invalid.
+// The existing routes and labels are replaced by the unmarshalled ones only when the whole document is valid.
+func (rt *RouteTable) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var rtj RouteTableJSON
+	err := decoder.Decode(&rtj)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal RouteTable: %w", err)
+	}
+	if decoder.More() {
+		return errors.New("failed to unmarshal RouteTable; there is unexpected data after the document")
+	}
+	if rtj.Version != RouteTableJSONVersion {
+		return fmt.Errorf("failed to unmarshal RouteTable; version => %d: %w", rtj.Version, ErrUnsupportedFormatVersion)
+	}
+
+	newTable := NewRouteTable()
+	key2Destination := make(map[string]*net.IPNet, len(rtj.Routes))
+	for i, rj := range rtj.Routes {
+		if rj == nil {
+			return fmt.Errorf("failed to unmarshal RouteTable; routes[%d] is null", i)
+		}
+
+		_, destination, err := net.ParseCIDR(rj.Destination)
+		if err != nil {
+			return fmt.Errorf(`failed to unmarshal RouteTable; it cannot parse the value of "destination" property of routes[%d] as net.IPNet: %w`, i, err)
+		}
+
+		var gateway net.IP
+		if rj.Gateway != "" && rj.Gateway != "<nil>" {
+			gateway = net.ParseIP(rj.Gateway)
+			if gateway == nil {
+				return fmt.Errorf(`failed to unmarshal RouteTable; it cannot parse the value of "gateway" property of routes[%d] as net.IP => %s`, i, rj.Gateway)
+			}
+		}
+
+		key := destinationKey(destination)
+		if _, ok := key2Destination[key]; ok {
+			return fmt.Errorf("failed to unmarshal RouteTable; routes[%d] has the duplicated destination => %s", i, destination)
+		}
+		key2Destination[key] = destination
+		if err := newTable.checkVacantDestination(destination); err != nil {
+			return fmt.Errorf("failed to unmarshal RouteTable; routes[%d] conflicts with the other route: %w", i, err)
+		}
+
+		err = newTable.addRoute(context.Background(), &Route{
+			Destination:      destination,
+			Gateway:          gateway,
+			NetworkInterface: rj.NetworkInterface,
+			Metric:           rj.Metric,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal RouteTable; routes[%d] is invalid: %w", i, err)
+		}
+	}
+
+	for label, cidr := range rtj.Labels {
+		_, labelDestination, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf(`failed to unmarshal RouteTable; it cannot parse the destination of labels["%s"] as net.IPNet: %w`, label, err)
+		}
+		destination, ok := key2Destination[destinationKey(labelDestination)]
+		if !ok {
+			return fmt.Errorf(`failed to unmarshal RouteTable; labels["%s"] => %s: %w`, label, cidr, ErrLabelDestinationNotFound)
+		}
+		newTable.label2Destination[label] = destination
+		newTable.destination2Label[destination.String()] = label
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.replaceWith(newTable)
+	return nil
+}
@@ -0,0 +1,170 @@
+package iprtb
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTable_MarshalJSON(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+
+	err := rtb.AddRouteWithLabel(ctx, "v6", &Route{
+		Destination: &net.IPNet{
+			IP:   net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			Mask: net.IPMask{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		Gateway:          net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	})
+	assert.NoError(t, err)
+
+	err = rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 255),
+			Mask: net.IPv4Mask(255, 255, 255, 255),
+		},
+		NetworkInterface: "ifb1",
+		Metric:           2,
+	})
+	assert.NoError(t, err)
+
+	err = rtb.AddRouteWithLabel(ctx, "v4", &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	})
+	assert.NoError(t, err)
+
+	marshalled, err := json.Marshal(rtb)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":1,"routes":[`+
+		`{"destination":"192.0.2.0/24","gateway":"192.0.2.1","networkInterface":"ifb0","metric":1},`+
+		`{"destination":"192.0.2.255/32","gateway":"","networkInterface":"ifb1","metric":2},`+
+		`{"destination":"2001:db8::/32","gateway":"2001:db8::1","networkInterface":"ifb0","metric":1}],`+
+		`"labels":{"v4":"192.0.2.0/24","v6":"2001:db8::/32"}}`, string(marshalled))
+
+	var unmarshalled RouteTable
+	err = json.Unmarshal(marshalled, &unmarshalled)
+	assert.NoError(t, err)
+
+	remarshalled, err := json.Marshal(&unmarshalled)
+	assert.NoError(t, err)
+	assert.Equal(t, marshalled, remarshalled)
+
+	maybeMatchedRoute, err := unmarshalled.MatchRoute(ctx, net.IPv4(192, 0, 2, 100))
+	assert.NoError(t, err)
+	assert.Equal(t, "ifb0", maybeMatchedRoute.Unwrap().NetworkInterface)
+
+	maybeRemovedRoute, err := unmarshalled.RemoveRouteByLabel(ctx, "v6")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::/32", maybeRemovedRoute.Unwrap().Destination.String())
+}
+
+func TestRouteTable_MarshalJSON_Empty(t *testing.T) {
+	marshalled, err := json.Marshal(NewRouteTable())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":1,"routes":[],"labels":{}}`, string(marshalled))
+}
+
+func TestRouteTable_UnmarshalJSON_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		json          string
+		expectedError string
+	}{
+		{
+			name:          "type mismatch",
+			json:          `{"version":"1"}`,
+			expectedError: "failed to unmarshal RouteTable:",
+		},
+		{
+			name:          "unknown property",
+			json:          `{"version":1,"routes":[{"destination":"192.0.2.0/24","unknown":true}]}`,
+			expectedError: "failed to unmarshal RouteTable:",
+		},
+		{
+			name:          "unsupported version",
+			json:          `{"version":2,"routes":[]}`,
+			expectedError: "failed to unmarshal RouteTable; version => 2:",
+		},
+		{
+			name:          "invalid destination",
+			json:          `{"version":1,"routes":[{"destination":"192.0.2.0/24"},{"destination":"192.0.2.0/INVALID"}]}`,
+			expectedError: `failed to unmarshal RouteTable; it cannot parse the value of "destination" property of routes[1] as net.IPNet:`,
+		},
+		{
+			name:          "invalid gateway",
+			json:          `{"version":1,"routes":[{"destination":"192.0.2.0/24","gateway":"INVALID"}]}`,
+			expectedError: `failed to unmarshal RouteTable; it cannot parse the value of "gateway" property of routes[0] as net.IP => INVALID`,
+		},
+		{
+			name:          "duplicated destination",
+			json:          `{"version":1,"routes":[{"destination":"192.0.2.0/24"},{"destination":"192.0.2.1/24"}]}`,
+			expectedError: "failed to unmarshal RouteTable; routes[1] has the duplicated destination => 192.0.2.0/24",
+		},
+		{
+			name:          "conflicting default routes",
+			json:          `{"version":1,"routes":[{"destination":"0.0.0.0/0"},{"destination":"192.0.2.0/24"},{"destination":"::/0"}]}`,
+			expectedError: "failed to unmarshal RouteTable; routes[2] conflicts with the other route: 0.0.0.0/0 and ::/0",
+		},
+		{
+			name:          "null route",
+			json:          `{"version":1,"routes":[null]}`,
+			expectedError: "failed to unmarshal RouteTable; routes[0] is null",
+		},
+		{
+			name:          "unknown label destination",
+			json:          `{"version":1,"routes":[{"destination":"192.0.2.0/24"}],"labels":{"foo":"198.51.100.0/24"}}`,
+			expectedError: `failed to unmarshal RouteTable; labels["foo"] => 198.51.100.0/24:`,
+		},
+		{
+			name:          "invalid label destination",
+			json:          `{"version":1,"routes":[{"destination":"192.0.2.0/24"}],"labels":{"foo":"INVALID"}}`,
+			expectedError: `failed to unmarshal RouteTable; it cannot parse the destination of labels["foo"] as net.IPNet:`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rtb := NewRouteTable()
+			err := json.Unmarshal([]byte(tc.json), rtb)
+			assert.Error(t, err)
+			assert.True(t, strings.HasPrefix(err.Error(), tc.expectedError), err.Error())
+		})
+	}
+}
+
+func TestRouteTable_UnmarshalJSON_ConflictingDefaultRoutes(t *testing.T) {
+	err := json.Unmarshal([]byte(`{"version":1,"routes":[{"destination":"::/0"},{"destination":"0.0.0.0/0"}]}`), NewRouteTable())
+	assert.ErrorIs(t, err, ErrConflictingDefaultRoutes)
+}
+
+func TestRouteTable_UnmarshalJSON_KeepsRoutesOnError(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		Gateway:          net.IPv4(192, 0, 2, 1),
+		NetworkInterface: "ifb0",
+		Metric:           1,
+	})
+	assert.NoError(t, err)
+
+	err = json.Unmarshal([]byte(`{"version":1,"routes":[{"destination":"INVALID"}]}`), rtb)
+	assert.Error(t, err)
+	assert.Len(t, rtb.DumpRouteTable(ctx), 1)
+}
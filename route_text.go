@@ -0,0 +1,280 @@
+package iprtb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidRouteSyntax represents the error that indicates given route text has the invalid syntax.
+var ErrInvalidRouteSyntax = errors.New("invalid syntax of route")
+
+// ParseRoutes parses the route text into the routes. The labels in the text are ignored; please use ParseRoutesWithLabels to get them.
+// Please refer also to ParseRoutesWithLabels for the details of the syntax.
+func ParseRoutes(r io.Reader) (Routes, error) {
+	routes, _, err := ParseRoutesWithLabels(r)
+	return routes, err
+}
+
+// ParseRoutesWithLabels parses the route text into the routes and the labels that map a label to the destination.
+//
+// Each line has a route in either of the following syntaxes:
+//
+//   - the output of Routes.String(), i.e. "<destination>\t<gateway>\t<network interface>\t<metric>"; "<nil>" or empty gateway means no gateway.
+//   - "<destination> [via <gateway>] [dev <network interface>] [metric <metric>] [label <label>]"; e.g. "10.0.0.0/8 via 192.0.2.1 dev eth0 metric 10 label core".
+//     The destination is either CIDR notation, a host address or "default" ("default" is regarded as IPv6 when the gateway is IPv6).
+//     The network interface and the label can be double-quoted in Go syntax to contain spaces.
+//
+// The line that has exactly 4 tab separated fields after trimming the leading and trailing whitespaces is in the former syntax,
+// and any other line is in the latter syntax, whose fields can be separated and indented by any whitespaces including tabs.
+// Empty lines and the lines that start with "#" are skipped, and "#" starts a comment in the latter syntax.
+// If there is an invalid line or a duplicated label, this returns an error that wraps ErrInvalidRouteSyntax with the line number.
+func ParseRoutesWithLabels(r io.Reader) (Routes, map[string]*net.IPNet, error) {
+	routes := Routes{}
+	labels := map[string]*net.IPNet{}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		route, label, err := parseRouteLine(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse routes at line %d: %w", lineNum, err)
+		}
+		if label != "" {
+			if _, ok := labels[label]; ok {
+				return nil, nil, fmt.Errorf("failed to parse routes at line %d; duplicated label => %q: %w", lineNum, label, ErrInvalidRouteSyntax)
+			}
+			labels[label] = route.Destination
+		}
+		routes = append(routes, route)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read routes: %w", err)
+	}
+
+	return routes, labels, nil
+}
+
+// ParseRoute parses a line of the route text into a route. Please refer also to ParseRoutesWithLabels for the details of the syntax.
+func ParseRoute(line string) (*Route, error) {
+	route, _, err := parseRouteLine(line)
+	return route, err
+}
+
+// LoadRoutes parses the route text and adds the parsed routes with the labels to the routing table at once.
+// If there is an invalid route, this returns an error without modifying the routing table.
+// Please refer also to ParseRoutesWithLabels for the details of the syntax.
+func (rt *RouteTable) LoadRoutes(ctx context.Context, r io.Reader) error {
+	routes, labels, err := ParseRoutesWithLabels(r)
+	if err != nil {
+		return err
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, route := range routes {
+		if err := validateDestination(route.Destination); err != nil {
+			return fmt.Errorf("failed to load routes; invalid destination => %s: %w", route.Destination, err)
+		}
+	}
+	for _, route := range routes {
+		if err := rt.addRoute(ctx, route); err != nil {
+			return err
+		}
+	}
+	for label, destination := range labels {
+		if prevDestination, ok := rt.label2Destination[label]; ok {
+			delete(rt.destination2Label, prevDestination.String())
+		}
+		rt.removeLabelByDestination(destination)
+		rt.label2Destination[label] = destination
+		rt.destination2Label[destination.String()] = label
+	}
+	return nil
+}
+
+// WriteRoutes writes the routes of the routing table with the labels in the route text syntax like
+// "10.0.0.0/8 via 192.0.2.1 dev eth0 metric 10 label core", so LoadRoutes can restore them.
+// The routes are ordered by the address family (IPv4 comes first), the destination address, and the prefix length.
+func (rt *RouteTable) WriteRoutes(ctx context.Context, w io.Writer) error {
+	rt.mu.RLock()
+	routes := rt.scanNode(rt.routes)
+	key2Label := rt.destinationKey2Label()
+	rt.mu.RUnlock()
+
+	routes.Sort()
+
+	bw := bufio.NewWriter(w)
+	for _, r := range routes {
+		_, _ = bw.WriteString(routeText(r, key2Label[destinationKey(r.Destination)]) + "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write routes: %w", err)
+	}
+	return nil
+}
+
+func parseRouteLine(line string) (*Route, string, error) {
+	// the lines in the rich syntax can be indented by tabs, so only the line that has exactly 4 tab separated fields is in the format of Route.String()
+	line = strings.TrimSpace(line)
+	if fields := strings.Split(line, "\t"); len(fields) == 4 {
+		route, err := parseRouteTSVLine(fields)
+		return route, "", err
+	}
+
+	fields, err := splitRouteFields(line)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(fields) == 0 {
+		return nil, "", fmt.Errorf("missing destination: %w", ErrInvalidRouteSyntax)
+	}
+
+	route := &Route{}
+	label := ""
+	seen := map[string]struct{}{}
+	for i := 1; i < len(fields); i += 2 {
+		key := fields[i]
+		if i+1 >= len(fields) {
+			return nil, "", fmt.Errorf("missing value of %q: %w", key, ErrInvalidRouteSyntax)
+		}
+		value := fields[i+1]
+
+		if _, ok := seen[key]; ok {
+			return nil, "", fmt.Errorf("duplicated %q: %w", key, ErrInvalidRouteSyntax)
+		}
+		seen[key] = struct{}{}
+
+		switch key {
+		case "via":
+			gateway := net.ParseIP(value)
+			if gateway == nil {
+				return nil, "", fmt.Errorf("invalid gateway => %q: %w", value, ErrInvalidRouteSyntax)
+			}
+			route.Gateway = gateway
+		case "dev":
+			route.NetworkInterface = value
+		case "metric":
+			metric, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid metric => %q: %w", value, ErrInvalidRouteSyntax)
+			}
+			route.Metric = metric
+		case "label":
+			if value == "" {
+				return nil, "", fmt.Errorf("empty label: %w", ErrInvalidRouteSyntax)
+			}
+			label = value
+		default:
+			return nil, "", fmt.Errorf("unknown keyword => %q: %w", key, ErrInvalidRouteSyntax)
+		}
+	}
+
+	destination, err := parseIPRouteDestination(fields[0], route.Gateway != nil && route.Gateway.To4() == nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", err, ErrInvalidRouteSyntax)
+	}
+	route.Destination = destination
+
+	return route, label, nil
+}
+
+// parseRouteTSVLine parses a line of the output of Routes.String().
+func parseRouteTSVLine(fields []string) (*Route, error) {
+	_, destination, err := net.ParseCIDR(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination => %q: %w", fields[0], ErrInvalidRouteSyntax)
+	}
+
+	var gateway net.IP
+	if fields[1] != "" && fields[1] != "<nil>" {
+		gateway = net.ParseIP(fields[1])
+		if gateway == nil {
+			return nil, fmt.Errorf("invalid gateway => %q: %w", fields[1], ErrInvalidRouteSyntax)
+		}
+	}
+
+	metric, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric => %q: %w", fields[3], ErrInvalidRouteSyntax)
+	}
+
+	return &Route{
+		Destination:      destination,
+		Gateway:          gateway,
+		NetworkInterface: fields[2],
+		Metric:           metric,
+	}, nil
+}
+
+// splitRouteFields splits the line by the whitespaces; a double-quoted field is unquoted, and an unquoted "#" starts a comment.
+func splitRouteFields(line string) ([]string, error) {
+	fields := []string{}
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" || line[0] == '#' {
+			return fields, nil
+		}
+
+		if line[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string => %s: %w", line, ErrInvalidRouteSyntax)
+			}
+			field, _ := strconv.Unquote(quoted)
+			fields = append(fields, field)
+			line = line[len(quoted):]
+			continue
+		}
+
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+}
+
+// routeText renders the route as a line of the route text syntax. Please refer also to ParseRoutesWithLabels.
+func routeText(r *Route, label string) string {
+	var sb strings.Builder
+	sb.WriteString(r.Destination.String())
+	if r.Gateway != nil {
+		sb.WriteString(" via ")
+		sb.WriteString(r.Gateway.String())
+	}
+	if r.NetworkInterface != "" {
+		sb.WriteString(" dev ")
+		sb.WriteString(quoteRouteField(r.NetworkInterface))
+	}
+	sb.WriteString(" metric ")
+	sb.WriteString(strconv.Itoa(r.Metric))
+	if label != "" {
+		sb.WriteString(" label ")
+		sb.WriteString(quoteRouteField(label))
+	}
+	return sb.String()
+}
+
+func quoteRouteField(s string) string {
+	if s[0] == '"' || s[0] == '#' || strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,196 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRoutes_RoutesStringFormat(t *testing.T) {
+	routes := Routes{
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(192, 0, 2, 0),
+				Mask: net.IPv4Mask(255, 255, 255, 0),
+			},
+			Gateway:          net.IPv4(192, 0, 2, 1),
+			NetworkInterface: "ifb0",
+			Metric:           1,
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(198, 51, 100, 0),
+				Mask: net.IPv4Mask(255, 255, 255, 0),
+			},
+			NetworkInterface: "ifb1",
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.ParseIP("2001:db8::"),
+				Mask: net.CIDRMask(32, 128),
+			},
+			Gateway: net.ParseIP("2001:db8::1"),
+			Metric:  -1,
+		},
+	}
+
+	parsed, err := ParseRoutes(strings.NewReader(routes.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, routes.String(), parsed.String())
+	assert.Nil(t, parsed[1].Gateway)
+}
+
+func TestParseRoutesWithLabels(t *testing.T) {
+	routes, labels, err := ParseRoutesWithLabels(strings.NewReader(`# core routes
+10.0.0.0/8 via 192.0.2.1 dev eth0 metric 10 label core
+192.0.2.0/24 dev eth0 # on-link
+203.0.113.1 via 192.0.2.254 label "host route"
+default via 192.0.2.1 dev eth0 metric 100
+default via fe80::1 dev eth0 label v6-default
+172.16.0.0/12 metric 5
+
+198.51.100.0/24	192.0.2.1	eth1	20
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, `10.0.0.0/8	192.0.2.1	eth0	10
+192.0.2.0/24	<nil>	eth0	0
+203.0.113.1/32	192.0.2.254		0
+0.0.0.0/0	192.0.2.1	eth0	100
+::/0	fe80::1	eth0	0
+172.16.0.0/12	<nil>		5
+198.51.100.0/24	192.0.2.1	eth1	20
+`, routes.String())
+	assert.Len(t, labels, 3)
+	assert.Equal(t, "10.0.0.0/8", labels["core"].String())
+	assert.Equal(t, "203.0.113.1/32", labels["host route"].String())
+	assert.Equal(t, "::/0", labels["v6-default"].String())
+}
+
+func TestParseRoutes_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		text          string
+		expectedError string
+	}{
+		{
+			name:          "invalid destination",
+			text:          "10.0.0.0/33 via 192.0.2.1",
+			expectedError: "failed to parse routes at line 1",
+		},
+		{
+			name:          "invalid gateway",
+			text:          "10.0.0.0/8 via 192.0.2.256",
+			expectedError: `invalid gateway => "192.0.2.256"`,
+		},
+		{
+			name:          "invalid metric",
+			text:          "10.0.0.0/8 dev eth0 metric high",
+			expectedError: `invalid metric => "high"`,
+		},
+		{
+			name:          "missing value",
+			text:          "10.0.0.0/8 via",
+			expectedError: `missing value of "via"`,
+		},
+		{
+			name:          "unknown keyword",
+			text:          "10.0.0.0/8 via 192.0.2.1 proto static",
+			expectedError: `unknown keyword => "proto"`,
+		},
+		{
+			name:          "duplicated keyword",
+			text:          "10.0.0.0/8 dev eth0 dev eth1",
+			expectedError: `duplicated "dev"`,
+		},
+		{
+			name:          "unterminated quote",
+			text:          `10.0.0.0/8 dev "eth0`,
+			expectedError: "invalid quoted string",
+		},
+		{
+			name:          "duplicated label",
+			text:          "10.0.0.0/8 dev eth0 label core\n172.16.0.0/12 dev eth0 label core",
+			expectedError: `failed to parse routes at line 2; duplicated label => "core"`,
+		},
+		{
+			name:          "too few tab separated fields",
+			text:          "10.0.0.0/8\t192.0.2.1\teth0",
+			expectedError: `unknown keyword => "192.0.2.1"`, // this is parsed as the rich syntax
+		},
+		{
+			name:          "invalid tab separated fields",
+			text:          "10.0.0.0/8\t192.0.2.1\teth0\tten",
+			expectedError: `invalid metric => "ten"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRoutes(strings.NewReader(tc.text))
+			assert.ErrorIs(t, err, ErrInvalidRouteSyntax)
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	route, err := ParseRoute("2001:db8::/32 via 2001:db8::1 dev eth0 metric 10")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::/32\t2001:db8::1\teth0\t10", route.String())
+
+	// the rich syntax that is indented or separated by tabs
+	route, err = ParseRoute("\t2001:db8::/32 via\t2001:db8::1 dev eth0\t")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::/32\t2001:db8::1\teth0\t0", route.String())
+	routes, err := ParseRoutes(strings.NewReader("\t10.0.0.0/8 via 192.0.2.1 dev eth0\n  198.51.100.0/24\t192.0.2.1\teth1\t20\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8\t192.0.2.1\teth0\t0\n198.51.100.0/24\t192.0.2.1\teth1\t20\n", routes.String())
+
+	_, err = ParseRoute("")
+	assert.ErrorIs(t, err, ErrInvalidRouteSyntax)
+}
+
+func TestRouteTable_LoadRoutesAndWriteRoutes(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.AddRouteWithLabel(ctx, "core", &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(172, 16, 0, 0),
+			Mask: net.IPv4Mask(255, 240, 0, 0),
+		},
+		NetworkInterface: "ifb0",
+	})
+	assert.NoError(t, err)
+
+	err = rtb.LoadRoutes(ctx, strings.NewReader(`198.51.100.0/24 dev "wan 0" metric 10 label "#wan"
+10.0.0.0/8 via 192.0.2.1 dev eth0 label core
+2001:db8::/32 via 2001:db8::1
+192.0.2.0/24 dev eth0
+`))
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = rtb.WriteRoutes(ctx, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `10.0.0.0/8 via 192.0.2.1 dev eth0 metric 0 label core
+172.16.0.0/12 dev ifb0 metric 0
+192.0.2.0/24 dev eth0 metric 0
+198.51.100.0/24 dev "wan 0" metric 10 label "#wan"
+2001:db8::/32 via 2001:db8::1 metric 0
+`, buf.String())
+
+	restored := NewRouteTable()
+	err = restored.LoadRoutes(ctx, strings.NewReader(buf.String()))
+	assert.NoError(t, err)
+	assert.True(t, DiffRouteTables(ctx, rtb, restored).IsEmpty())
+
+	maybeRemovedRoute, err := restored.RemoveRouteByLabel(ctx, "#wan")
+	assert.NoError(t, err)
+	assert.Equal(t, "198.51.100.0/24", maybeRemovedRoute.Unwrap().Destination.String())
+
+	err = rtb.LoadRoutes(ctx, strings.NewReader("10.0.0.0/8 via 192.0.2.1 label core\n192.0.2.0/24 via 192.0.2.256"))
+	assert.ErrorIs(t, err, ErrInvalidRouteSyntax)
+}
@@ -1,9 +1,14 @@
 package iprtb
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"net"
+	"slices"
+
+	"github.com/moznion/go-optional"
 )
 
 // Routes is a list of Route
@@ -17,6 +22,84 @@ func (rs Routes) String() string {
 	return str
 }
 
+// Sort sorts the routes in place by the address family (IPv4 comes first), the destination address, and the prefix length.
+func (rs Routes) Sort() {
+	slices.SortFunc(rs, compareRoutes)
+}
+
+// Filter returns the routes that satisfy the given predicate. The order of the routes is preserved.
+func (rs Routes) Filter(predicate func(r *Route) bool) Routes {
+	filtered := Routes{}
+	for _, r := range rs {
+		if predicate(r) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// Find returns the first route that satisfies the given predicate. If there is no such route, this returns `None`.
+func (rs Routes) Find(predicate func(r *Route) bool) optional.Option[Route] {
+	for _, r := range rs {
+		if predicate(r) {
+			return optional.Some[Route](*r)
+		}
+	}
+	return optional.None[Route]()
+}
+
+// compareRoutes compares the routes by the address family (IPv4 comes first), the destination address, and the prefix length.
+func compareRoutes(a *Route, b *Route) int {
+	aIP, bIP := canonicalDestinationIP(a.Destination), canonicalDestinationIP(b.Destination)
+	if c := cmp.Compare(len(aIP), len(bIP)); c != 0 {
+		return c
+	}
+	if c := bytes.Compare(aIP, bIP); c != 0 {
+		return c
+	}
+	aPrefixLen, _ := a.Destination.Mask.Size()
+	bPrefixLen, _ := b.Destination.Mask.Size()
+	return cmp.Compare(aPrefixLen, bPrefixLen)
+}
+
+// lowestMetricRoutes returns the routes that have the lowest metric for each destination, as the kernel prefers them.
+// If the routes for a destination have the same metric, the first one is kept. The order of the routes is preserved.
+func lowestMetricRoutes(routes Routes) Routes {
+	type destinationKey struct {
+		ip        string
+		prefixLen int
+	}
+
+	selected := make(Routes, 0, len(routes))
+	destination2Index := make(map[destinationKey]int, len(routes))
+	for _, r := range routes {
+		prefixLen, _ := r.Destination.Mask.Size()
+		key := destinationKey{ip: string(canonicalDestinationIP(r.Destination)), prefixLen: prefixLen}
+		i, ok := destination2Index[key]
+		if !ok {
+			destination2Index[key] = len(selected)
+			selected = append(selected, r)
+			continue
+		}
+		if uint32(r.Metric) < uint32(selected[i].Metric) {
+			selected[i] = r
+		}
+	}
+	return selected
+}
+
+// canonicalDestinationIP returns the network address of the destination; IPv4 address is represented as 4 bytes.
+func canonicalDestinationIP(destination *net.IPNet) net.IP {
+	ip := destination.IP
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+	if masked := ip.Mask(destination.Mask); masked != nil {
+		return masked
+	}
+	return ip
+}
+
 // Route is an entry of routing table.
 //
 // This struct type supports JSON marshalling and unmarshalling. Please refer also to RouteJSON for more information about that.
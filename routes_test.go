@@ -39,3 +39,61 @@ func TestRoute_UnmarshalJSON_FailToUnmarshalRouteJson(t *testing.T) {
 	assert.Error(t, err)
 	assert.True(t, strings.HasPrefix(err.Error(), `failed to unmarshal Route; it cannot parse the value of "destination" property as net.IPNet:`))
 }
+
+func TestRoutes_SortFilterFind(t *testing.T) {
+	routes := Routes{
+		{
+			Destination: &net.IPNet{
+				IP:   net.ParseIP("2001:db8::"),
+				Mask: net.CIDRMask(32, 128),
+			},
+			NetworkInterface: "ifb1",
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(192, 0, 2, 0),
+				Mask: net.IPv4Mask(255, 255, 255, 0),
+			},
+			Gateway:          net.IPv4(192, 0, 2, 1),
+			NetworkInterface: "ifb0",
+			Metric:           1,
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(192, 0, 0, 0).To4(),
+				Mask: net.IPv4Mask(255, 255, 0, 0),
+			},
+			NetworkInterface: "ifb1",
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(10, 0, 0, 0),
+				Mask: net.IPv4Mask(255, 0, 0, 0),
+			},
+			NetworkInterface: "ifb0",
+		},
+	}
+
+	routes.Sort()
+	assert.Equal(t, `10.0.0.0/8	<nil>	ifb0	0
+192.0.0.0/16	<nil>	ifb1	0
+192.0.2.0/24	192.0.2.1	ifb0	1
+2001:db8::/32	<nil>	ifb1	0
+`, routes.String())
+
+	filtered := routes.Filter(func(r *Route) bool {
+		return r.NetworkInterface == "ifb1"
+	})
+	assert.Equal(t, Routes{routes[1], routes[3]}, filtered)
+	assert.Empty(t, routes.Filter(func(r *Route) bool {
+		return r.Metric > 1
+	}))
+
+	maybeFound := routes.Find(func(r *Route) bool {
+		return r.Gateway != nil
+	})
+	assert.Equal(t, routes[2], maybeFound.UnwrapAsPtr())
+	assert.True(t, routes.Find(func(r *Route) bool {
+		return r.NetworkInterface == "ifb2"
+	}).IsNone())
+}
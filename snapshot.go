@@ -0,0 +1,459 @@
+package iprtb
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net"
+	"slices"
+)
+
+// SnapshotVersion is the version of the binary snapshot format of RouteTable that this library emits.
+const SnapshotVersion = 1
+
+var snapshotMagic = [4]byte{'I', 'P', 'R', 'T'}
+
+// ErrInvalidSnapshot represents the error that indicates given data is not a snapshot of RouteTable.
+var ErrInvalidSnapshot = errors.New("given data is not a valid snapshot of the routing table")
+
+// ErrSnapshotChecksumMismatch represents the error that indicates the checksum of given snapshot doesn't match its contents.
+var ErrSnapshotChecksumMismatch = errors.New("checksum of given snapshot doesn't match")
+
+// ErrUnencodableSnapshotData represents the error that indicates given route or label can't be encoded in the binary snapshot format.
+var ErrUnencodableSnapshotData = errors.New("given route or label can't be encoded in the snapshot")
+
+var snapshotCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// maxSnapshotStringLen is the upper limit of the length of network interface names and labels in a snapshot,
+// to prevent a corrupted length from allocating a huge buffer.
+const maxSnapshotStringLen = 1 << 16
+
+// WriteTo writes the compact binary snapshot of the routing table including the labels to the writer.
+// This implements io.WriterTo, and the snapshot can be loaded by ReadFrom.
+//
+// The snapshot consists of the following parts, and the integers are encoded as varint unless otherwise noted:
+//
+//	header:   magic "IPRT" (4 bytes), version (1 byte), the number of routes
+//	routes:   destination, gateway length (1 byte; 0, 4 or 16), gateway, network interface length, network interface, metric
+//	labels:   the number of labels, and then each label has label length, label and destination
+//	trailer:  CRC-32C checksum of all preceding bytes (4 bytes, big endian)
+//
+// The destination is encoded as address length (1 byte; 4 or 16), prefix length (1 byte) and the network address.
+// Routes are ordered by the address family, the destination address, and the prefix length.
+func (rt *RouteTable) WriteTo(w io.Writer) (int64, error) {
+	rt.mu.RLock()
+	routes := rt.scanNode(rt.routes)
+	labels := make(map[string]*net.IPNet, len(rt.label2Destination))
+	for label, destination := range rt.label2Destination {
+		labels[label] = destination
+	}
+	rt.mu.RUnlock()
+
+	routes.Sort()
+
+	sw := &snapshotWriter{
+		w:    bufio.NewWriter(w),
+		hash: crc32.New(snapshotCRCTable),
+	}
+
+	sw.write(snapshotMagic[:])
+	sw.write([]byte{SnapshotVersion})
+	sw.writeUvarint(uint64(len(routes)))
+	for _, r := range routes {
+		sw.writeRoute(r)
+	}
+
+	labelNames := make([]string, 0, len(labels))
+	for label := range labels {
+		labelNames = append(labelNames, label)
+	}
+	slices.Sort(labelNames)
+	sw.writeUvarint(uint64(len(labelNames)))
+	for _, label := range labelNames {
+		sw.writeString(label)
+		sw.writeDestination(labels[label])
+	}
+
+	sw.write(binary.BigEndian.AppendUint32(nil, sw.hash.Sum32()))
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	if sw.err != nil {
+		return sw.n, fmt.Errorf("failed to write a snapshot: %w", sw.err)
+	}
+	return sw.n, nil
+}
+
+// ReadFrom reads the binary snapshot that is written by WriteTo from the reader, and replaces the routes and labels
+// of the routing table by the snapshot contents. This implements io.ReaderFrom.
+//
+// This builds a new prefix tree from the snapshot without taking the lock for each route, and swaps it at once,
+// so readers never observe the half-loaded routing table.
+// If the snapshot is invalid or corrupted (including the duplicated destinations and the IPv4 and IPv6 default routes that can't coexist),
+// this returns an error without modifying the routing table.
+//
+// This doesn't consume the bytes after the snapshot, so the reader can have the other data that follows the snapshot.
+// The reader is read byte by byte unless it implements io.ByteReader or io.Seeker, so please wrap it with bufio.Reader
+// if it is a slow reader such as a network connection.
+func (rt *RouteTable) ReadFrom(r io.Reader) (int64, error) {
+	sr := newSnapshotReader(r)
+
+	newTable, err := readSnapshot(sr)
+	if releaseErr := sr.release(); err == nil && releaseErr != nil {
+		err = releaseErr
+	}
+	if err != nil {
+		return sr.n, fmt.Errorf("failed to read a snapshot: %w", err)
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.replaceWith(newTable)
+	return sr.n, nil
+}
+
+func readSnapshot(sr *snapshotReader) (*RouteTable, error) {
+	ctx := context.Background()
+
+	var magic [4]byte
+	if err := sr.read(magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != snapshotMagic {
+		return nil, ErrInvalidSnapshot
+	}
+
+	version, err := sr.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != SnapshotVersion {
+		return nil, fmt.Errorf("version => %d: %w", version, ErrUnsupportedFormatVersion)
+	}
+
+	numOfRoutes, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	newTable := NewRouteTable()
+	for i := uint64(0); i < numOfRoutes; i++ {
+		route, err := sr.readRoute()
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d]: %w", i, err)
+		}
+		if err := newTable.checkVacantDestination(route.Destination); err != nil {
+			return nil, fmt.Errorf("routes[%d]: %w: %w", i, err, ErrInvalidSnapshot)
+		}
+		if err := newTable.addRoute(ctx, route); err != nil {
+			return nil, fmt.Errorf("routes[%d]: %w", i, err)
+		}
+	}
+
+	numOfLabels, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < numOfLabels; i++ {
+		label, err := sr.readString()
+		if err != nil {
+			return nil, fmt.Errorf("labels[%d]: %w", i, err)
+		}
+		labelDestination, err := sr.readDestination()
+		if err != nil {
+			return nil, fmt.Errorf("labels[%d]: %w", i, err)
+		}
+		route := newTable.lookupExactRoute(labelDestination)
+		if route == nil {
+			return nil, fmt.Errorf("labels[%d] => %s: %w", i, label, ErrLabelDestinationNotFound)
+		}
+		newTable.label2Destination[label] = route.Destination
+		newTable.destination2Label[route.Destination.String()] = label
+	}
+
+	expectedChecksum := sr.sum32()
+	var checksum [4]byte
+	if err := sr.read(checksum[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(checksum[:]) != expectedChecksum {
+		return nil, ErrSnapshotChecksumMismatch
+	}
+
+	return newTable, nil
+}
+
+type snapshotWriter struct {
+	w    *bufio.Writer
+	hash hash.Hash32
+	n    int64
+	err  error
+	buf  [binary.MaxVarintLen64]byte
+}
+
+func (sw *snapshotWriter) write(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	n, err := sw.w.Write(b)
+	sw.n += int64(n)
+	if err != nil {
+		sw.err = err
+		return
+	}
+	_, _ = sw.hash.Write(b)
+}
+
+// fail makes the writer fail with the error, so that it never writes the data that can't be read.
+func (sw *snapshotWriter) fail(err error) {
+	if sw.err == nil {
+		sw.err = err
+	}
+}
+
+func (sw *snapshotWriter) writeUvarint(v uint64) {
+	sw.write(binary.AppendUvarint(sw.buf[:0], v))
+}
+
+func (sw *snapshotWriter) writeVarint(v int64) {
+	sw.write(binary.AppendVarint(sw.buf[:0], v))
+}
+
+func (sw *snapshotWriter) writeString(s string) {
+	if len(s) > maxSnapshotStringLen {
+		sw.fail(fmt.Errorf("too long string => %d bytes: %w", len(s), ErrUnencodableSnapshotData))
+		return
+	}
+	sw.writeUvarint(uint64(len(s)))
+	sw.write([]byte(s))
+}
+
+func (sw *snapshotWriter) writeDestination(destination *net.IPNet) {
+	ip := canonicalDestinationIP(destination)
+	prefixLen, _ := destination.Mask.Size()
+	if prefixLen > len(ip)*8 {
+		sw.fail(fmt.Errorf("prefix length is longer than the address => %s: %w", destination, ErrUnencodableSnapshotData))
+		return
+	}
+	sw.write([]byte{byte(len(ip)), byte(prefixLen)})
+	sw.write(ip)
+}
+
+func (sw *snapshotWriter) writeRoute(r *Route) {
+	sw.writeDestination(r.Destination)
+	sw.writeRouteAttributes(r.Gateway, r.NetworkInterface, r.Metric)
+}
+
+func (sw *snapshotWriter) writeRouteAttributes(gateway net.IP, nwInterface string, metric int) {
+	if ipv4 := gateway.To4(); ipv4 != nil {
+		gateway = ipv4
+	}
+	if len(gateway) != 0 && len(gateway) != net.IPv4len && len(gateway) != net.IPv6len {
+		sw.fail(fmt.Errorf("invalid gateway length => %d: %w", len(gateway), ErrUnencodableSnapshotData))
+		return
+	}
+	sw.write([]byte{byte(len(gateway))})
+	sw.write(gateway)
+	sw.writeString(nwInterface)
+	sw.writeVarint(int64(metric))
+}
+
+// snapshotSource is the reader that a snapshot is read from.
+type snapshotSource interface {
+	io.Reader
+	io.ByteReader
+}
+
+type snapshotReader struct {
+	r       snapshotSource
+	seeker  io.Seeker // the original reader to give back the read-ahead bytes to, if r buffers it
+	hash    hash.Hash32
+	n       int64
+	pending []byte            // bytes that have been read but haven't been applied to the hash yet
+	strings map[string]string // to share the identical strings such as network interface names
+	buf     []byte
+}
+
+func newSnapshotReader(r io.Reader) *snapshotReader {
+	sr := &snapshotReader{
+		hash:    crc32.New(snapshotCRCTable),
+		pending: make([]byte, 0, 4096),
+		strings: map[string]string{},
+	}
+	switch r := r.(type) {
+	case snapshotSource:
+		sr.r = r
+	case io.ReadSeeker:
+		// the read-ahead bytes are given back by seeking on release
+		sr.r = bufio.NewReader(r)
+		sr.seeker = r
+	default:
+		sr.r = &unbufferedByteReader{r: r}
+	}
+	return sr
+}
+
+// release gives back the bytes that have been read ahead from the original reader but are not a part of the snapshot.
+func (sr *snapshotReader) release() error {
+	if sr.seeker == nil {
+		return nil
+	}
+	buffered := sr.r.(*bufio.Reader).Buffered()
+	if buffered == 0 {
+		return nil
+	}
+	if _, err := sr.seeker.Seek(-int64(buffered), io.SeekCurrent); err != nil {
+		return fmt.Errorf("failed to seek back to the end of the snapshot: %w", err)
+	}
+	return nil
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	sr.n++
+	sr.addToHash(b)
+	return b, nil
+}
+
+func (sr *snapshotReader) read(b []byte) error {
+	n, err := io.ReadFull(sr.r, b)
+	sr.n += int64(n)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	sr.addToHash(b...)
+	return nil
+}
+
+func (sr *snapshotReader) addToHash(b ...byte) {
+	if len(sr.pending)+len(b) > cap(sr.pending) {
+		_, _ = sr.hash.Write(sr.pending)
+		sr.pending = sr.pending[:0]
+	}
+	sr.pending = append(sr.pending, b...)
+}
+
+func (sr *snapshotReader) sum32() uint32 {
+	_, _ = sr.hash.Write(sr.pending)
+	sr.pending = sr.pending[:0]
+	return sr.hash.Sum32()
+}
+
+func (sr *snapshotReader) readString() (string, error) {
+	length, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return "", err
+	}
+	if length > maxSnapshotStringLen {
+		return "", fmt.Errorf("too long string => %d bytes: %w", length, ErrInvalidSnapshot)
+	}
+	if uint64(cap(sr.buf)) < length {
+		sr.buf = make([]byte, length)
+	}
+	b := sr.buf[:length]
+	if err := sr.read(b); err != nil {
+		return "", err
+	}
+	if s, ok := sr.strings[string(b)]; ok {
+		return s, nil
+	}
+	s := string(b)
+	sr.strings[s] = s
+	return s, nil
+}
+
+func (sr *snapshotReader) readDestination() (*net.IPNet, error) {
+	var header [2]byte
+	if err := sr.read(header[:]); err != nil {
+		return nil, err
+	}
+	ipLen, prefixLen := int(header[0]), int(header[1])
+	if (ipLen != net.IPv4len && ipLen != net.IPv6len) || prefixLen > ipLen*8 {
+		return nil, fmt.Errorf("invalid destination; address length => %d, prefix length => %d: %w", ipLen, prefixLen, ErrInvalidSnapshot)
+	}
+	ip := make(net.IP, ipLen)
+	if err := sr.read(ip); err != nil {
+		return nil, err
+	}
+	return &net.IPNet{
+		IP:   ip,
+		Mask: net.CIDRMask(prefixLen, ipLen*8),
+	}, nil
+}
+
+func (sr *snapshotReader) readRoute() (*Route, error) {
+	destination, err := sr.readDestination()
+	if err != nil {
+		return nil, err
+	}
+	gateway, nwInterface, metric, err := sr.readRouteAttributes()
+	if err != nil {
+		return nil, err
+	}
+	return &Route{
+		Destination:      destination,
+		Gateway:          gateway,
+		NetworkInterface: nwInterface,
+		Metric:           metric,
+	}, nil
+}
+
+func (sr *snapshotReader) readRouteAttributes() (net.IP, string, int, error) {
+	gatewayLen, err := sr.ReadByte()
+	if err != nil {
+		return nil, "", 0, err
+	}
+	var gateway net.IP
+	if gatewayLen != 0 {
+		if gatewayLen != net.IPv4len && gatewayLen != net.IPv6len {
+			return nil, "", 0, fmt.Errorf("invalid gateway length => %d: %w", gatewayLen, ErrInvalidSnapshot)
+		}
+		gateway = make(net.IP, gatewayLen)
+		if err := sr.read(gateway); err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	nwInterface, err := sr.readString()
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	metric, err := binary.ReadVarint(sr)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return gateway, nwInterface, int(metric), nil
+}
+
+// unbufferedByteReader implements io.ByteReader without reading ahead, so that it doesn't consume the bytes after the snapshot.
+type unbufferedByteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (ur *unbufferedByteReader) Read(b []byte) (int, error) {
+	return ur.r.Read(b)
+}
+
+func (ur *unbufferedByteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(ur.r, ur.buf[:]); err != nil {
+		return 0, err
+	}
+	return ur.buf[0], nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
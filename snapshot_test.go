@@ -0,0 +1,238 @@
+package iprtb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const snapshotTestRoutes = `192.0.2.0/24 via 192.0.2.1 dev ifb0 metric 1 label v4
+192.0.2.255/32 dev ifb1 metric -1
+2001:db8::/32 via 2001:db8::1 dev ifb0 metric 1000 label v6
+`
+
+func TestRouteTable_WriteTo_ReadFrom(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := newTestRouteTable(t, snapshotTestRoutes)
+
+	var buf bytes.Buffer
+	written, err := rtb.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), written)
+
+	loaded := NewRouteTable()
+	read, err := loaded.ReadFrom(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, written, read)
+
+	expectedJSON, err := json.Marshal(rtb)
+	assert.NoError(t, err)
+	actualJSON, err := json.Marshal(loaded)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expectedJSON), string(actualJSON))
+
+	maybeRemovedRoute, err := loaded.RemoveRouteByLabel(ctx, "v4")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.0/24", maybeRemovedRoute.Unwrap().Destination.String())
+
+	// the same routing table makes the identical snapshot
+	var buf2 bytes.Buffer
+	_, err = newTestRouteTable(t, snapshotTestRoutes).WriteTo(&buf2)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), buf2.Bytes())
+}
+
+func TestRouteTable_ReadFrom_Invalid(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	_, err := newTestRouteTable(t, snapshotTestRoutes).WriteTo(&buf)
+	assert.NoError(t, err)
+	snapshot := buf.Bytes()
+
+	t.Run("invalid magic", func(t *testing.T) {
+		broken := bytes.Clone(snapshot)
+		broken[0] = 'X'
+		_, err := NewRouteTable().ReadFrom(bytes.NewReader(broken))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		broken := bytes.Clone(snapshot)
+		broken[4] = 0xff
+		_, err := NewRouteTable().ReadFrom(bytes.NewReader(broken))
+		assert.ErrorIs(t, err, ErrUnsupportedFormatVersion)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		broken := bytes.Clone(snapshot)
+		broken[len(broken)-5] ^= 0xff
+		_, err := NewRouteTable().ReadFrom(bytes.NewReader(broken))
+		assert.Error(t, err)
+	})
+
+	t.Run("corrupted checksum", func(t *testing.T) {
+		broken := bytes.Clone(snapshot)
+		broken[len(broken)-1] ^= 0xff
+		_, err := NewRouteTable().ReadFrom(bytes.NewReader(broken))
+		assert.ErrorIs(t, err, ErrSnapshotChecksumMismatch)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		for i := 0; i < len(snapshot); i++ {
+			_, err := NewRouteTable().ReadFrom(bytes.NewReader(snapshot[:i]))
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "length => %d", i)
+		}
+	})
+
+	t.Run("keeps the routes on error", func(t *testing.T) {
+		rtb := newTestRouteTable(t, snapshotTestRoutes)
+		_, err := rtb.ReadFrom(bytes.NewReader(snapshot[:len(snapshot)-1]))
+		assert.Error(t, err)
+		assert.Len(t, rtb.DumpRouteTable(ctx), 3)
+	})
+}
+
+// writeTestSnapshot writes the snapshot that has the given routes as they are, even if they can't be in a routing table.
+func writeTestSnapshot(t *testing.T, routeText string) []byte {
+	routes, err := ParseRoutes(strings.NewReader(routeText))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	sw := &snapshotWriter{
+		w:    bufio.NewWriter(&buf),
+		hash: crc32.New(snapshotCRCTable),
+	}
+	sw.write(snapshotMagic[:])
+	sw.write([]byte{SnapshotVersion})
+	sw.writeUvarint(uint64(len(routes)))
+	for _, r := range routes {
+		sw.writeRoute(r)
+	}
+	sw.writeUvarint(0)
+	sw.write(binary.BigEndian.AppendUint32(nil, sw.hash.Sum32()))
+	assert.NoError(t, sw.err)
+	assert.NoError(t, sw.w.Flush())
+	return buf.Bytes()
+}
+
+func TestRouteTable_ReadFrom_ConflictingRoutes(t *testing.T) {
+	_, err := NewRouteTable().ReadFrom(bytes.NewReader(writeTestSnapshot(t, `0.0.0.0/0 via 192.0.2.1 dev ifb0
+192.0.2.0/24 dev ifb0
+::/0 via fe80::1 dev ifb0
+`)))
+	assert.ErrorIs(t, err, ErrConflictingDefaultRoutes)
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+
+	_, err = NewRouteTable().ReadFrom(bytes.NewReader(writeTestSnapshot(t, `192.0.2.0/24 dev ifb0
+192.0.2.0/24 dev ifb1
+`)))
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+	assert.Contains(t, err.Error(), "routes[1]: duplicated destination => 192.0.2.0/24")
+}
+
+// readerOnly hides the other methods than Read of the underlying reader.
+type readerOnly struct {
+	io.Reader
+}
+
+func TestRouteTable_ReadFrom_FollowingData(t *testing.T) {
+	var buf bytes.Buffer
+	written, err := newTestRouteTable(t, snapshotTestRoutes).WriteTo(&buf)
+	assert.NoError(t, err)
+	const following = "the data after the snapshot"
+	buf.WriteString(following)
+	data := buf.Bytes()
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	for _, tc := range []struct {
+		name string
+		r    io.Reader
+	}{
+		{name: "io.ByteReader", r: bytes.NewReader(data)},
+		{name: "io.ReadSeeker", r: f},
+		{name: "io.Reader", r: readerOnly{bytes.NewReader(data)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rtb := NewRouteTable()
+			read, err := rtb.ReadFrom(tc.r)
+			assert.NoError(t, err)
+			assert.Equal(t, written, read)
+			assert.Len(t, rtb.DumpRouteTable(context.Background()), 3)
+
+			rest, err := io.ReadAll(tc.r)
+			assert.NoError(t, err)
+			assert.Equal(t, following, string(rest))
+		})
+	}
+}
+
+func newBenchmarkRouteTable(b *testing.B, numOfRoutes int) *RouteTable {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	for i := 0; i < numOfRoutes; i++ {
+		err := rtb.AddRoute(ctx, &Route{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)),
+				Mask: net.IPv4Mask(255, 255, 255, 255),
+			},
+			Gateway:          net.IPv4(192, 0, 2, byte(i)),
+			NetworkInterface: "ifb0",
+			Metric:           i % 100,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return rtb
+}
+
+func BenchmarkRouteTable_ReadFrom(b *testing.B) {
+	var buf bytes.Buffer
+	_, err := newBenchmarkRouteTable(b, 100000).WriteTo(&buf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := NewRouteTable().ReadFrom(bytes.NewReader(snapshot))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRouteTable_UnmarshalJSON(b *testing.B) {
+	marshalled, err := json.Marshal(newBenchmarkRouteTable(b, 100000))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := json.Unmarshal(marshalled, NewRouteTable())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
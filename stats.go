@@ -0,0 +1,94 @@
+package iprtb
+
+import (
+	"context"
+	"net"
+	"unsafe"
+)
+
+// RouteTableStats is the statistics of the routing table.
+type RouteTableStats struct {
+	// IPv4Routes is the number of IPv4 routes.
+	IPv4Routes int
+	// IPv6Routes is the number of IPv6 routes.
+	IPv6Routes int
+	// IPv4PrefixLengths is the histogram of IPv4 routes; the index is the prefix length and the value is the number of routes.
+	IPv4PrefixLengths [8*net.IPv4len + 1]int
+	// IPv6PrefixLengths is the histogram of IPv6 routes; the index is the prefix length and the value is the number of routes.
+	IPv6PrefixLengths [8*net.IPv6len + 1]int
+	// Labels is the number of labels.
+	Labels int
+	// Nodes is the number of nodes of the prefix tree including the root node.
+	Nodes int
+	// MaxDepth is the depth of the deepest node of the prefix tree; the root node is at depth 0.
+	MaxDepth int
+	// EstimatedMemoryBytes is the estimated memory footprint of the prefix tree and the routes in bytes.
+	// This is a rough estimation that doesn't consider the overhead of the memory allocator and the labels.
+	EstimatedMemoryBytes int
+}
+
+// TotalRoutes returns the total number of routes.
+func (s *RouteTableStats) TotalRoutes() int {
+	return s.IPv4Routes + s.IPv6Routes
+}
+
+// routeCounters holds the counters of the routes that are maintained on every mutation of the prefix tree.
+type routeCounters struct {
+	ipv4Routes        int
+	ipv6Routes        int
+	ipv4PrefixLengths [8*net.IPv4len + 1]int
+	ipv6PrefixLengths [8*net.IPv6len + 1]int
+}
+
+// count adds delta to the counters that the route belongs to.
+func (c *routeCounters) count(route *Route, delta int) {
+	prefixLen, _ := route.Destination.Mask.Size()
+	if route.Destination.IP.To4() != nil { // this doesn't use canonicalDestinationIP to avoid the allocation on every mutation
+		c.ipv4Routes += delta
+		c.ipv4PrefixLengths[max(min(prefixLen, 8*net.IPv4len), 0)] += delta
+		return
+	}
+	c.ipv6Routes += delta
+	c.ipv6PrefixLengths[max(min(prefixLen, 8*net.IPv6len), 0)] += delta
+}
+
+// Len returns the number of routes in the routing table. This doesn't traverse the prefix tree.
+func (rt *RouteTable) Len(ctx context.Context) int {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.counters.ipv4Routes + rt.counters.ipv6Routes
+}
+
+// Stats returns the statistics of the routing table.
+// The numbers of the routes and labels are maintained counters, and the other values are calculated by traversing the prefix tree.
+func (rt *RouteTable) Stats(ctx context.Context) *RouteTableStats {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	stats := &RouteTableStats{
+		IPv4Routes:        rt.counters.ipv4Routes,
+		IPv6Routes:        rt.counters.ipv6Routes,
+		IPv4PrefixLengths: rt.counters.ipv4PrefixLengths,
+		IPv6PrefixLengths: rt.counters.ipv6PrefixLengths,
+		Labels:            len(rt.label2Destination),
+	}
+	walkNodeStats(rt.routes, 0, stats)
+	return stats
+}
+
+func walkNodeStats(visitNode *node, depth int, stats *RouteTableStats) {
+	stats.Nodes++
+	stats.MaxDepth = max(stats.MaxDepth, depth)
+	stats.EstimatedMemoryBytes += int(unsafe.Sizeof(node{}))
+	if r := visitNode.route; r != nil {
+		stats.EstimatedMemoryBytes += int(unsafe.Sizeof(Route{})) + int(unsafe.Sizeof(net.IPNet{})) +
+			len(r.Destination.IP) + len(r.Destination.Mask) + len(r.Gateway) + len(r.NetworkInterface)
+	}
+
+	if visitNode.zeroBitNode != nil {
+		walkNodeStats(visitNode.zeroBitNode, depth+1, stats)
+	}
+	if visitNode.oneBitNode != nil {
+		walkNodeStats(visitNode.oneBitNode, depth+1, stats)
+	}
+}
@@ -0,0 +1,160 @@
+package iprtb
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTable_Stats(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	stats := rtb.Stats(ctx)
+	assert.Equal(t, 0, stats.TotalRoutes())
+	assert.Equal(t, 1, stats.Nodes)
+	assert.Equal(t, 0, stats.MaxDepth)
+	assert.Equal(t, 0, rtb.Len(ctx))
+
+	err := rtb.AddRoutes(ctx, Routes{
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(192, 0, 2, 0),
+				Mask: net.IPv4Mask(255, 255, 255, 0),
+			},
+			Gateway:          net.IPv4(192, 0, 2, 1),
+			NetworkInterface: "ifb0",
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(192, 0, 2, 128).To4(),
+				Mask: net.IPv4Mask(255, 255, 255, 128),
+			},
+			NetworkInterface: "ifb0",
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.IPv4(198, 51, 100, 0),
+				Mask: net.IPv4Mask(255, 255, 255, 0),
+			},
+			NetworkInterface: "ifb1",
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.ParseIP("2001:db8::"),
+				Mask: net.CIDRMask(32, 128),
+			},
+			NetworkInterface: "ifb0",
+		},
+	})
+	assert.NoError(t, err)
+	err = rtb.AddRouteWithLabel(ctx, "v6", &Route{
+		Destination: &net.IPNet{
+			IP:   net.ParseIP("2001:db8:1::"),
+			Mask: net.CIDRMask(48, 128),
+		},
+		NetworkInterface: "ifb1",
+	})
+	assert.NoError(t, err)
+
+	// overwriting an existing route doesn't change the counters
+	err = rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(192, 0, 2, 0),
+			Mask: net.IPv4Mask(255, 255, 255, 0),
+		},
+		NetworkInterface: "ifb2",
+	})
+	assert.NoError(t, err)
+
+	stats = rtb.Stats(ctx)
+	assert.Equal(t, 3, stats.IPv4Routes)
+	assert.Equal(t, 2, stats.IPv6Routes)
+	assert.Equal(t, 5, stats.TotalRoutes())
+	assert.Equal(t, 5, rtb.Len(ctx))
+	assert.Equal(t, 2, stats.IPv4PrefixLengths[24])
+	assert.Equal(t, 1, stats.IPv4PrefixLengths[25])
+	assert.Equal(t, 1, stats.IPv6PrefixLengths[32])
+	assert.Equal(t, 1, stats.IPv6PrefixLengths[48])
+	assert.Equal(t, 1, stats.Labels)
+	assert.Equal(t, 48, stats.MaxDepth)
+	assert.Greater(t, stats.Nodes, 48)
+	assert.Greater(t, stats.EstimatedMemoryBytes, 0)
+
+	_, err = rtb.RemoveRouteByLabel(ctx, "v6")
+	assert.NoError(t, err)
+	_, err = rtb.RemoveRoute(ctx, &net.IPNet{
+		IP:   net.IPv4(192, 0, 2, 0),
+		Mask: net.IPv4Mask(255, 255, 255, 0),
+	})
+	assert.NoError(t, err)
+	// removing a nonexistent route doesn't change the counters
+	_, err = rtb.RemoveRoute(ctx, &net.IPNet{
+		IP:   net.IPv4(203, 0, 113, 0),
+		Mask: net.IPv4Mask(255, 255, 255, 0),
+	})
+	assert.NoError(t, err)
+
+	stats = rtb.Stats(ctx)
+	assert.Equal(t, 2, stats.IPv4Routes)
+	assert.Equal(t, 1, stats.IPv6Routes)
+	assert.Equal(t, 1, stats.IPv4PrefixLengths[24])
+	assert.Equal(t, 0, stats.IPv6PrefixLengths[48])
+	assert.Equal(t, 0, stats.Labels)
+	assert.Equal(t, 32, stats.MaxDepth)
+
+	marshalled, err := json.Marshal(rtb)
+	assert.NoError(t, err)
+	restored := NewRouteTable()
+	err = json.Unmarshal(marshalled, restored)
+	assert.NoError(t, err)
+	restoredStats := restored.Stats(ctx)
+	restoredStats.EstimatedMemoryBytes = stats.EstimatedMemoryBytes // the length of IP addresses can be different
+	assert.Equal(t, stats, restoredStats)
+
+	rtb.ClearRoutes(ctx)
+	assert.Equal(t, 0, rtb.Len(ctx))
+	assert.Equal(t, 1, rtb.Stats(ctx).Nodes)
+}
+
+func TestRouteTable_Stats_DefaultRoute(t *testing.T) {
+	ctx := context.Background()
+
+	rtb := NewRouteTable()
+	err := rtb.AddRoute(ctx, &Route{
+		Destination: &net.IPNet{
+			IP:   net.IPv4(0, 0, 0, 0),
+			Mask: net.IPv4Mask(0, 0, 0, 0),
+		},
+		Gateway: net.IPv4(192, 0, 2, 1),
+	})
+	assert.NoError(t, err)
+
+	stats := rtb.Stats(ctx)
+	assert.Equal(t, 1, stats.IPv4Routes)
+	assert.Equal(t, 1, stats.IPv4PrefixLengths[0])
+	assert.Equal(t, 0, stats.MaxDepth)
+
+	_, err = rtb.RemoveRoute(ctx, &net.IPNet{
+		IP:   net.IPv4(0, 0, 0, 0),
+		Mask: net.IPv4Mask(0, 0, 0, 0),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rtb.Len(ctx))
+}
+
+func TestRouteCounters_CountDoesNotAllocate(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	var counters routeCounters
+	allocs := testing.AllocsPerRun(100, func() {
+		counters.count(&Route{Destination: v4}, 1)
+		counters.count(&Route{Destination: v6}, 1)
+	})
+	assert.Zero(t, allocs)
+	assert.Equal(t, 101, counters.ipv4PrefixLengths[24])
+	assert.Equal(t, 101, counters.ipv6PrefixLengths[32])
+}
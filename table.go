@@ -0,0 +1,153 @@
+package iprtb
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteSortOrder is the order of the routes in the formatted table.
+type RouteSortOrder int
+
+const (
+	// SortByDestination orders the routes by the destination address and the prefix length.
+	SortByDestination RouteSortOrder = iota
+	// SortByGateway orders the routes by the gateway address; the routes that don't have a gateway come first.
+	SortByGateway
+	// SortByNetworkInterface orders the routes by the name of the network interface.
+	SortByNetworkInterface
+	// SortByMetric orders the routes by the metric.
+	SortByMetric
+)
+
+// TableFormatOptions is the options to format the routes as a table.
+type TableFormatOptions struct {
+	// SortOrder is the order of the routes in each address family. The ties are ordered by the destination.
+	SortOrder RouteSortOrder
+	// WithLabels adds the "Label" column.
+	WithLabels bool
+}
+
+// FormatTable writes the routes of the routing table as a human-readable table like `route -n` and `netstat -rn`.
+//
+// The routes are grouped by the address family (IPv4 comes first) and each group has a header line and the aligned columns
+// "Destination", "Gateway", "Interface" and "Metric" (and "Label" if TableFormatOptions.WithLabels is true).
+// The missing gateway and network interface are written as "*".
+func (rt *RouteTable) FormatTable(ctx context.Context, w io.Writer, opts TableFormatOptions) error {
+	rt.mu.RLock()
+	routes := rt.scanNode(rt.routes)
+	key2Label := rt.destinationKey2Label()
+	rt.mu.RUnlock()
+
+	return formatRouteTable(w, routes, key2Label, opts)
+}
+
+// FormatTable writes the routes as a human-readable table. Please refer also to RouteTable.FormatTable.
+// Routes don't have the labels, so the "Label" column is always empty.
+func (rs Routes) FormatTable(w io.Writer, opts TableFormatOptions) error {
+	return formatRouteTable(w, slices.Clone(rs), nil, opts)
+}
+
+func formatRouteTable(w io.Writer, routes Routes, key2Label map[string]string, opts TableFormatOptions) error {
+	compare := routeComparator(opts.SortOrder)
+	slices.SortFunc(routes, func(a *Route, b *Route) int {
+		aLen, bLen := len(canonicalDestinationIP(a.Destination)), len(canonicalDestinationIP(b.Destination))
+		if c := cmp.Compare(aLen, bLen); c != 0 {
+			return c
+		}
+		if c := compare(a, b); c != 0 {
+			return c
+		}
+		return compareRoutes(a, b)
+	})
+
+	header := "Destination\tGateway\tInterface\tMetric"
+	if opts.WithLabels {
+		header += "\tLabel"
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	prevFamily := ""
+	for _, r := range routes {
+		family := "IPv6"
+		if len(canonicalDestinationIP(r.Destination)) == net.IPv4len {
+			family = "IPv4"
+		}
+		if family != prevFamily {
+			if prevFamily != "" {
+				_, _ = fmt.Fprintln(tw)
+			}
+			_, _ = fmt.Fprintf(tw, "%s routes\n%s\n", family, header)
+			prevFamily = family
+		}
+
+		gateway := "*"
+		if r.Gateway != nil {
+			gateway = r.Gateway.String()
+		}
+		nwInterface := "*"
+		if r.NetworkInterface != "" {
+			nwInterface = r.NetworkInterface
+		}
+
+		columns := []string{r.Destination.String(), gateway, nwInterface, strconv.Itoa(r.Metric)}
+		if opts.WithLabels {
+			columns = append(columns, key2Label[destinationKey(r.Destination)])
+		}
+		_, _ = fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	}
+
+	_ = tw.Flush()
+
+	// trim the padding of the empty trailing cells (e.g. the routes that don't have a label)
+	bw := bufio.NewWriter(w)
+	for _, line := range bytes.SplitAfter(buf.Bytes(), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		_, _ = bw.Write(bytes.TrimRight(line, " \n"))
+		_ = bw.WriteByte('\n')
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write the route table: %w", err)
+	}
+	return nil
+}
+
+func routeComparator(order RouteSortOrder) func(a *Route, b *Route) int {
+	switch order {
+	case SortByGateway:
+		return func(a *Route, b *Route) int {
+			aGateway, bGateway := a.Gateway, b.Gateway
+			if ipv4 := aGateway.To4(); ipv4 != nil {
+				aGateway = ipv4
+			}
+			if ipv4 := bGateway.To4(); ipv4 != nil {
+				bGateway = ipv4
+			}
+			if c := cmp.Compare(len(aGateway), len(bGateway)); c != 0 {
+				return c
+			}
+			return bytes.Compare(aGateway, bGateway)
+		}
+	case SortByNetworkInterface:
+		return func(a *Route, b *Route) int {
+			return strings.Compare(a.NetworkInterface, b.NetworkInterface)
+		}
+	case SortByMetric:
+		return func(a *Route, b *Route) int {
+			return cmp.Compare(a.Metric, b.Metric)
+		}
+	default:
+		return compareRoutes
+	}
+}
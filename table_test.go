@@ -0,0 +1,105 @@
+package iprtb
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const tableTestRoutes = `192.0.2.0/24 dev eth0 metric 100
+10.0.0.0/8
+2001:db8::/32 via fe80::1 dev eth0 metric 1024
+198.51.100.0/24 via 192.0.2.1 dev eth0 metric 10 label upstream
+`
+
+func TestRouteTable_FormatTable(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, tableTestRoutes)
+
+	buf := &bytes.Buffer{}
+	err := rtb.FormatTable(ctx, buf, TableFormatOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `IPv4 routes
+Destination      Gateway    Interface  Metric
+10.0.0.0/8       *          *          0
+192.0.2.0/24     *          eth0       100
+198.51.100.0/24  192.0.2.1  eth0       10
+
+IPv6 routes
+Destination    Gateway  Interface  Metric
+2001:db8::/32  fe80::1  eth0       1024
+`, buf.String())
+}
+
+func TestRouteTable_FormatTable_WithLabelsAndSortOrder(t *testing.T) {
+	ctx := context.Background()
+	rtb := newTestRouteTable(t, tableTestRoutes)
+
+	buf := &bytes.Buffer{}
+	err := rtb.FormatTable(ctx, buf, TableFormatOptions{
+		SortOrder:  SortByMetric,
+		WithLabels: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `IPv4 routes
+Destination      Gateway    Interface  Metric  Label
+10.0.0.0/8       *          *          0
+198.51.100.0/24  192.0.2.1  eth0       10      upstream
+192.0.2.0/24     *          eth0       100
+
+IPv6 routes
+Destination    Gateway  Interface  Metric  Label
+2001:db8::/32  fe80::1  eth0       1024
+`, buf.String())
+
+	buf.Reset()
+	err = rtb.FormatTable(ctx, buf, TableFormatOptions{SortOrder: SortByGateway})
+	assert.NoError(t, err)
+	assert.Equal(t, `IPv4 routes
+Destination      Gateway    Interface  Metric
+10.0.0.0/8       *          *          0
+192.0.2.0/24     *          eth0       100
+198.51.100.0/24  192.0.2.1  eth0       10
+
+IPv6 routes
+Destination    Gateway  Interface  Metric
+2001:db8::/32  fe80::1  eth0       1024
+`, buf.String())
+}
+
+func TestRoutes_FormatTable(t *testing.T) {
+	routes := Routes{
+		{
+			Destination: &net.IPNet{
+				IP:   net.ParseIP("2001:db8::"),
+				Mask: net.CIDRMask(32, 128),
+			},
+			NetworkInterface: "eth1",
+		},
+		{
+			Destination: &net.IPNet{
+				IP:   net.ParseIP("2001:db8:1::"),
+				Mask: net.CIDRMask(48, 128),
+			},
+			NetworkInterface: "eth0",
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	err := routes.FormatTable(buf, TableFormatOptions{SortOrder: SortByNetworkInterface})
+	assert.NoError(t, err)
+	assert.Equal(t, `IPv6 routes
+Destination      Gateway  Interface  Metric
+2001:db8:1::/48  *        eth0       0
+2001:db8::/32    *        eth1       0
+`, buf.String())
+	assert.Equal(t, "2001:db8::/32", routes[0].Destination.String(), "it must not sort the given routes in place")
+
+	buf.Reset()
+	err = Routes{}.FormatTable(buf, TableFormatOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+}